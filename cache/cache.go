@@ -0,0 +1,197 @@
+// Package cache keeps read-through copies of hot read responses, in process
+// or in a store shared by a cluster, and drops exactly the copies that
+// writes make stale.
+//
+// Copies are tagged with what they were read from. A row tag, e.g.
+// books:12, marks the copies showing the row; a children tag, e.g.
+// works:3/books, those listing the children of a row; and a table tag, e.g.
+// books, the lists of the table. Writes invalidate the tags of the rows they
+// change, and those of the parents and tables they add rows to.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"mentalartsapi/ids"
+	"mentalartsapi/tenancy"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// maxLoadTime is how long stores remember invalidations, so that values
+// loaded before them are not stored after them. Values taking longer to
+// load are not stored at all.
+const maxLoadTime = 10 * time.Second
+
+// Store keeps cached values under keys, with their tags. Every invalidation
+// starts a new generation, which lets Set tell values loaded before it.
+type Store interface {
+	// Get returns the value under key, if it is there and not expired
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Generation returns the current generation of invalidations
+	Generation(ctx context.Context) (uint64, error)
+	// Set stores value under key for ttl, tagged with tags, unless any of
+	// the tags was invalidated after generation, when the value was loaded
+	Set(ctx context.Context, key string, value []byte, tags []string, ttl time.Duration, generation uint64) error
+	// Invalidate drops the values tagged with any of tags
+	Invalidate(ctx context.Context, tags ...string) error
+	// Ping checks that the store can be reached
+	Ping(ctx context.Context) error
+}
+
+var (
+	store Store
+	ttl   time.Duration
+	loads singleflight.Group
+)
+
+// Use caches values in s for entryTTL. Until it is called nothing is cached.
+func Use(s Store, entryTTL time.Duration) {
+	store = s
+	ttl = entryTTL
+}
+
+// Row returns the tag of a row of table
+func Row(table string, id ids.ID) string {
+	return table + ":" + strconv.FormatUint(uint64(id), 10)
+}
+
+// Children returns the tag of the rows of a relation of a row of table, e.g.
+// the books of an author
+func Children(table string, id ids.ID, relation string) string {
+	return Row(table, id) + "/" + relation
+}
+
+// Fetch returns the value under key, loading it and storing it with the tags
+// load returns when it is missing. Concurrent fetches of a missing key share
+// one load. Keys and tags are scoped to the tenant of ctx.
+//
+// A value is not stored when its tags were invalidated while it loaded, as
+// it may be older than the write that invalidated them.
+//
+// Store failures are logged and the value loaded from the database instead.
+// Nothing is cached within Defer, whose reads may see writes that are not
+// committed yet.
+func Fetch(ctx context.Context, key string, load func() ([]byte, []string, error)) ([]byte, error) {
+	if store == nil || deferredFrom(ctx) != nil {
+		value, _, err := load()
+		return value, err
+	}
+
+	key = scoped(ctx, key)
+	value, ok, err := store.Get(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "Could not read from cache", "key", key, "error", err)
+	}
+	if ok {
+		return value, nil
+	}
+
+	loaded, err, _ := loads.Do(key, func() (interface{}, error) {
+		generation, genErr := store.Generation(ctx)
+		start := time.Now()
+		value, tags, err := load()
+		if err != nil {
+			return nil, err
+		}
+		if genErr != nil {
+			slog.WarnContext(ctx, "Could not read from cache", "key", key, "error", genErr)
+			return value, nil
+		}
+		if time.Since(start) > maxLoadTime {
+			return value, nil
+		}
+		for i, tag := range tags {
+			tags[i] = scoped(ctx, tag)
+		}
+		if err := store.Set(ctx, key, value, tags, ttl, generation); err != nil {
+			slog.WarnContext(ctx, "Could not write to cache", "key", key, "error", err)
+		}
+		return value, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return loaded.([]byte), nil
+}
+
+// Invalidate drops the values of the tenant of ctx tagged with any of tags.
+// Within Defer they are dropped when it is flushed. Failures are logged, as
+// the write that made the values stale is done by then.
+func Invalidate(ctx context.Context, tags ...string) {
+	if store == nil || len(tags) == 0 {
+		return
+	}
+	seen := make(map[string]bool, len(tags))
+	var scopedTags []string
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			scopedTags = append(scopedTags, scoped(ctx, tag))
+		}
+	}
+	if d := deferredFrom(ctx); d != nil {
+		d.mu.Lock()
+		d.tags = append(d.tags, scopedTags...)
+		d.mu.Unlock()
+		return
+	}
+	invalidate(ctx, scopedTags)
+}
+
+// Defer holds back the invalidations made with the returned context until
+// flush is called, for writes in a transaction, which must not be cached
+// over before it commits. Flush after the transaction, whether it committed
+// or not.
+func Defer(ctx context.Context) (context.Context, func()) {
+	d := &deferred{}
+	flush := func() {
+		d.mu.Lock()
+		tags := d.tags
+		d.tags = nil
+		d.mu.Unlock()
+		if store != nil && len(tags) > 0 {
+			invalidate(ctx, tags)
+		}
+	}
+	return context.WithValue(ctx, deferredKey{}, d), flush
+}
+
+// Ping checks that the store can be reached. Without a store there is
+// nothing to reach.
+func Ping(ctx context.Context) error {
+	if store == nil {
+		return nil
+	}
+	return store.Ping(ctx)
+}
+
+type deferredKey struct{}
+
+// deferred collects the invalidations held back by Defer
+type deferred struct {
+	mu   sync.Mutex
+	tags []string
+}
+
+func deferredFrom(ctx context.Context) *deferred {
+	d, _ := ctx.Value(deferredKey{}).(*deferred)
+	return d
+}
+
+func invalidate(ctx context.Context, tags []string) {
+	if err := store.Invalidate(ctx, tags...); err != nil {
+		slog.ErrorContext(ctx, "Could not invalidate cache", "tags", tags, "error", err)
+	}
+}
+
+// scoped prefixes a key or tag with the tenant of ctx, so that tenants never
+// see each other's values
+func scoped(ctx context.Context, s string) string {
+	tenantID, _ := tenancy.FromContext(ctx)
+	return fmt.Sprintf("t%d:%s", tenantID, s)
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	memory, err := NewMemoryStore(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return map[string]Store{
+		"memory": memory,
+		"redis":  NewRedisStore(client, "test:"),
+	}
+}
+
+// TestFetchInvalidatedWhileLoading doesn't store a value loaded before a
+// write that invalidated it
+func TestFetchInvalidatedWhileLoading(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			Use(s, time.Minute)
+			defer Use(nil, 0)
+			ctx := context.Background()
+
+			stale := func() ([]byte, []string, error) {
+				// The write commits and invalidates while the old row is
+				// being rendered
+				Invalidate(ctx, "books:1")
+				return []byte("old"), []string{"books:1"}, nil
+			}
+			if value, err := Fetch(ctx, "/books/1", stale); err != nil || string(value) != "old" {
+				t.Fatalf("Fetch = %q, %v", value, err)
+			}
+			if _, ok, _ := s.Get(ctx, scoped(ctx, "/books/1")); ok {
+				t.Fatal("value loaded before its invalidation was stored")
+			}
+
+			fresh := func() ([]byte, []string, error) {
+				return []byte("new"), []string{"books:1"}, nil
+			}
+			if value, _ := Fetch(ctx, "/books/1", fresh); string(value) != "new" {
+				t.Fatalf("Fetch = %q, want new", value)
+			}
+			if value, ok, _ := s.Get(ctx, scoped(ctx, "/books/1")); !ok || string(value) != "new" {
+				t.Fatalf("value loaded after the invalidation not stored: %q", value)
+			}
+
+			// Invalidating other tags doesn't keep values from being stored
+			other := func() ([]byte, []string, error) {
+				Invalidate(ctx, "authors:2")
+				return []byte("book 3"), []string{"books:3"}, nil
+			}
+			Fetch(ctx, "/books/3", other)
+			if _, ok, _ := s.Get(ctx, scoped(ctx, "/books/3")); !ok {
+				t.Error("value not stored after an unrelated invalidation")
+			}
+
+			Invalidate(ctx, "books:1")
+			if _, ok, _ := s.Get(ctx, scoped(ctx, "/books/1")); ok {
+				t.Error("value not dropped by its invalidation")
+			}
+		})
+	}
+}
+
+func TestMemoryStorePruned(t *testing.T) {
+	s, err := NewMemoryStore(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	s.Invalidate(ctx, "books:1")
+	generation, _ := s.Generation(ctx)
+
+	// Invalidations older than maxLoadTime are forgotten, so values loaded
+	// before them can't be told apart and are not stored
+	s.lastPrune = time.Now().Add(-2 * maxLoadTime)
+	s.invalidated["books:1"] = invalidation{generation: generation, at: s.lastPrune}
+	s.Invalidate(ctx, "authors:2")
+	if _, ok := s.invalidated["books:1"]; ok {
+		t.Fatal("old invalidation not pruned")
+	}
+
+	s.Set(ctx, "old", []byte("old"), []string{"books:9"}, time.Minute, generation-1)
+	if _, ok, _ := s.Get(ctx, "old"); ok {
+		t.Error("value loaded before a pruned invalidation stored")
+	}
+	s.Set(ctx, "new", []byte("new"), []string{"books:9"}, time.Minute, generation)
+	if _, ok, _ := s.Get(ctx, "new"); !ok {
+		t.Error("value loaded after the pruned invalidations not stored")
+	}
+}
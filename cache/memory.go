@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// MemoryStore keeps up to a number of values in process, evicting the least
+// recently used ones. Each instance of the API has its own, which only its
+// own writes invalidate.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries *lru.Cache[string, memoryEntry]
+	// tagged maps tags to the keys of the values tagged with them
+	tagged map[string]map[string]struct{}
+
+	generation uint64
+	// invalidated holds the last invalidation of the tags invalidated
+	// within maxLoadTime. Older ones are pruned, up to generation pruned.
+	invalidated map[string]invalidation
+	pruned      uint64
+	lastPrune   time.Time
+}
+
+type invalidation struct {
+	generation uint64
+	at         time.Time
+}
+
+type memoryEntry struct {
+	value   []byte
+	tags    []string
+	expires time.Time
+}
+
+// NewMemoryStore returns a store holding up to size values
+func NewMemoryStore(size int) (*MemoryStore, error) {
+	s := &MemoryStore{
+		tagged:      map[string]map[string]struct{}{},
+		invalidated: map[string]invalidation{},
+		lastPrune:   time.Now(),
+	}
+	entries, err := lru.NewWithEvict(size, s.untag)
+	if err != nil {
+		return nil, err
+	}
+	s.entries = entries
+	return s, nil
+}
+
+// Get implements Store
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if !time.Now().Before(entry.expires) {
+		s.entries.Remove(key)
+		return nil, false, nil
+	}
+	return entry.value, true, nil
+}
+
+// Generation implements Store
+func (s *MemoryStore) Generation(ctx context.Context) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generation, nil
+}
+
+// Set implements Store
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, tags []string, ttl time.Duration, generation uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Invalidations pruned since the value was loaded can't be checked
+	if generation < s.pruned {
+		return nil
+	}
+	for _, tag := range tags {
+		if s.invalidated[tag].generation > generation {
+			return nil
+		}
+	}
+
+	// Removing the old value first drops its tags, which may not be the
+	// new value's
+	s.entries.Remove(key)
+	s.entries.Add(key, memoryEntry{value: value, tags: tags, expires: time.Now().Add(ttl)})
+	for _, tag := range tags {
+		keys, ok := s.tagged[tag]
+		if !ok {
+			keys = map[string]struct{}{}
+			s.tagged[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	return nil
+}
+
+// Invalidate implements Store
+func (s *MemoryStore) Invalidate(ctx context.Context, tags ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+	s.generation++
+	for _, tag := range tags {
+		s.invalidated[tag] = invalidation{generation: s.generation, at: now}
+		for key := range s.tagged[tag] {
+			s.entries.Remove(key)
+		}
+	}
+	return nil
+}
+
+// Ping implements Store
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// prune forgets the invalidations older than maxLoadTime, which no value
+// being loaded can predate
+func (s *MemoryStore) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < maxLoadTime {
+		return
+	}
+	s.lastPrune = now
+	for tag, inv := range s.invalidated {
+		if now.Sub(inv.at) > maxLoadTime {
+			delete(s.invalidated, tag)
+			s.pruned = max(s.pruned, inv.generation)
+		}
+	}
+}
+
+// untag forgets the tags of a value leaving the cache. The cache calls it
+// from Add and Remove, with mu held.
+func (s *MemoryStore) untag(key string, entry memoryEntry) {
+	for _, tag := range entry.tags {
+		delete(s.tagged[tag], key)
+		if len(s.tagged[tag]) == 0 {
+			delete(s.tagged, tag)
+		}
+	}
+}
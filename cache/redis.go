@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// invalidateScript drops the values in the tag sets KEYS[2], KEYS[4]...,
+// and the sets, atomically so that no value is added to a set while it is
+// being dropped. It counts the invalidation in the generation KEYS[1] and
+// records it in the keys KEYS[3], KEYS[5]... of the tags for ARGV[1]
+// milliseconds, for setScript.
+var invalidateScript = redis.NewScript(`
+local generation = redis.call('INCR', KEYS[1])
+for t = 2, #KEYS, 2 do
+  local keys = redis.call('SMEMBERS', KEYS[t])
+  for i = 1, #keys, 1000 do
+    redis.call('DEL', unpack(keys, i, math.min(i + 999, #keys)))
+  end
+  redis.call('DEL', KEYS[t])
+  redis.call('SET', KEYS[t + 1], generation, 'PX', ARGV[1])
+end
+return generation
+`)
+
+// setScript stores the value ARGV[1] under KEYS[1] for ARGV[2]
+// milliseconds and adds it to the tag sets KEYS[2], KEYS[4]..., unless one
+// of the tags was invalidated after generation ARGV[3]
+var setScript = redis.NewScript(`
+for t = 2, #KEYS, 2 do
+  local invalidated = redis.call('GET', KEYS[t + 1])
+  if invalidated and tonumber(invalidated) > tonumber(ARGV[3]) then
+    return 0
+  end
+end
+if tonumber(ARGV[2]) > 0 then
+  redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+else
+  redis.call('SET', KEYS[1], ARGV[1])
+end
+for t = 2, #KEYS, 2 do
+  redis.call('SADD', KEYS[t], KEYS[1])
+  redis.call('PEXPIRE', KEYS[t], ARGV[2])
+end
+return 1
+`)
+
+// RedisStore keeps the values in Redis, or any server speaking its protocol
+// and running Lua scripts, so that all instances of the API share them and
+// each other's invalidations. Every tag is a set of the keys of its values.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore returns a store keeping the values and tags under keys
+// starting with prefix
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Get implements Store
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Generation implements Store
+func (s *RedisStore) Generation(ctx context.Context) (uint64, error) {
+	generation, err := s.client.Get(ctx, s.generationKey()).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return generation, err
+}
+
+// Set implements Store. Tag sets live as long as the last value added to
+// them, and so as long as any of their values.
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, tags []string, ttl time.Duration, generation uint64) error {
+	keys := append([]string{s.prefix + key}, s.tagKeys(tags)...)
+	return setScript.Run(ctx, s.client, keys, value, ttl.Milliseconds(), generation).Err()
+}
+
+// Invalidate implements Store
+func (s *RedisStore) Invalidate(ctx context.Context, tags ...string) error {
+	keys := append([]string{s.generationKey()}, s.tagKeys(tags)...)
+	return invalidateScript.Run(ctx, s.client, keys, maxLoadTime.Milliseconds()).Err()
+}
+
+// Ping implements Store
+func (s *RedisStore) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+// tagKeys returns the key of the set of each tag followed by the key of
+// the generation of its last invalidation
+func (s *RedisStore) tagKeys(tags []string) []string {
+	keys := make([]string, 0, 2*len(tags))
+	for _, tag := range tags {
+		keys = append(keys, s.prefix+"tag:"+tag, s.prefix+"gen:"+tag)
+	}
+	return keys
+}
+
+func (s *RedisStore) generationKey() string {
+	return s.prefix + "generation"
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"mentalartsapi/importer"
+	"mentalartsapi/models"
+	"mentalartsapi/tenancy"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+// runImport implements the import command, the CLI equivalent of
+// POST /api/v1/import:
+//
+//	api import -file books.csv [-format csv|ndjson|marc|marcxml] [-tenant slug] [-commit]
+func runImport(db *gorm.DB, defaultTenant string, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := flags.String("file", "", "CSV, NDJSON, MARC21 or MARCXML file to import, - for stdin")
+	format := flags.String("format", "", "csv, ndjson, marc or marcxml, detected from the file extension if omitted")
+	tenantSlug := flags.String("tenant", defaultTenant, "slug of the tenant to import into")
+	commit := flags.Bool("commit", false, "write the changes instead of doing a dry run")
+	batchSize := flags.Int("batch-size", importer.DefaultBatchSize, "rows written per transaction")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+
+	var input io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+
+	if *format == "" {
+		*format = string(importer.FormatFromFilename(*file))
+		if *format == "" {
+			return errors.New("could not detect the file format, pass -format")
+		}
+	}
+
+	var tenant models.Tenant
+	if err := db.Where("slug = ?", *tenantSlug).First(&tenant).Error; err != nil {
+		return fmt.Errorf("tenant %q not found", *tenantSlug)
+	}
+
+	ctx := tenancy.WithTenant(context.Background(), uint(tenant.ID))
+	report, err := importer.Import(ctx, db, input, importer.Format(*format), importer.Options{
+		DryRun:    !*commit,
+		BatchSize: *batchSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,28 @@
+// Command openapi writes the OpenAPI 3.1 spec of the REST API generated
+// from the handler annotations. It is run by go generate ./docs.
+package main
+
+import (
+	"flag"
+	"log"
+	"mentalartsapi/openapi"
+	"os"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "module root")
+	out := flag.String("o", "docs/openapi.json", "output file")
+	flag.Parse()
+
+	doc, err := openapi.Generate(*dir)
+	if err != nil {
+		log.Fatalf("Could not generate OpenAPI spec: %v", err)
+	}
+	data, err := openapi.Marshal(doc)
+	if err != nil {
+		log.Fatalf("Could not encode OpenAPI spec: %v", err)
+	}
+	if err := os.WriteFile(*out, data, 0o644); err != nil {
+		log.Fatalf("Could not write OpenAPI spec: %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+// Package config loads the settings of the API from, in increasing order of
+// precedence, defaults, a YAML or TOML file, environment variables and
+// command line flags.
+//
+// Every setting has a file key under its section, e.g. database.password,
+// an environment variable, e.g. DB_PASSWORD, and a flag named after the
+// variable, e.g. -db-password. Secrets can also be read from the file named
+// by the variable with a _FILE suffix, e.g. DB_PASSWORD_FILE.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mentalartsapi/ratelimit"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InsecureDBPassword is the default database password, only fit for local
+// development
+const InsecureDBPassword = "123abcd"
+
+// minSecretLength is the shortest admin token accepted in release mode
+const minSecretLength = 16
+
+// redacted replaces the secrets in a dump
+const redacted = "[REDACTED]"
+
+// Config holds every setting of the API
+type Config struct {
+	Database    Database    `yaml:"database"`
+	Server      Server      `yaml:"server"`
+	GRPC        GRPC        `yaml:"grpc"`
+	Logging     Logging     `yaml:"logging"`
+	Tenancy     Tenancy     `yaml:"tenancy"`
+	Idempotency Idempotency `yaml:"idempotency"`
+	Covers      Covers      `yaml:"covers"`
+	S3          S3          `yaml:"s3"`
+	PublicIDs   PublicIDs   `yaml:"public_ids"`
+	RateLimit   RateLimit   `yaml:"rate_limit"`
+	Cache       Cache       `yaml:"cache"`
+}
+
+// Database configures the PostgreSQL connection and its pool
+type Database struct {
+	Host               string        `yaml:"host" env:"DB_HOST" default:"localhost"`
+	Port               int           `yaml:"port" env:"DB_PORT" default:"5432"`
+	User               string        `yaml:"user" env:"DB_USER" default:"postgres"`
+	Password           string        `yaml:"password" env:"DB_PASSWORD" default:"123abcd" secret:"true"`
+	Name               string        `yaml:"name" env:"DB_NAME" default:"postgres"`
+	SSLMode            string        `yaml:"sslmode" env:"DB_SSLMODE" default:"disable"`
+	MaxOpenConns       int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"25"`
+	MaxIdleConns       int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"10"`
+	ConnMaxLifetime    time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m"`
+	ConnMaxIdleTime    time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" env:"DB_SLOW_QUERY_THRESHOLD" default:"200ms"`
+}
+
+// DSN returns the connection string of the database
+func (d Database) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+		d.Host, d.User, d.Password, d.Name, d.Port, d.SSLMode)
+}
+
+// Server configures the HTTP server
+type Server struct {
+	Mode              string        `yaml:"mode" env:"GIN_MODE" default:"debug"`
+	Port              int           `yaml:"port" env:"API_PORT" default:"8000"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" default:"5s"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT" default:"30s"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" default:"60s"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" default:"120s"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES" default:"1048576"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" default:"30s"`
+	// TrustedProxies lists, comma separated, the IPs and CIDRs of the proxies
+	// whose X-Forwarded-For header gives the client IP. By default no proxy
+	// is trusted and the client IP is the peer's.
+	TrustedProxies string `yaml:"trusted_proxies" env:"HTTP_TRUSTED_PROXIES"`
+}
+
+// Proxies returns the trusted proxies as a list
+func (s Server) Proxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(s.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// GRPC configures the gRPC server and its JSON gateway, which is off when
+// its port is 0
+type GRPC struct {
+	Port        int `yaml:"port" env:"GRPC_PORT" default:"9090"`
+	GatewayPort int `yaml:"gateway_port" env:"GRPC_GATEWAY_PORT" default:"0"`
+}
+
+// Logging configures the logs
+type Logging struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" default:"info"`
+}
+
+// Tenancy configures how requests are assigned to tenants
+type Tenancy struct {
+	DefaultTenant string `yaml:"default_tenant" env:"DEFAULT_TENANT" default:"default"`
+	BaseDomain    string `yaml:"base_domain" env:"TENANT_BASE_DOMAIN"`
+	JWTSecret     string `yaml:"jwt_secret" env:"TENANT_JWT_SECRET" secret:"true"`
+	TrustHeaders  bool   `yaml:"trust_headers" env:"TENANT_TRUST_HEADERS"`
+	AdminToken    string `yaml:"admin_token" env:"TENANT_ADMIN_TOKEN" secret:"true"`
+}
+
+// Idempotency configures how long Idempotency-Key responses are kept, and
+// how large the requests sent with a key may be
+type Idempotency struct {
+	TTL          time.Duration `yaml:"ttl" env:"IDEMPOTENCY_TTL" default:"24h"`
+	MaxBodyBytes int64         `yaml:"max_body_bytes" env:"IDEMPOTENCY_MAX_BODY_BYTES" default:"10485760"`
+}
+
+// Covers configures the storage of cover images
+type Covers struct {
+	Storage  string `yaml:"storage" env:"COVER_STORAGE" default:"local"`
+	Dir      string `yaml:"dir" env:"COVER_DIR" default:"./media"`
+	BaseURL  string `yaml:"base_url" env:"COVER_BASE_URL" default:"/media"`
+	MaxBytes int64  `yaml:"max_bytes" env:"COVER_MAX_BYTES" default:"5242880"`
+}
+
+// S3 configures the S3-compatible cover storage
+type S3 struct {
+	Endpoint  string `yaml:"endpoint" env:"S3_ENDPOINT"`
+	Bucket    string `yaml:"bucket" env:"S3_BUCKET"`
+	Region    string `yaml:"region" env:"S3_REGION" default:"us-east-1"`
+	AccessKey string `yaml:"access_key" env:"S3_ACCESS_KEY" secret:"true"`
+	SecretKey string `yaml:"secret_key" env:"S3_SECRET_KEY" secret:"true"`
+	PublicURL string `yaml:"public_url" env:"S3_PUBLIC_URL"`
+}
+
+// PublicIDs configures how IDs are exposed: as numbers, or as hashids when
+// the mode is hashids
+type PublicIDs struct {
+	Mode      string `yaml:"mode" env:"PUBLIC_IDS"`
+	Salt      string `yaml:"salt" env:"PUBLIC_ID_SALT" secret:"true"`
+	MinLength int    `yaml:"min_length" env:"PUBLIC_ID_MIN_LENGTH" default:"10"`
+}
+
+// RateLimit configures how often clients may call the API, per route
+// group. The buckets are kept in memory, or in Redis to share them between
+// instances; off turns rate limiting off.
+type RateLimit struct {
+	Store    string          `yaml:"store" env:"RATE_LIMIT_STORE" default:"memory"`
+	RedisURL string          `yaml:"redis_url" env:"RATE_LIMIT_REDIS_URL" secret:"true"`
+	Reads    ratelimit.Limit `yaml:"reads" env:"RATE_LIMIT_READS" default:"300/1m"`
+	Writes   ratelimit.Limit `yaml:"writes" env:"RATE_LIMIT_WRITES" default:"60/1m"`
+	Exports  ratelimit.Limit `yaml:"exports" env:"RATE_LIMIT_EXPORTS" default:"10/1m"`
+	GraphQL  ratelimit.Limit `yaml:"graphql" env:"RATE_LIMIT_GRAPHQL" default:"120/1m"`
+}
+
+// Cache configures the cache of hot read responses. It is kept in memory,
+// holding up to Size responses, or in Redis to share it and its
+// invalidations between instances; off turns it off.
+type Cache struct {
+	Store    string        `yaml:"store" env:"CACHE_STORE" default:"memory"`
+	RedisURL string        `yaml:"redis_url" env:"CACHE_REDIS_URL" secret:"true"`
+	TTL      time.Duration `yaml:"ttl" env:"CACHE_TTL" default:"1m"`
+	Size     int           `yaml:"size" env:"CACHE_SIZE" default:"10000"`
+}
+
+// Release reports whether the API runs in release mode
+func (c *Config) Release() bool {
+	return c.Server.Mode == "release"
+}
+
+// Validate reports every invalid setting. In release mode it also refuses
+// the insecure defaults meant for local development.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(oneOf(c.Server.Mode, "debug", "release", "test"), "GIN_MODE must be debug, release or test")
+	check(validPort(c.Server.Port), "API_PORT must be between 1 and 65535")
+	check(validPort(c.GRPC.Port), "GRPC_PORT must be between 1 and 65535")
+	check(c.GRPC.GatewayPort == 0 || validPort(c.GRPC.GatewayPort), "GRPC_GATEWAY_PORT must be between 1 and 65535, or 0 to turn the gateway off")
+	check(validPort(c.Database.Port), "DB_PORT must be between 1 and 65535")
+	check(oneOf(c.Database.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full"),
+		"DB_SSLMODE must be disable, allow, prefer, require, verify-ca or verify-full")
+	check(c.Database.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS must not be negative")
+	check(c.Database.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "DB_CONN_MAX_IDLE_TIME must not be negative")
+	check(c.Database.SlowQueryThreshold >= 0, "DB_SLOW_QUERY_THRESHOLD must not be negative")
+	check(c.Server.ReadHeaderTimeout >= 0 && c.Server.ReadTimeout >= 0 && c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0,
+		"HTTP timeouts must not be negative")
+	check(c.Server.MaxHeaderBytes > 0, "HTTP_MAX_HEADER_BYTES must be positive")
+	check(c.Server.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+	for _, proxy := range c.Server.Proxies() {
+		check(validProxy(proxy), "HTTP_TRUSTED_PROXIES: %q is not an IP or CIDR", proxy)
+	}
+	check(c.Idempotency.TTL > 0, "IDEMPOTENCY_TTL must be positive")
+	check(c.Idempotency.MaxBodyBytes > 0, "IDEMPOTENCY_MAX_BODY_BYTES must be positive")
+	check(c.Tenancy.DefaultTenant != "", "DEFAULT_TENANT must not be empty")
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Logging.Level)) == nil, "LOG_LEVEL must be debug, info, warn or error")
+	check(oneOf(c.Covers.Storage, "local", "s3"), "COVER_STORAGE must be local or s3")
+	check(c.Covers.MaxBytes > 0, "COVER_MAX_BYTES must be positive")
+	check(c.Covers.Storage != "s3" || c.S3.Bucket != "", "S3_BUCKET is required when COVER_STORAGE is s3")
+	check(oneOf(c.PublicIDs.Mode, "", "hashids"), "PUBLIC_IDS must be empty or hashids")
+	check(c.PublicIDs.Mode != "hashids" || c.PublicIDs.Salt != "", "PUBLIC_ID_SALT is required when PUBLIC_IDS is hashids")
+	check(c.PublicIDs.MinLength >= 0, "PUBLIC_ID_MIN_LENGTH must not be negative")
+	check(oneOf(c.RateLimit.Store, "memory", "redis", "off"), "RATE_LIMIT_STORE must be memory, redis or off")
+	check(c.RateLimit.Store != "redis" || c.RateLimit.RedisURL != "", "RATE_LIMIT_REDIS_URL is required when RATE_LIMIT_STORE is redis")
+	check(oneOf(c.Cache.Store, "memory", "redis", "off"), "CACHE_STORE must be memory, redis or off")
+	check(c.Cache.Store != "redis" || c.Cache.RedisURL != "", "CACHE_REDIS_URL is required when CACHE_STORE is redis")
+	check(c.Cache.TTL > 0, "CACHE_TTL must be positive")
+	check(c.Cache.Size > 0, "CACHE_SIZE must be positive")
+
+	if c.Release() {
+		check(c.Database.Password != "" && c.Database.Password != InsecureDBPassword,
+			"DB_PASSWORD must be set to a password of your own in release mode")
+		check(c.Tenancy.AdminToken == "" || len(c.Tenancy.AdminToken) >= minSecretLength,
+			"TENANT_ADMIN_TOKEN must be at least %d characters in release mode", minSecretLength)
+		check(c.Tenancy.JWTSecret == "" || len(c.Tenancy.JWTSecret) >= minSecretLength,
+			"TENANT_JWT_SECRET must be at least %d characters in release mode", minSecretLength)
+	}
+	return errors.Join(errs...)
+}
+
+// Dump writes the effective configuration as YAML, with the secrets that
+// are set redacted
+func (c *Config) Dump(w io.Writer) error {
+	copied := *c
+	forEachSetting(&copied, func(setting setting) error {
+		if setting.secret && !setting.value.IsZero() {
+			setting.value.SetString(redacted)
+		}
+		return nil
+	})
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&copied); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+	return false
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+func validProxy(proxy string) bool {
+	if _, _, err := net.ParseCIDR(proxy); err == nil {
+		return true
+	}
+	return net.ParseIP(proxy) != nil
+}
+
+// setting is a field of a section of the configuration
+type setting struct {
+	section string
+	key     string
+	env     string
+	def     string
+	secret  bool
+	value   reflect.Value
+}
+
+// flag returns the name of the command line flag of the setting
+func (s setting) flag() string {
+	return strings.ToLower(strings.ReplaceAll(s.env, "_", "-"))
+}
+
+// forEachSetting calls fn with every setting of cfg, stopping at the first
+// error
+func forEachSetting(cfg *Config, fn func(setting) error) error {
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		sectionField := sections.Type().Field(i)
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			field := section.Type().Field(j)
+			err := fn(setting{
+				section: sectionField.Tag.Get("yaml"),
+				key:     field.Tag.Get("yaml"),
+				env:     field.Tag.Get("env"),
+				def:     field.Tag.Get("default"),
+				secret:  field.Tag.Get("secret") == "true",
+				value:   section.Field(j),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
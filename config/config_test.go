@@ -0,0 +1,141 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	t.Setenv(FileEnv, "")
+	file := writeFile(t, "api.yaml", "server:\n  port: 8100\n  write_timeout: 5m\ndatabase:\n  host: db.internal\n  name: library\n")
+	t.Setenv("API_PORT", "8200")
+	t.Setenv("DB_NAME", "")
+
+	cfg, args, err := Load([]string{"-config", file, "-db-host", "db.example.com", "migrate", "-dry-run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 8200 {
+		t.Errorf("port = %d, want the environment's 8200", cfg.Server.Port)
+	}
+	if cfg.Database.Host != "db.example.com" {
+		t.Errorf("host = %s, want the flag's", cfg.Database.Host)
+	}
+	if cfg.Database.Name != "library" || cfg.Server.WriteTimeout != 5*time.Minute {
+		t.Errorf("name = %s, write timeout = %s, want the file's", cfg.Database.Name, cfg.Server.WriteTimeout)
+	}
+	if cfg.Database.Port != 5432 || cfg.Cache.TTL <= 0 {
+		t.Errorf("port = %d, cache TTL = %s, want the defaults", cfg.Database.Port, cfg.Cache.TTL)
+	}
+	if strings.Join(args, " ") != "migrate -dry-run" {
+		t.Errorf("args = %v, want the command and its flags", args)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	t.Setenv(FileEnv, "")
+	tests := []struct {
+		name    string
+		file    string
+		data    string
+		wantErr string
+	}{
+		{name: "toml", file: "api.toml", data: "[tenancy]\ntrust_headers = true\n"},
+		{name: "unknown key", file: "api.yaml", data: "server:\n  prot: 8100\n", wantErr: "unknown setting server.prot"},
+		{name: "not a section", file: "api.yaml", data: "server: 8100\n", wantErr: "server must be a section"},
+		{name: "list", file: "api.yaml", data: "server:\n  trusted_proxies: [10.0.0.1]\n", wantErr: "server.trusted_proxies must be a single value"},
+		{name: "wrong type", file: "api.yaml", data: "server:\n  port: eighty\n", wantErr: `server.port: "eighty" is not an integer`},
+		{name: "extension", file: "api.json", data: "{}", wantErr: `unknown configuration file extension ".json"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, _, err := Load([]string{"-config", writeFile(t, tt.file, tt.data)})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cfg.Tenancy.TrustHeaders {
+				t.Error("trust_headers not read from the file")
+			}
+		})
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	t.Setenv(FileEnv, "")
+	t.Setenv("DB_PASSWORD", "")
+	t.Setenv("DB_PASSWORD_FILE", writeFile(t, "password", "s3cret-from-file\n"))
+	cfg, _, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.Password != "s3cret-from-file" {
+		t.Errorf("password = %q, want the file's without its newline", cfg.Database.Password)
+	}
+
+	t.Setenv("DB_PASSWORD", "s3cret")
+	if _, _, err := Load(nil); err == nil || err.Error() != "set DB_PASSWORD or DB_PASSWORD_FILE, not both" {
+		t.Errorf("error = %v, want both sources refused", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Setenv(FileEnv, "")
+	t.Setenv("DB_PASSWORD", "")
+	_, _, err := Load([]string{"-gin-mode", "release", "-api-port", "0", "-tenant-admin-token", "short", "-cache-store", "redis"})
+	if err == nil {
+		t.Fatal("invalid settings accepted")
+	}
+	for _, want := range []string{
+		"API_PORT must be between 1 and 65535",
+		"CACHE_REDIS_URL is required when CACHE_STORE is redis",
+		"DB_PASSWORD must be set to a password of your own in release mode",
+		"TENANT_ADMIN_TOKEN must be at least 16 characters in release mode",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error = %v, want it to report %q", err, want)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	t.Setenv(FileEnv, "")
+	t.Setenv("TENANT_JWT_SECRET", "")
+	cfg, _, err := Load([]string{"-db-password", "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := cfg.Dump(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dump := buf.String()
+	if strings.Contains(dump, "s3cret") || !strings.Contains(dump, "password: '"+redacted+"'") {
+		t.Errorf("dump doesn't redact the password:\n%s", dump)
+	}
+	// Secrets that aren't set are left empty, showing that they aren't
+	if !strings.Contains(dump, `jwt_secret: ""`) {
+		t.Errorf("dump redacts an empty secret:\n%s", dump)
+	}
+	if cfg.Database.Password != "s3cret" {
+		t.Error("Dump changed the configuration")
+	}
+}
@@ -0,0 +1,184 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the configuration file when the -config flag is not given
+const FileEnv = "CONFIG_FILE"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Load reads the configuration from its sources and validates it. args are
+// the command line arguments without the program name; those left after
+// the flags, such as a command, are returned.
+func Load(args []string) (*Config, []string, error) {
+	cfg := &Config{}
+	settings := map[string]setting{}
+	forEachSetting(cfg, func(s setting) error {
+		settings[s.flag()] = s
+		return nil
+	})
+
+	flags := flag.NewFlagSet("api", flag.ContinueOnError)
+	file := flags.String("config", os.Getenv(FileEnv), "YAML or TOML configuration file")
+	for name, s := range settings {
+		flags.String(name, "", "overrides "+s.env)
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	err := forEachSetting(cfg, func(s setting) error {
+		if s.def == "" {
+			return nil
+		}
+		return set(s, s.def, "default of "+s.env)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if *file != "" {
+		if err := loadFile(cfg, *file); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := loadEnv(cfg); err != nil {
+		return nil, nil, err
+	}
+
+	var errs []error
+	flags.Visit(func(f *flag.Flag) {
+		if s, ok := settings[f.Name]; ok {
+			errs = append(errs, set(s, f.Value.String(), "-"+f.Name))
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return nil, nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, flags.Args(), nil
+}
+
+// loadFile applies the settings of a YAML or TOML file, chosen by its
+// extension. Sections and keys that are not settings are errors, so that
+// typos don't go unnoticed.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var tree map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return fmt.Errorf("%s: unknown configuration file extension %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	settings := map[string]setting{}
+	forEachSetting(cfg, func(s setting) error {
+		settings[s.section+"."+s.key] = s
+		return nil
+	})
+	for section, values := range tree {
+		keys, ok := values.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %s must be a section", path, section)
+		}
+		for key, value := range keys {
+			name := section + "." + key
+			s, ok := settings[name]
+			if !ok {
+				return fmt.Errorf("%s: unknown setting %s", path, name)
+			}
+			switch value.(type) {
+			case map[string]interface{}, []interface{}, nil:
+				return fmt.Errorf("%s: %s must be a single value", path, name)
+			}
+			if err := set(s, fmt.Sprint(value), path+": "+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loadEnv applies the environment variables that are set and not empty.
+// A variable with a _FILE suffix names a file holding the value, e.g. a
+// Docker or Kubernetes secret.
+func loadEnv(cfg *Config) error {
+	return forEachSetting(cfg, func(s setting) error {
+		value := os.Getenv(s.env)
+		if path := os.Getenv(s.env + "_FILE"); path != "" {
+			if value != "" {
+				return fmt.Errorf("set %s or %s_FILE, not both", s.env, s.env)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("%s_FILE: %w", s.env, err)
+			}
+			value = strings.TrimRight(string(data), "\r\n")
+		}
+		if value == "" {
+			return nil
+		}
+		return set(s, value, s.env)
+	})
+}
+
+// set parses raw into the setting. source names where raw came from in
+// errors.
+func set(s setting, raw string, source string) error {
+	if unmarshaler, ok := s.value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := unmarshaler.UnmarshalText([]byte(raw)); err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		return nil
+	}
+	switch {
+	case s.value.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration, e.g. 30s or 5m", source, raw)
+		}
+		s.value.SetInt(int64(d))
+	case s.value.Kind() == reflect.String:
+		s.value.SetString(raw)
+	case s.value.Kind() == reflect.Int || s.value.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", source, raw)
+		}
+		s.value.SetInt(n)
+	case s.value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not true or false", source, raw)
+		}
+		s.value.SetBool(b)
+	default:
+		return fmt.Errorf("%s: unsupported setting type %s", source, s.value.Type())
+	}
+	return nil
+}
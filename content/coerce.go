@@ -0,0 +1,186 @@
+package content
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// coerce converts a decoded value so that it unmarshals from JSON into the
+// target type. XML carries only text, and YAML and MessagePack may type a
+// scalar differently from the field it is meant for, e.g. an ISBN written as
+// a number.
+func coerce(value interface{}, target reflect.Type) (interface{}, error) {
+	if value == nil || target == nil {
+		return value, nil
+	}
+	for target.Kind() == reflect.Pointer {
+		target = target.Elem()
+	}
+
+	// Types with their own unmarshalers, such as time.Time, take the value
+	// as it is
+	if reflect.PointerTo(target).Implements(jsonUnmarshalerType) || reflect.PointerTo(target).Implements(textUnmarshalerType) {
+		if t, ok := value.(time.Time); ok {
+			return t.Format(time.RFC3339Nano), nil
+		}
+		return value, nil
+	}
+
+	switch target.Kind() {
+	case reflect.Struct:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return value, nil
+		}
+		fields := jsonFields(target)
+		for key, item := range object {
+			if field, ok := fields[key]; ok {
+				converted, err := coerce(item, field)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", key, err)
+				}
+				object[key] = converted
+			}
+		}
+		return object, nil
+	case reflect.Map:
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return value, nil
+		}
+		for key, item := range object {
+			converted, err := coerce(item, target.Elem())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			object[key] = converted
+		}
+		return object, nil
+	case reflect.Slice, reflect.Array:
+		if target.Elem().Kind() == reflect.Uint8 {
+			return value, nil
+		}
+		var list []interface{}
+		switch v := value.(type) {
+		case []interface{}:
+			list = v
+		case map[string]interface{}:
+			// An XML list is an element of <item> children
+			if items, ok := v[xmlItem]; ok && len(v) == 1 {
+				if l, ok := items.([]interface{}); ok {
+					list = l
+				} else {
+					list = []interface{}{items}
+				}
+			} else {
+				list = []interface{}{v}
+			}
+		case string:
+			if strings.TrimSpace(v) != "" {
+				list = []interface{}{v}
+			}
+		default:
+			list = []interface{}{v}
+		}
+		for i, item := range list {
+			converted, err := coerce(item, target.Elem())
+			if err != nil {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		if list == nil {
+			list = []interface{}{}
+		}
+		return list, nil
+	case reflect.String:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case time.Time:
+			return v.Format(time.RFC3339Nano), nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case float32:
+			return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+		case map[string]interface{}, []interface{}:
+			return value, nil
+		}
+		return fmt.Sprint(value), nil
+	case reflect.Bool:
+		if s, ok := value.(string); ok {
+			switch strings.TrimSpace(s) {
+			case "":
+				return nil, nil
+			case "true", "1":
+				return true, nil
+			case "false", "0":
+				return false, nil
+			}
+			return nil, fmt.Errorf("invalid boolean %q", s)
+		}
+		return value, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if s, ok := value.(string); ok {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				return nil, nil
+			}
+			if !json.Valid([]byte(s)) {
+				return nil, fmt.Errorf("invalid number %q", s)
+			}
+			return json.Number(s), nil
+		}
+		return value, nil
+	}
+	return value, nil
+}
+
+// jsonFields maps the JSON names of a struct's fields to their types,
+// including the fields of embedded structs
+func jsonFields(target reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for embeddedName, embeddedType := range jsonFields(embedded) {
+					if _, ok := fields[embeddedName]; !ok {
+						fields[embeddedName] = embeddedType
+					}
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
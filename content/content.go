@@ -0,0 +1,223 @@
+// Package content converts API payloads between JSON and the other
+// representations the API speaks: XML, YAML and MessagePack.
+//
+// JSON stays the canonical form. Other formats are produced from, and decoded
+// into, the same JSON document so that field names, omitted fields and custom
+// marshalers behave identically whatever the client asked for.
+package content
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/ugorji/go/codec"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a payload representation
+type Format string
+
+const (
+	JSON    Format = "json"
+	XML     Format = "xml"
+	YAML    Format = "yaml"
+	MsgPack Format = "msgpack"
+)
+
+// ErrUnsupportedMediaType is returned for request bodies in a format the API
+// can't read
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// MediaTypes are the media types the API reads and writes, in order of
+// preference when a client accepts several equally
+var MediaTypes = []string{
+	"application/json",
+	"application/xml",
+	"text/xml",
+	"application/yaml",
+	"application/x-yaml",
+	"text/yaml",
+	"application/msgpack",
+	"application/x-msgpack",
+	"application/vnd.msgpack",
+}
+
+// FormatFromMediaType returns the format of a media type without parameters
+func FormatFromMediaType(mediaType string) (Format, bool) {
+	switch mediaType {
+	case "application/json":
+		return JSON, true
+	case "application/xml", "text/xml":
+		return XML, true
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		return YAML, true
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		return MsgPack, true
+	}
+	return "", false
+}
+
+// Marshal encodes v in the given format
+func Marshal(format Format, v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case JSON:
+		return data, nil
+	case XML:
+		return jsonToXML(data)
+	case YAML:
+		return jsonToYAML(data)
+	case MsgPack:
+		return jsonToMsgPack(data)
+	}
+	return nil, fmt.Errorf("content: unknown format %q", format)
+}
+
+// ToJSON re-encodes a payload in the given format as JSON. The target type
+// guides the conversion of untyped values such as XML text, so that
+// "<author_id>3</author_id>" becomes a number when the field is numeric.
+func ToJSON(format Format, data []byte, target interface{}) ([]byte, error) {
+	var value interface{}
+	switch format {
+	case JSON:
+		return data, nil
+	case XML:
+		tree, err := xmlToTree(data)
+		if err != nil {
+			return nil, err
+		}
+		value = tree
+	case YAML:
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, err
+		}
+		value = yamlToTree(&node)
+	case MsgPack:
+		if err := codec.NewDecoderBytes(data, msgpackHandle()).Decode(&value); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("content: unknown format %q", format)
+	}
+
+	value, err := coerce(value, reflect.TypeOf(target))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func jsonToYAML(data []byte) ([]byte, error) {
+	// YAML is a superset of JSON, so the document parses as is. Resetting
+	// the flow and quoting styles turns it into block YAML while keeping the
+	// field order.
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	resetYAMLStyle(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlToTree reads a YAML document keeping scalars as written, so that the
+// target type rather than YAML's implicit typing decides what "0441478123"
+// or "no" mean
+func yamlToTree(node *yaml.Node) interface{} {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return yamlToTree(node.Content[0])
+	case yaml.MappingNode:
+		object := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			object[node.Content[i].Value] = yamlToTree(node.Content[i+1])
+		}
+		return object
+	case yaml.SequenceNode:
+		list := make([]interface{}, 0, len(node.Content))
+		for _, child := range node.Content {
+			list = append(list, yamlToTree(child))
+		}
+		return list
+	case yaml.AliasNode:
+		return yamlToTree(node.Alias)
+	}
+	if node.ShortTag() == "!!null" {
+		return nil
+	}
+	return node.Value
+}
+
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
+
+func jsonToMsgPack(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	if err := codec.NewEncoderBytes(&out, msgpackHandle()).Encode(typedNumbers(value)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// typedNumbers replaces JSON numbers with integers where they fit, so that
+// MessagePack gets its compact integer encodings
+func typedNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = typedNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = typedNumbers(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	}
+	return value
+}
+
+func msgpackHandle() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{}
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	handle.RawToString = true
+	handle.WriteExt = true
+	return handle
+}
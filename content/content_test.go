@@ -0,0 +1,116 @@
+package content
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: "application/json"},
+		{accept: "*/*", want: "application/json"},
+		{accept: "application/xml", want: "application/xml"},
+		{accept: "application/json;q=0.5, application/yaml", want: "application/yaml"},
+		{accept: "text/*", want: "text/xml"},
+		{accept: "text/*;q=0.9, text/yaml", want: "text/yaml"},
+		{accept: "*/*;q=0.1, application/json;q=0", want: "application/xml"},
+		{accept: "APPLICATION/MSGPACK", want: "application/msgpack"},
+		{accept: "text/html", want: ""},
+	}
+	for _, tt := range tests {
+		if got := NegotiateMediaType(tt.accept, MediaTypes); got != tt.want {
+			t.Errorf("NegotiateMediaType(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+type book struct {
+	Title    string   `json:"title"`
+	AuthorID int      `json:"author_id"`
+	Rating   float64  `json:"rating"`
+	Tags     []string `json:"tags"`
+	Draft    bool     `json:"draft"`
+}
+
+// TestRoundTrip decodes each format into the JSON it was made from, with
+// the types of the target's fields
+func TestRoundTrip(t *testing.T) {
+	want := book{Title: "Kindred & Dawn", AuthorID: 3, Rating: 4.5, Tags: []string{"sf", "classic"}, Draft: true}
+	for _, format := range []Format{JSON, XML, YAML, MsgPack} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := Marshal(format, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			converted, err := ToJSON(format, data, &book{})
+			if err != nil {
+				t.Fatalf("ToJSON(%s): %v", data, err)
+			}
+			var got book
+			if err := json.Unmarshal(converted, &got); err != nil {
+				t.Fatalf("decoding %s: %v", converted, err)
+			}
+			if got.Title != want.Title || got.AuthorID != want.AuthorID || got.Rating != want.Rating ||
+				strings.Join(got.Tags, ",") != "sf,classic" || got.Draft != want.Draft {
+				t.Errorf("round trip = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRenderAndBind(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", func(c *gin.Context) {
+		var b book
+		if err := Bind(c, &b); err != nil {
+			Render(c, BindStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		Render(c, http.StatusOK, b)
+	})
+
+	tests := []struct {
+		name        string
+		contentType string
+		accept      string
+		body        string
+		wantStatus  int
+		wantType    string
+		wantBody    string
+	}{
+		{name: "xml", contentType: "application/xml", accept: "application/yaml", body: "<book><title>Kindred</title><author_id>3</author_id></book>", wantStatus: http.StatusOK, wantType: "application/yaml; charset=utf-8", wantBody: "author_id: 3"},
+		{name: "no content type", body: `{"title": "Kindred"}`, wantStatus: http.StatusOK, wantType: "application/json; charset=utf-8", wantBody: `"title":"Kindred"`},
+		{name: "unsupported", contentType: "text/csv", body: "title\nKindred", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "malformed", contentType: "application/xml", body: "<book>", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantType != "" && w.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", w.Header().Get("Content-Type"), tt.wantType)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body, tt.wantBody)
+			}
+		})
+	}
+}
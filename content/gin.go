@@ -0,0 +1,109 @@
+package content
+
+import (
+	"bytes"
+	"io"
+	"mentalartsapi/logging"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const mediaTypeContextKey = "content.media_type"
+
+// Negotiate picks the response media type for the request from its Accept
+// header and remembers it for Render. It reports false when the client
+// accepts none of the supported types.
+func Negotiate(c *gin.Context) bool {
+	mediaType := NegotiateMediaType(c.GetHeader("Accept"), MediaTypes)
+	if mediaType == "" {
+		return false
+	}
+	c.Set(mediaTypeContextKey, mediaType)
+	return true
+}
+
+// ResponseMediaType returns the media type responses to the request are
+// written in, falling back to JSON when the client accepts nothing supported
+func ResponseMediaType(c *gin.Context) string {
+	if mediaType := c.GetString(mediaTypeContextKey); mediaType != "" {
+		return mediaType
+	}
+	if mediaType := NegotiateMediaType(c.GetHeader("Accept"), MediaTypes); mediaType != "" {
+		return mediaType
+	}
+	return MediaTypes[0]
+}
+
+// requestIDCarrier is implemented by error responses, which Render gives
+// the ID of the request
+type requestIDCarrier interface {
+	WithRequestID(id string) interface{}
+}
+
+// Render writes obj in the format negotiated for the request. It is the
+// negotiating counterpart of c.JSON.
+func Render(c *gin.Context, status int, obj interface{}) {
+	if carrier, ok := obj.(requestIDCarrier); ok {
+		if id := logging.RequestID(c.Request.Context()); id != "" {
+			obj = carrier.WithRequestID(id)
+		}
+	}
+
+	mediaType := ResponseMediaType(c)
+	format, _ := FormatFromMediaType(mediaType)
+	if format == JSON {
+		c.JSON(status, obj)
+		return
+	}
+
+	data, err := Marshal(format, obj)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if format != MsgPack {
+		mediaType += "; charset=utf-8"
+	}
+	c.Data(status, mediaType, data)
+}
+
+// Bind decodes the request body according to its Content-Type into obj and
+// validates it like c.ShouldBindJSON does. A body without a Content-Type is
+// read as JSON; ErrUnsupportedMediaType is returned for types the API can't
+// read.
+func Bind(c *gin.Context, obj interface{}) error {
+	format := JSON
+	if contentType := c.ContentType(); contentType != "" {
+		var ok bool
+		if format, ok = FormatFromMediaType(strings.ToLower(contentType)); !ok {
+			return ErrUnsupportedMediaType
+		}
+	}
+
+	if c.Request.Body == nil {
+		return binding.JSON.Bind(c.Request, obj)
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	if format != JSON {
+		if body, err = ToJSON(format, body, obj); err != nil {
+			return err
+		}
+	}
+	return binding.JSON.BindBody(body, obj)
+}
+
+// BindStatus returns the status code for an error returned by Bind
+func BindStatus(err error) int {
+	if err == ErrUnsupportedMediaType {
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
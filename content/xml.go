@@ -0,0 +1,187 @@
+package content
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// xmlRoot is the element wrapping every XML document
+	xmlRoot = "response"
+	// xmlItem is the element of each value in a list
+	xmlItem = "item"
+	// xmlEntry is used for object keys that aren't valid element names; the
+	// key is kept in its key attribute
+	xmlEntry = "entry"
+)
+
+// jsonToXML writes a JSON document as XML. Objects become elements named
+// after their keys, list values become <item> elements and null values are
+// left out.
+func jsonToXML(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := writeXMLValue(encoder, decoder, xmlRoot); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func writeXMLValue(encoder *xml.Encoder, decoder *json.Decoder, name string) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if !validXMLName(name) {
+		start = xml.StartElement{
+			Name: xml.Name{Local: xmlEntry},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: name}},
+		}
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		if err := encoder.EncodeToken(start); err != nil {
+			return err
+		}
+		for decoder.More() {
+			childName := xmlItem
+			if t == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				childName = key.(string)
+			}
+			if err := writeXMLValue(encoder, decoder, childName); err != nil {
+				return err
+			}
+		}
+		// Consume the closing delimiter
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		return encoder.EncodeToken(start.End())
+	case nil:
+		return nil
+	case string:
+		return encoder.EncodeElement(t, start)
+	case json.Number:
+		return encoder.EncodeElement(t.String(), start)
+	case bool:
+		return encoder.EncodeElement(strconv.FormatBool(t), start)
+	}
+	return errors.New("content: unexpected JSON token")
+}
+
+func validXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		if unicode.IsLetter(r) || r == '_' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// xmlToTree reads an XML document into the generic values JSON decodes to.
+// Elements with children become objects, repeated elements become lists and
+// everything else is text; the name of the root element is ignored.
+func xmlToTree(data []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, errors.New("XML document has no root element")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := token.(xml.StartElement); ok {
+			return readXMLElement(decoder)
+		}
+	}
+}
+
+func readXMLElement(decoder *xml.Decoder) (interface{}, error) {
+	var text strings.Builder
+	var children map[string]interface{}
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			value, err := readXMLElement(decoder)
+			if err != nil {
+				return nil, err
+			}
+			name := t.Name.Local
+			if name == xmlEntry {
+				for _, attr := range t.Attr {
+					if attr.Name.Local == "key" {
+						name = attr.Value
+					}
+				}
+			}
+			if children == nil {
+				children = map[string]interface{}{}
+			}
+			existing, seen := children[name]
+			switch list := existing.(type) {
+			case xmlList:
+				children[name] = append(list, value)
+			default:
+				if seen {
+					children[name] = xmlList{existing, value}
+				} else {
+					children[name] = value
+				}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if children != nil {
+				return unwrapXMLLists(children), nil
+			}
+			return text.String(), nil
+		}
+	}
+}
+
+// xmlList marks the values of repeated elements while an element is read
+type xmlList []interface{}
+
+func unwrapXMLLists(children map[string]interface{}) map[string]interface{} {
+	for name, value := range children {
+		if list, ok := value.(xmlList); ok {
+			children[name] = []interface{}(list)
+		}
+	}
+	return children
+}
@@ -0,0 +1,97 @@
+package covers
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	_ "image/png" // register PNG decoder
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // register WebP decoder
+)
+
+// MaxPixels bounds the decoded size of an upload to protect against
+// decompression bombs
+const MaxPixels = 40_000_000
+
+var (
+	ErrUnsupportedType = errors.New("cover must be a JPEG, PNG or WebP image")
+	ErrTooLarge        = errors.New("cover image dimensions are too large")
+)
+
+// Size is a thumbnail size, bounded by width
+type Size struct {
+	Name  string
+	Width int
+}
+
+// Sizes are the thumbnails generated for every cover
+var Sizes = []Size{
+	{Name: "small", Width: 96},
+	{Name: "medium", Width: 240},
+	{Name: "large", Width: 480},
+}
+
+var extensions = map[string]string{
+	"image/jpeg": "jpg",
+	"image/png":  "png",
+	"image/webp": "webp",
+}
+
+// Sniff detects the content type of an image from its content, ignoring
+// whatever the client claimed, and returns it with a file extension
+func Sniff(data []byte) (contentType, extension string, err error) {
+	contentType = http.DetectContentType(data)
+	extension, ok := extensions[contentType]
+	if !ok {
+		return "", "", ErrUnsupportedType
+	}
+	return contentType, extension, nil
+}
+
+// Thumbnails decodes a cover and renders a JPEG thumbnail for every size.
+// Images are scaled down to the thumbnail width, never up.
+func Thumbnails(data []byte) (map[string][]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnails := make(map[string][]byte, len(Sizes))
+	for _, size := range Sizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, scale(src, size.Width), &jpeg.Options{Quality: 85}); err != nil {
+			return nil, err
+		}
+		thumbnails[size.Name] = buf.Bytes()
+	}
+
+	return thumbnails, nil
+}
+
+func scale(src image.Image, width int) image.Image {
+	bounds := src.Bounds()
+	if bounds.Dx() <= width {
+		width = bounds.Dx()
+	}
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	// JPEG has no alpha channel, so flatten transparent covers onto white
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
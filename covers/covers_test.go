@@ -0,0 +1,143 @@
+package covers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pixelBomb returns a small PNG whose header claims it is width by height
+func pixelBomb(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	data := encodePNG(t, 1, 1)
+	// The IHDR chunk follows the 8 byte signature: length, type, width,
+	// height, 5 more bytes of header and the CRC of type and data
+	ihdr := data[8+4 : 8+4+4+13]
+	binary.BigEndian.PutUint32(ihdr[4:8], width)
+	binary.BigEndian.PutUint32(ihdr[8:12], height)
+	binary.BigEndian.PutUint32(data[8+4+4+13:], crc32.ChecksumIEEE(ihdr))
+	return data
+}
+
+func TestSniff(t *testing.T) {
+	var jpg, gifImage bytes.Buffer
+	if err := jpeg.Encode(&jpg, image.NewGray(image.Rect(0, 0, 2, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.Encode(&gifImage, image.NewPaletted(image.Rect(0, 0, 2, 2), color.Palette{color.Black}), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		data          []byte
+		wantType      string
+		wantExtension string
+		wantErr       error
+	}{
+		{name: "png", data: encodePNG(t, 2, 2), wantType: "image/png", wantExtension: "png"},
+		{name: "jpeg", data: jpg.Bytes(), wantType: "image/jpeg", wantExtension: "jpg"},
+		{name: "webp", data: []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), wantType: "image/webp", wantExtension: "webp"},
+		{name: "gif", data: gifImage.Bytes(), wantErr: ErrUnsupportedType},
+		{name: "text", data: []byte("not an image"), wantErr: ErrUnsupportedType},
+		{name: "html", data: []byte("<html><body><img src=x></body></html>"), wantErr: ErrUnsupportedType},
+		{name: "empty", wantErr: ErrUnsupportedType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, extension, err := Sniff(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if contentType != tt.wantType || extension != tt.wantExtension {
+				t.Errorf("Sniff = %q, %q, want %q, %q", contentType, extension, tt.wantType, tt.wantExtension)
+			}
+		})
+	}
+}
+
+func TestThumbnailsRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "pixel bomb", data: pixelBomb(t, 50_000, 50_000), wantErr: ErrTooLarge},
+		{name: "just over the limit", data: pixelBomb(t, 8000, MaxPixels/8000+1), wantErr: ErrTooLarge},
+		{name: "not an image", data: []byte("not an image"), wantErr: image.ErrFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Thumbnails(tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestThumbnailSizes(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		want          map[string]image.Point
+	}{
+		{
+			name:  "scaled down",
+			width: 1000, height: 1500,
+			want: map[string]image.Point{"small": {96, 144}, "medium": {240, 360}, "large": {480, 720}},
+		},
+		{
+			name:  "never scaled up",
+			width: 200, height: 100,
+			want: map[string]image.Point{"small": {96, 48}, "medium": {200, 100}, "large": {200, 100}},
+		},
+		{
+			name:  "at least a pixel high",
+			width: 1000, height: 2,
+			want: map[string]image.Point{"small": {96, 1}, "medium": {240, 1}, "large": {480, 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thumbnails, err := Thumbnails(encodePNG(t, tt.width, tt.height))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(thumbnails) != len(Sizes) {
+				t.Fatalf("%d thumbnails, want %d", len(thumbnails), len(Sizes))
+			}
+			for name, want := range tt.want {
+				config, format, err := image.DecodeConfig(bytes.NewReader(thumbnails[name]))
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if format != "jpeg" {
+					t.Errorf("%s is %s, want jpeg", name, format)
+				}
+				if got := (image.Point{config.Width, config.Height}); got != want {
+					t.Errorf("%s is %v, want %v", name, got, want)
+				}
+			}
+		})
+	}
+}
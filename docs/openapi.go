@@ -0,0 +1,11 @@
+package docs
+
+import _ "embed"
+
+//go:generate go run mentalartsapi/cmd/openapi -dir .. -o openapi.json
+
+// OpenAPI is the OpenAPI 3.1 spec of the REST API, generated from the
+// handler annotations and served at /openapi.json
+//
+//go:embed openapi.json
+var OpenAPI []byte
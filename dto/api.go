@@ -1,13 +1,36 @@
 package dto
 
-import "time"
+import (
+	"encoding/json"
+	"mentalartsapi/ids"
+	"mentalartsapi/models"
+	"time"
+)
 
 type Response struct {
 	Msg string `json:"message"`
 }
 
+// ErrorResponse carries the ID of the request, so that clients can quote it
+// when reporting the error
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string        `json:"error"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// WithRequestID returns a copy of the response carrying the request ID
+func (r ErrorResponse) WithRequestID(id string) interface{} {
+	r.RequestID = id
+	return r
+}
+
+// ErrorDetail locates a problem with a request, e.g. the body field or the
+// query parameter that failed validation
+type ErrorDetail struct {
+	In      string `json:"in"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
 }
 
 type User struct {
@@ -30,6 +53,54 @@ type Pagination struct {
 	HasMore      bool  `json:"has_more"`
 }
 
+// Paginated list responses
+type AuthorList struct {
+	Data       []models.Author `json:"data"`
+	Pagination Pagination      `json:"pagination"`
+}
+
+type BookList struct {
+	Data       []models.Book `json:"data"`
+	Pagination Pagination    `json:"pagination"`
+}
+
+type WorkList struct {
+	Data       []models.Work `json:"data"`
+	Pagination Pagination    `json:"pagination"`
+}
+
+type PublisherList struct {
+	Data       []models.Publisher `json:"data"`
+	Pagination Pagination         `json:"pagination"`
+}
+
+type SeriesList struct {
+	Data       []models.Series `json:"data"`
+	Pagination Pagination      `json:"pagination"`
+}
+
+type ReviewList struct {
+	Data       []models.Review `json:"data"`
+	Pagination Pagination      `json:"pagination"`
+}
+
+type TenantList struct {
+	Data       []models.Tenant `json:"data"`
+	Pagination Pagination      `json:"pagination"`
+}
+
+// Book list filters, shared by the list and export endpoints
+type BookFilterQuery struct {
+	Query       string `form:"q"`
+	AuthorID    ids.ID `form:"author_id"`
+	WorkID      ids.ID `form:"work_id"`
+	PublisherID ids.ID `form:"publisher_id"`
+	Format      string `form:"book_format" binding:"omitempty,oneof=hardcover paperback ebook audiobook"`
+	Language    string `form:"language"`
+	YearFrom    int    `form:"year_from"`
+	YearTo      int    `form:"year_to"`
+}
+
 // Author DTO
 type AuthorRequest struct {
 	Name      string    `json:"name" binding:"required"`
@@ -37,13 +108,83 @@ type AuthorRequest struct {
 	BirthDate time.Time `json:"birth_date"`
 }
 
-// Book DTO
+// Book DTO. A book is an edition of a work; leaving WorkID empty starts a
+// new work from the edition's title, description and author.
 type BookRequest struct {
-	Title          string `json:"title" binding:"required"`
-	ISBN           string `json:"isbn" binding:"required"`
-	PublicationYear int    `json:"publication_year"`
-	Description    string `json:"description"`
-	AuthorID       uint   `json:"author_id" binding:"required"`
+	Title           string  `json:"title" binding:"required"`
+	ISBN            string  `json:"isbn" binding:"required"`
+	PublicationYear int     `json:"publication_year"`
+	Description     string  `json:"description"`
+	Format          string  `json:"format" binding:"omitempty,oneof=hardcover paperback ebook audiobook"`
+	Language        string  `json:"language" binding:"omitempty,max=35"`
+	PageCount       int     `json:"page_count" binding:"min=0"`
+	EditionNumber   int     `json:"edition_number" binding:"min=0"`
+	AuthorID        ids.ID  `json:"author_id" binding:"required"`
+	WorkID          ids.ID  `json:"work_id"`
+	PublisherID     *ids.ID `json:"publisher_id"`
+}
+
+// Book response with the other editions of the same work, the rating
+// aggregated across all of them and the book's place in any series
+type BookResponse struct {
+	models.Book
+	Editions []models.Book   `json:"editions"`
+	Rating   RatingSummary   `json:"rating"`
+	Series   []SeriesListing `json:"series"`
+}
+
+// Series DTO
+type SeriesRequest struct {
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+}
+
+// Series membership DTO
+type SeriesEntryRequest struct {
+	Position *float64 `json:"position" binding:"required"`
+}
+
+// SeriesListing places a book in a series and links to its neighbours
+type SeriesListing struct {
+	SeriesID ids.ID        `json:"series_id"`
+	Title    string        `json:"title"`
+	Position float64       `json:"position"`
+	Previous *SeriesVolume `json:"previous"`
+	Next     *SeriesVolume `json:"next"`
+}
+
+// SeriesVolume links to a book in a series
+type SeriesVolume struct {
+	BookID   ids.ID  `json:"book_id"`
+	Title    string  `json:"title"`
+	Position float64 `json:"position"`
+	Href     string  `json:"href"`
+}
+
+// Work DTO
+type WorkRequest struct {
+	Title       string `json:"title" binding:"required"`
+	Description string `json:"description"`
+	AuthorID    ids.ID `json:"author_id" binding:"required"`
+}
+
+// Work response with its aggregated rating
+type WorkResponse struct {
+	models.Work
+	Rating RatingSummary `json:"rating"`
+}
+
+// Rating aggregate over all reviews of a work
+type RatingSummary struct {
+	Average float64 `json:"average"`
+	Count   int64   `json:"count"`
+}
+
+// Publisher DTO
+type PublisherRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Country string `json:"country"`
+	Website string `json:"website" binding:"omitempty,url"`
 }
 
 // Review DTO
@@ -51,3 +192,98 @@ type ReviewRequest struct {
 	Rating  int    `json:"rating" binding:"required,min=1,max=5"`
 	Comment string `json:"comment"`
 }
+
+// Tenant DTO
+type TenantRequest struct {
+	Name   string `json:"name" binding:"required"`
+	Slug   string `json:"slug" binding:"required"`
+	Active *bool  `json:"active"`
+}
+
+// Batch DTO. Operations run in order in one transaction.
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations" binding:"required"`
+}
+
+// BatchOperation is a request to a v1 route. String values of the body of
+// the form "$0.id", and such references in the path, are replaced with a
+// field of the result of an earlier operation.
+type BatchOperation struct {
+	Method string          `json:"method" binding:"required,oneof=GET POST PUT DELETE"`
+	Path   string          `json:"path" binding:"required"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// BatchResult is the response to a batch operation
+type BatchResult struct {
+	Status int             `json:"status"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// Batch response with the results of the operations that ran. When one
+// fails, the batch is rolled back and Error says which.
+type BatchResponse struct {
+	Results   []BatchResult `json:"results,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Details   []ErrorDetail `json:"details,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// WithRequestID returns a copy of a failed batch's response carrying the
+// request ID
+func (r BatchResponse) WithRequestID(id string) interface{} {
+	if r.Error != "" {
+		r.RequestID = id
+	}
+	return r
+}
+
+// Bulk DTO. Items are decoded and validated one by one, so that every
+// failure is reported against its item. Mode is atomic, the default, or
+// partial.
+type BulkRequest struct {
+	Mode  string            `json:"mode" binding:"omitempty,oneof=atomic partial"`
+	Items []json.RawMessage `json:"items" binding:"required"`
+}
+
+// Bulk delete DTO
+type BulkDeleteRequest struct {
+	Mode string   `json:"mode" binding:"omitempty,oneof=atomic partial"`
+	IDs  []ids.ID `json:"ids" binding:"required"`
+}
+
+// BookUpdateItem is an item of a bulk book update
+type BookUpdateItem struct {
+	ID ids.ID `json:"id" binding:"required"`
+	BookRequest
+}
+
+// ReviewCreateItem is an item of a bulk review creation
+type ReviewCreateItem struct {
+	BookID ids.ID `json:"book_id" binding:"required"`
+	ReviewRequest
+}
+
+// ReviewUpdateItem is an item of a bulk review update
+type ReviewUpdateItem struct {
+	ID ids.ID `json:"id" binding:"required"`
+	ReviewRequest
+}
+
+// Bulk response with a result per item, in the order of the request
+type BulkResponse struct {
+	Mode      string       `json:"mode"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+// BulkResult is the outcome of an item of a bulk request. Status is the
+// status a request for the item alone would have had; valid items of an
+// atomic request that failed are 424 Failed Dependency.
+type BulkResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	ID     ids.ID `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
@@ -0,0 +1,64 @@
+package export
+
+import (
+	"mentalartsapi/ids"
+	"mentalartsapi/models"
+
+	"gorm.io/gorm"
+)
+
+// Record is one exported book with its author, publisher and the rating
+// aggregated across all editions of its work
+type Record struct {
+	ID              ids.ID  `json:"id"`
+	Title           string  `json:"title"`
+	ISBN            string  `json:"isbn"`
+	PublicationYear int     `json:"publication_year"`
+	Description     string  `json:"description"`
+	Format          string  `json:"format"`
+	Language        string  `json:"language"`
+	PageCount       int     `json:"page_count"`
+	EditionNumber   int     `json:"edition_number"`
+	WorkID          ids.ID  `json:"work_id"`
+	AuthorID        ids.ID  `json:"author_id"`
+	AuthorName      string  `json:"author_name"`
+	PublisherName   string  `json:"publisher_name"`
+	RatingAverage   float64 `json:"rating_average"`
+	RatingCount     int64   `json:"rating_count"`
+}
+
+// Books streams the books matched by query, which must be a query on
+// models.Book, to fn one row at a time straight from a database cursor, so
+// memory use does not depend on the size of the catalogue
+func Books(query *gorm.DB, fn func(Record) error) error {
+	ratings := query.Session(&gorm.Session{NewDB: true}).
+		Model(&models.Review{}).
+		Select("work_id, AVG(rating) AS average, COUNT(*) AS count").
+		Group("work_id")
+
+	rows, err := query.
+		Select(`books.id, books.title, books.isbn, books.publication_year, books.description,
+			books.format, books.language, books.page_count, books.edition_number, books.work_id,
+			books.author_id, COALESCE(authors.name, '') AS author_name, COALESCE(publishers.name, '') AS publisher_name,
+			COALESCE(ratings.average, 0) AS rating_average, COALESCE(ratings.count, 0) AS rating_count`).
+		Joins("LEFT JOIN authors ON authors.id = books.author_id").
+		Joins("LEFT JOIN publishers ON publishers.id = books.publisher_id").
+		Joins("LEFT JOIN (?) AS ratings ON ratings.work_id = books.work_id", ratings).
+		Order("books.id").
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var record Record
+		if err := query.ScanRows(rows, &record); err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
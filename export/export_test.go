@@ -0,0 +1,134 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mentalartsapi/models"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Author{}, &models.Publisher{}, &models.Work{}, &models.Book{}, &models.Review{}); err != nil {
+		t.Fatal(err)
+	}
+
+	author := models.Author{Name: "Ursula K. Le Guin"}
+	db.Create(&author)
+	publisher := models.Publisher{Name: "Harper Voyager"}
+	db.Create(&publisher)
+	work := models.Work{Title: "The Dispossessed", AuthorID: author.ID}
+	db.Create(&work)
+	books := []models.Book{
+		{Title: "The Dispossessed", ISBN: "9780061054884", AuthorID: author.ID, WorkID: work.ID, PublisherID: &publisher.ID, PublicationYear: 1994},
+		{Title: "The Dispossessed, 2nd edition", ISBN: "9780060512750", AuthorID: author.ID, WorkID: work.ID, EditionNumber: 2},
+	}
+	db.Create(&books)
+	// Ratings are shared by the editions of the work
+	db.Create(&[]models.Review{
+		{Rating: 5, WorkID: work.ID, BookID: books[0].ID},
+		{Rating: 4, WorkID: work.ID, BookID: books[1].ID},
+	})
+	return db
+}
+
+func TestBooks(t *testing.T) {
+	db := testDB(t)
+	var records []Record
+	if err := Books(db.Model(&models.Book{}), func(record Record) error {
+		records = append(records, record)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("%d records, want 2", len(records))
+	}
+	first, second := records[0], records[1]
+	if first.AuthorName != "Ursula K. Le Guin" || first.PublisherName != "Harper Voyager" || first.PublicationYear != 1994 {
+		t.Errorf("first record = %+v", first)
+	}
+	if second.PublisherName != "" || second.EditionNumber != 2 {
+		t.Errorf("second record = %+v, want no publisher", second)
+	}
+	for _, record := range records {
+		if record.RatingAverage != 4.5 || record.RatingCount != 2 {
+			t.Errorf("rating of %s = %v from %d reviews, want 4.5 from 2", record.ISBN, record.RatingAverage, record.RatingCount)
+		}
+	}
+
+	// Filters apply, and an error from fn stops the export
+	stop := errors.New("client gone")
+	calls := 0
+	err := Books(db.Model(&models.Book{}).Where("edition_number = ?", 2), func(Record) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("Books = %v after %d calls, want %v after 1", err, calls, stop)
+	}
+}
+
+func TestWriters(t *testing.T) {
+	record := Record{ID: 1, Title: `The "Dispossessed", a novel`, ISBN: "9780061054884", WorkID: 1, AuthorID: 1,
+		AuthorName: "Ursula K. Le Guin", RatingAverage: 4.5, RatingCount: 2}
+
+	tests := []struct {
+		format Format
+		want   []string
+	}{
+		{format: CSV, want: []string{
+			"id,title,isbn,publication_year,description,format,language,page_count,edition_number,work_id,author_id,author_name,publisher_name,rating_average,rating_count\n",
+			`1,"The ""Dispossessed"", a novel",9780061054884,0,,,,0,0,1,1,Ursula K. Le Guin,,4.50,2` + "\n",
+		}},
+		{format: NDJSON, want: []string{`"title":"The \"Dispossessed\", a novel"`, `"rating_average":4.5`}},
+		{format: MARCXML, want: []string{"<collection", "9780061054884", "Ursula K. Le Guin", "</collection>"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Write(record); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("export = %s, want it to contain %s", buf.String(), want)
+				}
+			}
+			if tt.format == NDJSON {
+				var decoded Record
+				if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded != record {
+					t.Errorf("decoded = %+v, %v, want %+v", decoded, err, record)
+				}
+			}
+		})
+	}
+
+	// An empty CSV export still has its header
+	var buf bytes.Buffer
+	w, _ := NewWriter(&buf, CSV)
+	w.Close()
+	if !strings.HasPrefix(buf.String(), "id,title,") || strings.Count(buf.String(), "\n") != 1 {
+		t.Errorf("empty CSV export = %q, want the header only", buf.String())
+	}
+	if _, err := NewWriter(&buf, "xlsx"); err == nil {
+		t.Error("unsupported format accepted")
+	}
+}
@@ -0,0 +1,164 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mentalartsapi/marc"
+	"mentalartsapi/models"
+	"strconv"
+)
+
+// Format of an export
+type Format string
+
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	MARCXML Format = "marcxml"
+)
+
+// Writer encodes exported records
+type Writer interface {
+	Write(Record) error
+	// Flush writes any buffered records to the underlying writer
+	Flush() error
+	// Close finishes the document and flushes it
+	Close() error
+}
+
+// ContentType returns the media type of an export format
+func ContentType(format Format) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case NDJSON:
+		return "application/x-ndjson"
+	case MARCXML:
+		return "application/marcxml+xml"
+	}
+	return "application/octet-stream"
+}
+
+// NewWriter returns a writer encoding records in the given format
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	switch format {
+	case CSV:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	case NDJSON:
+		buffered := bufio.NewWriter(w)
+		return &ndjsonWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	case MARCXML:
+		buffered := bufio.NewWriter(w)
+		return &marcWriter{buffered: buffered, writer: marc.NewXMLWriter(buffered)}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+var csvHeader = []string{
+	"id", "title", "isbn", "publication_year", "description", "format", "language", "page_count",
+	"edition_number", "work_id", "author_id", "author_name", "publisher_name", "rating_average", "rating_count",
+}
+
+type csvWriter struct {
+	writer        *csv.Writer
+	headerWritten bool
+}
+
+func (w *csvWriter) writeHeader() error {
+	if w.headerWritten {
+		return nil
+	}
+	w.headerWritten = true
+	return w.writer.Write(csvHeader)
+}
+
+func (w *csvWriter) Write(record Record) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	return w.writer.Write([]string{
+		record.ID.String(),
+		record.Title,
+		record.ISBN,
+		strconv.Itoa(record.PublicationYear),
+		record.Description,
+		record.Format,
+		record.Language,
+		strconv.Itoa(record.PageCount),
+		strconv.Itoa(record.EditionNumber),
+		record.WorkID.String(),
+		record.AuthorID.String(),
+		record.AuthorName,
+		record.PublisherName,
+		strconv.FormatFloat(record.RatingAverage, 'f', 2, 64),
+		strconv.FormatInt(record.RatingCount, 10),
+	})
+}
+
+func (w *csvWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvWriter) Close() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+type ndjsonWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(record Record) error {
+	return w.encoder.Encode(record)
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return w.buffered.Flush()
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.Flush()
+}
+
+type marcWriter struct {
+	buffered *bufio.Writer
+	writer   *marc.XMLWriter
+}
+
+func (w *marcWriter) Write(record Record) error {
+	book := models.Book{
+		Title:           record.Title,
+		ISBN:            record.ISBN,
+		PublicationYear: record.PublicationYear,
+		Description:     record.Description,
+		Format:          record.Format,
+		Language:        record.Language,
+		PageCount:       record.PageCount,
+		EditionNumber:   record.EditionNumber,
+		AuthorID:        record.AuthorID,
+		Author:          models.Author{Name: record.AuthorName},
+	}
+	book.ID = record.ID
+	if record.PublisherName != "" {
+		book.Publisher = &models.Publisher{Name: record.PublisherName}
+	}
+	return w.writer.Write(marc.FromBook(book))
+}
+
+func (w *marcWriter) Flush() error {
+	return w.buffered.Flush()
+}
+
+func (w *marcWriter) Close() error {
+	if err := w.writer.Close(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
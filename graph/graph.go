@@ -0,0 +1,49 @@
+// Package graph serves the GraphQL API for authors, books and reviews at
+// /graphql. Resolvers read through per-request loaders that batch the
+// lookups of sibling fields into single queries, and write through the same
+// services as the REST API.
+package graph
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graph-gophers/graphql-go"
+	"gorm.io/gorm"
+)
+
+// MaxDepth limits how deeply queries may nest selections
+const MaxDepth = 10
+
+//go:embed schema.graphql
+var Schema string
+
+// Request is a GraphQL request
+type Request struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// NewHandler returns the handler for GraphQL requests. It expects the
+// tenant middleware to have run, like the REST routes.
+func NewHandler(db *gorm.DB) gin.HandlerFunc {
+	schema := graphql.MustParseSchema(Schema, &Resolver{},
+		graphql.MaxDepth(MaxDepth),
+		// Resolve a whole page of items at once so that their fields batch
+		graphql.MaxParallelism(maxBatch))
+
+	return func(c *gin.Context) {
+		var request Request
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"errors": []gin.H{{"message": err.Error()}}})
+			return
+		}
+
+		ctx := c.Request.Context()
+		ctx = withLoaders(ctx, newLoaders(db.WithContext(ctx)))
+
+		c.JSON(http.StatusOK, schema.Exec(ctx, request.Query, request.OperationName, request.Variables))
+	}
+}
@@ -0,0 +1,124 @@
+package graph
+
+import (
+	"errors"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+const (
+	// batchWait is how long a loader collects keys before fetching them
+	batchWait = 2 * time.Millisecond
+	// maxBatch caps the keys fetched by one query
+	maxBatch = 100
+)
+
+// Loader batches the keys requested by concurrently resolved fields into a
+// single fetch and caches the results for the rest of the request. The
+// fetch function returns the values found; keys it leaves out load as the
+// zero value.
+type Loader[K comparable, V any] struct {
+	fetch func(keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	results map[K]*result[V]
+	pending *batch[K, V]
+}
+
+type result[V any] struct {
+	value V
+	err   error
+	done  chan struct{}
+}
+
+type batch[K comparable, V any] struct {
+	keys    []K
+	results []*result[V]
+}
+
+func newLoader[K comparable, V any](fetch func(keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, results: map[K]*result[V]{}}
+}
+
+// Load returns the value for a key, waiting for the batch it joins
+func (l *Loader[K, V]) Load(key K) (V, error) {
+	l.mu.Lock()
+	r, ok := l.results[key]
+	if !ok {
+		r = &result[V]{done: make(chan struct{})}
+		l.results[key] = r
+
+		if l.pending == nil {
+			b := &batch[K, V]{}
+			l.pending = b
+			time.AfterFunc(batchWait, func() { l.dispatch(b) })
+		}
+		l.pending.keys = append(l.pending.keys, key)
+		l.pending.results = append(l.pending.results, r)
+		if len(l.pending.keys) >= maxBatch {
+			b := l.pending
+			l.pending = nil
+			go l.run(b)
+		}
+	}
+	l.mu.Unlock()
+
+	<-r.done
+	return r.value, r.err
+}
+
+// Clear forgets the cached results, so that reads after a mutation see its
+// changes
+func (l *Loader[K, V]) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, r := range l.results {
+		select {
+		case <-r.done:
+			delete(l.results, key)
+		default:
+			// Still loading; callers are waiting on it
+		}
+	}
+}
+
+// dispatch runs a batch once its wait is over, unless it already ran
+// because it was full
+func (l *Loader[K, V]) dispatch(b *batch[K, V]) {
+	l.mu.Lock()
+	if l.pending != b {
+		l.mu.Unlock()
+		return
+	}
+	l.pending = nil
+	l.mu.Unlock()
+
+	l.run(b)
+}
+
+// errLoadPanicked answers the keys of a batch whose fetch panicked
+var errLoadPanicked = errors.New("internal error while loading")
+
+func (l *Loader[K, V]) run(b *batch[K, V]) {
+	values, err := l.fetchBatch(b.keys)
+	for i, key := range b.keys {
+		r := b.results[i]
+		r.value, r.err = values[key], err
+		close(r.done)
+	}
+}
+
+// fetchBatch fetches the keys of a batch. It runs outside the goroutine of
+// any request, so a panic would crash the server and leave the callers
+// waiting; it is logged and answers them all with an error instead.
+func (l *Loader[K, V]) fetchBatch(keys []K) (values map[K]V, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.Error("panic", "error", recovered, "stack", string(debug.Stack()))
+			values, err = nil, errLoadPanicked
+		}
+	}()
+	return l.fetch(keys)
+}
@@ -0,0 +1,104 @@
+package graph
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// loadAll loads keys concurrently, as sibling fields are resolved
+func loadAll(l *Loader[int, string], keys []int) ([]string, []error) {
+	values := make([]string, len(keys))
+	errs := make([]error, len(keys))
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values[i], errs[i] = l.Load(key)
+		}()
+	}
+	wg.Wait()
+	return values, errs
+}
+
+func TestLoaderBatches(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]int
+	l := newLoader(func(keys []int) (map[int]string, error) {
+		mu.Lock()
+		batches = append(batches, keys)
+		mu.Unlock()
+		values := map[int]string{}
+		for _, key := range keys {
+			if key != 3 {
+				values[key] = "value"
+			}
+		}
+		return values, nil
+	})
+
+	values, errs := loadAll(l, []int{1, 2, 3, 1})
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Fatalf("batches = %v, want the 3 keys in one", batches)
+	}
+	for i, want := range []string{"value", "value", "", "value"} {
+		if values[i] != want || errs[i] != nil {
+			t.Errorf("Load = %q, %v, want %q", values[i], errs[i], want)
+		}
+	}
+
+	// Loaded keys are cached until cleared
+	l.Load(1)
+	if len(batches) != 1 {
+		t.Errorf("cached key fetched again")
+	}
+	l.Clear()
+	l.Load(1)
+	if len(batches) != 2 {
+		t.Errorf("cleared key not fetched again")
+	}
+}
+
+func TestLoaderMaxBatch(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	l := newLoader(func(keys []int) (map[int]string, error) {
+		mu.Lock()
+		sizes = append(sizes, len(keys))
+		mu.Unlock()
+		return nil, nil
+	})
+
+	keys := make([]int, maxBatch+1)
+	for i := range keys {
+		keys[i] = i
+	}
+	loadAll(l, keys)
+	if len(sizes) != 2 || sizes[0]+sizes[1] != maxBatch+1 || max(sizes[0], sizes[1]) != maxBatch {
+		t.Errorf("batch sizes = %v, want %d and 1", sizes, maxBatch)
+	}
+}
+
+func TestLoaderPanic(t *testing.T) {
+	l := newLoader(func(keys []int) (map[int]string, error) {
+		panic("fetch failed")
+	})
+
+	done := make(chan []error)
+	go func() {
+		_, errs := loadAll(l, []int{1, 2})
+		done <- errs
+	}()
+	select {
+	case errs := <-done:
+		for _, err := range errs {
+			if !errors.Is(err, errLoadPanicked) {
+				t.Errorf("Load error = %v, want %v", err, errLoadPanicked)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callers still waiting after the fetch panicked")
+	}
+}
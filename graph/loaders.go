@@ -0,0 +1,186 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"mentalartsapi/models"
+
+	"gorm.io/gorm"
+)
+
+type contextKey struct{}
+
+// pageKey identifies a page of a parent's collection
+type pageKey struct {
+	ParentID ids.ID
+	Offset   int
+	First    int
+}
+
+// page is a slice of a collection and whether more items follow it
+type page[T any] struct {
+	Items   []T
+	HasNext bool
+}
+
+// loaders batch the lookups of one request. They live as long as the
+// request, so nothing is cached across requests or tenants.
+type loaders struct {
+	db *gorm.DB
+
+	authors      *Loader[ids.ID, *models.Author]
+	books        *Loader[ids.ID, *models.Book]
+	ratings      *Loader[ids.ID, dto.RatingSummary]
+	authorBooks  *Loader[pageKey, page[models.Book]]
+	bookCounts   *Loader[ids.ID, int64]
+	workReviews  *Loader[pageKey, page[models.Review]]
+	reviewCounts *Loader[ids.ID, int64]
+}
+
+func newLoaders(db *gorm.DB) *loaders {
+	return &loaders{
+		db: db,
+		authors: newLoader(func(keys []ids.ID) (map[ids.ID]*models.Author, error) {
+			var authors []models.Author
+			if err := db.Where("id IN ?", keys).Find(&authors).Error; err != nil {
+				return nil, err
+			}
+			found := make(map[ids.ID]*models.Author, len(authors))
+			for i := range authors {
+				found[authors[i].ID] = &authors[i]
+			}
+			return found, nil
+		}),
+		books: newLoader(func(keys []ids.ID) (map[ids.ID]*models.Book, error) {
+			var books []models.Book
+			if err := db.Where("id IN ?", keys).Find(&books).Error; err != nil {
+				return nil, err
+			}
+			found := make(map[ids.ID]*models.Book, len(books))
+			for i := range books {
+				found[books[i].ID] = &books[i]
+			}
+			return found, nil
+		}),
+		ratings: newLoader(func(workIDs []ids.ID) (map[ids.ID]dto.RatingSummary, error) {
+			var rows []struct {
+				WorkID  ids.ID
+				Average float64
+				Count   int64
+			}
+			if err := db.Model(&models.Review{}).
+				Select("work_id, COUNT(*) AS count, COALESCE(AVG(rating), 0) AS average").
+				Where("work_id IN ?", workIDs).
+				Group("work_id").
+				Scan(&rows).Error; err != nil {
+				return nil, err
+			}
+			found := make(map[ids.ID]dto.RatingSummary, len(rows))
+			for _, row := range rows {
+				found[row.WorkID] = dto.RatingSummary{Average: row.Average, Count: row.Count}
+			}
+			return found, nil
+		}),
+		authorBooks: newLoader(func(keys []pageKey) (map[pageKey]page[models.Book], error) {
+			return loadPages(db, keys, "author_id", "id", func(book models.Book) ids.ID { return book.AuthorID })
+		}),
+		bookCounts: newLoader(func(authorIDs []ids.ID) (map[ids.ID]int64, error) {
+			return countByParent(db, &models.Book{}, "author_id", authorIDs)
+		}),
+		// Reviews belong to the work, so every edition lists the same ones,
+		// newest first
+		workReviews: newLoader(func(keys []pageKey) (map[pageKey]page[models.Review], error) {
+			return loadPages(db, keys, "work_id", "date_posted DESC, id DESC", func(review models.Review) ids.ID { return review.WorkID })
+		}),
+		reviewCounts: newLoader(func(workIDs []ids.ID) (map[ids.ID]int64, error) {
+			return countByParent(db, &models.Review{}, "work_id", workIDs)
+		}),
+	}
+}
+
+// clear drops everything loaded so far, after a mutation changed it
+func (l *loaders) clear() {
+	l.authors.Clear()
+	l.books.Clear()
+	l.ratings.Clear()
+	l.authorBooks.Clear()
+	l.bookCounts.Clear()
+	l.workReviews.Clear()
+	l.reviewCounts.Clear()
+}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(contextKey{}).(*loaders)
+}
+
+// loadPages fetches a page of children for many parents. Keys asking for
+// the same slice share one query that ranks the children of each parent
+// with a window function.
+func loadPages[T any](db *gorm.DB, keys []pageKey, foreignKey, order string, parentOf func(T) ids.ID) (map[pageKey]page[T], error) {
+	type window struct{ Offset, First int }
+	parents := map[window][]ids.ID{}
+	for _, key := range keys {
+		w := window{key.Offset, key.First}
+		parents[w] = append(parents[w], key.ParentID)
+	}
+
+	pages := make(map[pageKey]page[T], len(keys))
+	for w, parentIDs := range parents {
+		var model T
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(&model); err != nil {
+			return nil, err
+		}
+
+		ranked := db.Session(&gorm.Session{NewDB: true}).Model(&model).
+			Select(fmt.Sprintf("*, ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) AS page_rank", foreignKey, order)).
+			Where(foreignKey+" IN ?", parentIDs)
+		// One row past the page tells whether another page follows
+		var items []T
+		if err := db.Table("(?) AS "+stmt.Schema.Table, ranked).
+			Where("page_rank > ? AND page_rank <= ?", w.Offset, w.Offset+w.First+1).
+			Order("page_rank").
+			Find(&items).Error; err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			key := pageKey{ParentID: parentOf(item), Offset: w.Offset, First: w.First}
+			p := pages[key]
+			if len(p.Items) == w.First {
+				p.HasNext = true
+			} else {
+				p.Items = append(p.Items, item)
+			}
+			pages[key] = p
+		}
+	}
+	return pages, nil
+}
+
+// countByParent counts the children of each parent
+func countByParent(db *gorm.DB, model interface{}, foreignKey string, parentIDs []ids.ID) (map[ids.ID]int64, error) {
+	var rows []struct {
+		ParentID ids.ID
+		Count    int64
+	}
+	if err := db.Model(model).
+		Select(foreignKey+" AS parent_id, COUNT(*) AS count").
+		Where(foreignKey+" IN ?", parentIDs).
+		Group(foreignKey).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[ids.ID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ParentID] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,225 @@
+package graph
+
+import (
+	"context"
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"mentalartsapi/services"
+
+	"github.com/graph-gophers/graphql-go"
+	"gorm.io/gorm"
+)
+
+// Mutations go through the same services as the REST API, so they apply
+// the same validation and business rules. Each one clears the loaders, so
+// that the fields selected on its result see the change.
+
+type authorInput struct {
+	Name      string
+	Biography *string
+	BirthDate *graphql.Time
+}
+
+func (input authorInput) request() dto.AuthorRequest {
+	request := dto.AuthorRequest{Name: input.Name}
+	if input.Biography != nil {
+		request.Biography = *input.Biography
+	}
+	if input.BirthDate != nil {
+		request.BirthDate = input.BirthDate.Time
+	}
+	return request
+}
+
+type bookInput struct {
+	Title           string
+	ISBN            string
+	PublicationYear *int32
+	Description     *string
+	Format          *string
+	Language        *string
+	PageCount       *int32
+	EditionNumber   *int32
+	AuthorID        graphql.ID
+	WorkID          *graphql.ID
+	PublisherID     *graphql.ID
+}
+
+func (input bookInput) request() (dto.BookRequest, error) {
+	request := dto.BookRequest{
+		Title:           input.Title,
+		ISBN:            input.ISBN,
+		PublicationYear: intValue(input.PublicationYear),
+		Description:     stringValue(input.Description),
+		Format:          stringValue(input.Format),
+		Language:        stringValue(input.Language),
+		PageCount:       intValue(input.PageCount),
+		EditionNumber:   intValue(input.EditionNumber),
+	}
+
+	var err error
+	if request.AuthorID, err = parseID(input.AuthorID); err != nil {
+		return request, err
+	}
+	workID, err := optionalID(input.WorkID)
+	if err != nil {
+		return request, err
+	}
+	if workID != nil {
+		request.WorkID = *workID
+	}
+	if request.PublisherID, err = optionalID(input.PublisherID); err != nil {
+		return request, err
+	}
+	return request, nil
+}
+
+type reviewInput struct {
+	Rating  int32
+	Comment *string
+}
+
+func (input reviewInput) request() dto.ReviewRequest {
+	return dto.ReviewRequest{Rating: int(input.Rating), Comment: stringValue(input.Comment)}
+}
+
+func (r *Resolver) CreateAuthor(ctx context.Context, args struct{ Input authorInput }) (*authorResolver, error) {
+	l := loadersFrom(ctx)
+	author, err := services.CreateAuthor(l.db, args.Input.request())
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	l.clear()
+	return &authorResolver{&author}, nil
+}
+
+func (r *Resolver) UpdateAuthor(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input authorInput
+}) (*authorResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	l := loadersFrom(ctx)
+	author, err := services.UpdateAuthor(l.db, id, args.Input.request())
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	l.clear()
+	return &authorResolver{&author}, nil
+}
+
+func (r *Resolver) DeleteAuthor(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	return deleteMutation(ctx, args.ID, services.DeleteAuthor)
+}
+
+func (r *Resolver) CreateBook(ctx context.Context, args struct{ Input bookInput }) (*bookResolver, error) {
+	request, err := args.Input.request()
+	if err != nil {
+		return nil, err
+	}
+
+	l := loadersFrom(ctx)
+	book, err := services.CreateBook(l.db, request)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	l.clear()
+	return &bookResolver{&book}, nil
+}
+
+func (r *Resolver) UpdateBook(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input bookInput
+}) (*bookResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	request, err := args.Input.request()
+	if err != nil {
+		return nil, err
+	}
+
+	l := loadersFrom(ctx)
+	book, err := services.UpdateBook(l.db, id, request)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	l.clear()
+	return &bookResolver{&book}, nil
+}
+
+func (r *Resolver) DeleteBook(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	return deleteMutation(ctx, args.ID, services.DeleteBook)
+}
+
+func (r *Resolver) CreateReview(ctx context.Context, args struct {
+	BookID graphql.ID
+	Input  reviewInput
+}) (*reviewResolver, error) {
+	bookID, err := parseID(args.BookID)
+	if err != nil {
+		return nil, err
+	}
+
+	l := loadersFrom(ctx)
+	review, err := services.CreateReview(l.db, bookID, args.Input.request())
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	l.clear()
+	return &reviewResolver{&review}, nil
+}
+
+func (r *Resolver) UpdateReview(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input reviewInput
+}) (*reviewResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	l := loadersFrom(ctx)
+	review, err := services.UpdateReview(l.db, id, args.Input.request())
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	l.clear()
+	return &reviewResolver{&review}, nil
+}
+
+func (r *Resolver) DeleteReview(ctx context.Context, args struct{ ID graphql.ID }) (graphql.ID, error) {
+	return deleteMutation(ctx, args.ID, services.DeleteReview)
+}
+
+func deleteMutation(ctx context.Context, id graphql.ID, remove func(db *gorm.DB, id ids.ID) error) (graphql.ID, error) {
+	n, err := parseID(id)
+	if err != nil {
+		return "", err
+	}
+
+	l := loadersFrom(ctx)
+	if err := remove(l.db, n); err != nil {
+		return "", serviceError(err)
+	}
+	l.clear()
+	return id, nil
+}
+
+func intValue(v *int32) int {
+	if v == nil {
+		return 0
+	}
+	return int(*v)
+}
+
+func stringValue(v *string) string {
+	if v == nil {
+		return ""
+	}
+	return *v
+}
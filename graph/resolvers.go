@@ -0,0 +1,512 @@
+package graph
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"mentalartsapi/models"
+	"mentalartsapi/services"
+	"mentalartsapi/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/graph-gophers/graphql-go"
+	"gorm.io/gorm"
+)
+
+const (
+	maxFirst     = 100
+	cursorPrefix = "offset:"
+)
+
+// Error codes in the extensions of GraphQL errors
+const (
+	CodeNotFound     = "NOT_FOUND"
+	CodeBadUserInput = "BAD_USER_INPUT"
+	CodeInternal     = "INTERNAL_SERVER_ERROR"
+)
+
+// Error is a GraphQL error with a code in its extensions
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Extensions implements the resolver error interface of graphql-go
+func (e *Error) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.Code}
+}
+
+func badInput(message string) error {
+	return &Error{Code: CodeBadUserInput, Message: message}
+}
+
+// serviceError gives a service error the code matching its kind
+func serviceError(err error) error {
+	var serviceErr *services.Error
+	if !errors.As(err, &serviceErr) {
+		return &Error{Code: CodeInternal, Message: err.Error()}
+	}
+	if errors.Is(err, services.ErrNotFound) {
+		return &Error{Code: CodeNotFound, Message: serviceErr.Message}
+	}
+	return &Error{Code: CodeBadUserInput, Message: serviceErr.Message}
+}
+
+func parseID(id graphql.ID) (ids.ID, error) {
+	n, err := ids.Parse(string(id))
+	if err != nil {
+		return 0, badInput("invalid ID " + strconv.Quote(string(id)))
+	}
+	return n, nil
+}
+
+func optionalID(id *graphql.ID) (*ids.ID, error) {
+	if id == nil {
+		return nil, nil
+	}
+	n, err := parseID(*id)
+	if err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+func formatID(id ids.ID) graphql.ID {
+	return graphql.ID(id.String())
+}
+
+// connectionArgs are the arguments of paginated fields, whose page size
+// defaults to 10 in the schema. Cursors are opaque to clients and hold the
+// offset of an item in the collection.
+type connectionArgs struct {
+	First int32
+	After *string
+}
+
+func (args connectionArgs) window() (offset, first int, err error) {
+	first = int(args.First)
+	if first < 0 || first > maxFirst {
+		return 0, 0, badInput("first must be between 0 and " + strconv.Itoa(maxFirst))
+	}
+
+	if args.After != nil && *args.After != "" {
+		raw, err := base64.StdEncoding.DecodeString(*args.After)
+		position, ok := strings.CutPrefix(string(raw), cursorPrefix)
+		n, convErr := strconv.Atoi(position)
+		if err != nil || !ok || convErr != nil || n < 0 {
+			return 0, 0, badInput("invalid cursor")
+		}
+		offset = n + 1
+	}
+	return offset, first, nil
+}
+
+func cursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(offset)))
+}
+
+type connection[T any] struct {
+	edges   []*edge[T]
+	hasNext bool
+	count   func() (int64, error)
+}
+
+func newConnection[M, T any](items []M, offset int, hasNext bool, count func() (int64, error), node func(*M) T) *connection[T] {
+	c := &connection[T]{edges: make([]*edge[T], len(items)), hasNext: hasNext, count: count}
+	for i := range items {
+		c.edges[i] = &edge[T]{cursor: cursor(offset + i), node: node(&items[i])}
+	}
+	return c
+}
+
+func (c *connection[T]) Edges() []*edge[T] {
+	return c.edges
+}
+
+func (c *connection[T]) PageInfo() *pageInfo {
+	info := &pageInfo{hasNext: c.hasNext}
+	if len(c.edges) > 0 {
+		info.endCursor = &c.edges[len(c.edges)-1].cursor
+	}
+	return info
+}
+
+func (c *connection[T]) TotalCount() (int32, error) {
+	count, err := c.count()
+	if err != nil {
+		return 0, serviceError(err)
+	}
+	return int32(count), nil
+}
+
+type edge[T any] struct {
+	cursor string
+	node   T
+}
+
+func (e *edge[T]) Cursor() string {
+	return e.cursor
+}
+
+func (e *edge[T]) Node() T {
+	return e.node
+}
+
+type pageInfo struct {
+	hasNext   bool
+	endCursor *string
+}
+
+func (p *pageInfo) HasNextPage() bool {
+	return p.hasNext
+}
+
+func (p *pageInfo) EndCursor() *string {
+	return p.endCursor
+}
+
+// listPage reads a page of a top-level list, fetching one row more than
+// asked to tell whether another page follows
+func listPage[M any](query *gorm.DB, offset, first int) ([]M, bool, error) {
+	var items []M
+	if err := query.Offset(offset).Limit(first + 1).Find(&items).Error; err != nil {
+		return nil, false, err
+	}
+	if len(items) > first {
+		return items[:first], true, nil
+	}
+	return items, false, nil
+}
+
+// Resolver is the root resolver of the schema
+type Resolver struct{}
+
+func (r *Resolver) Author(ctx context.Context, args struct{ ID graphql.ID }) (*authorResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	author, err := loadersFrom(ctx).authors.Load(id)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	if author == nil {
+		return nil, nil
+	}
+	return &authorResolver{author}, nil
+}
+
+func (r *Resolver) Authors(ctx context.Context, args connectionArgs) (*connection[*authorResolver], error) {
+	offset, first, err := args.window()
+	if err != nil {
+		return nil, err
+	}
+
+	db := loadersFrom(ctx).db
+	authors, hasNext, err := listPage[models.Author](db.Order("id"), offset, first)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	count := func() (int64, error) {
+		var total int64
+		err := db.Model(&models.Author{}).Count(&total).Error
+		return total, err
+	}
+	return newConnection(authors, offset, hasNext, count, func(author *models.Author) *authorResolver {
+		return &authorResolver{author}
+	}), nil
+}
+
+func (r *Resolver) Book(ctx context.Context, args struct{ ID graphql.ID }) (*bookResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	book, err := loadersFrom(ctx).books.Load(id)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	if book == nil {
+		return nil, nil
+	}
+	return &bookResolver{book}, nil
+}
+
+type bookFilter struct {
+	Query       *string
+	AuthorID    *graphql.ID
+	WorkID      *graphql.ID
+	PublisherID *graphql.ID
+	Format      *string
+	Language    *string
+	YearFrom    *int32
+	YearTo      *int32
+}
+
+// query converts the filter to the one of the REST list endpoint, which
+// validates it the same way
+func (f *bookFilter) query() (dto.BookFilterQuery, error) {
+	var filters dto.BookFilterQuery
+	if f == nil {
+		return filters, nil
+	}
+
+	for _, id := range []struct {
+		value  *graphql.ID
+		target *ids.ID
+	}{{f.AuthorID, &filters.AuthorID}, {f.WorkID, &filters.WorkID}, {f.PublisherID, &filters.PublisherID}} {
+		n, err := optionalID(id.value)
+		if err != nil {
+			return filters, err
+		}
+		if n != nil {
+			*id.target = *n
+		}
+	}
+	if f.Query != nil {
+		filters.Query = *f.Query
+	}
+	if f.Format != nil {
+		filters.Format = *f.Format
+	}
+	if f.Language != nil {
+		filters.Language = *f.Language
+	}
+	if f.YearFrom != nil {
+		filters.YearFrom = int(*f.YearFrom)
+	}
+	if f.YearTo != nil {
+		filters.YearTo = int(*f.YearTo)
+	}
+
+	if err := binding.Validator.ValidateStruct(filters); err != nil {
+		return filters, badInput(err.Error())
+	}
+	return filters, nil
+}
+
+func (r *Resolver) Books(ctx context.Context, args struct {
+	First  int32
+	After  *string
+	Filter *bookFilter
+}) (*connection[*bookResolver], error) {
+	offset, first, err := connectionArgs{args.First, args.After}.window()
+	if err != nil {
+		return nil, err
+	}
+	filters, err := args.Filter.query()
+	if err != nil {
+		return nil, err
+	}
+
+	db := loadersFrom(ctx).db
+	books, hasNext, err := listPage[models.Book](utils.FilterBooks(db, filters).Order("books.id"), offset, first)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	count := func() (int64, error) {
+		var total int64
+		err := utils.FilterBooks(db.Model(&models.Book{}), filters).Count(&total).Error
+		return total, err
+	}
+	return newConnection(books, offset, hasNext, count, func(book *models.Book) *bookResolver {
+		return &bookResolver{book}
+	}), nil
+}
+
+func (r *Resolver) Review(ctx context.Context, args struct{ ID graphql.ID }) (*reviewResolver, error) {
+	id, err := parseID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	var review models.Review
+	if err := loadersFrom(ctx).db.First(&review, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, serviceError(err)
+	}
+	return &reviewResolver{&review}, nil
+}
+
+type authorResolver struct {
+	author *models.Author
+}
+
+func (r *authorResolver) ID() graphql.ID {
+	return formatID(r.author.ID)
+}
+
+func (r *authorResolver) Name() string {
+	return r.author.Name
+}
+
+func (r *authorResolver) Biography() string {
+	return r.author.Biography
+}
+
+func (r *authorResolver) BirthDate() *graphql.Time {
+	if r.author.BirthDate.IsZero() {
+		return nil
+	}
+	return &graphql.Time{Time: r.author.BirthDate}
+}
+
+func (r *authorResolver) Books(ctx context.Context, args connectionArgs) (*connection[*bookResolver], error) {
+	offset, first, err := args.window()
+	if err != nil {
+		return nil, err
+	}
+
+	l := loadersFrom(ctx)
+	p, err := l.authorBooks.Load(pageKey{ParentID: r.author.ID, Offset: offset, First: first})
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	count := func() (int64, error) {
+		return l.bookCounts.Load(r.author.ID)
+	}
+	return newConnection(p.Items, offset, p.HasNext, count, func(book *models.Book) *bookResolver {
+		return &bookResolver{book}
+	}), nil
+}
+
+type bookResolver struct {
+	book *models.Book
+}
+
+func (r *bookResolver) ID() graphql.ID {
+	return formatID(r.book.ID)
+}
+
+func (r *bookResolver) Title() string {
+	return r.book.Title
+}
+
+func (r *bookResolver) ISBN() string {
+	return r.book.ISBN
+}
+
+func (r *bookResolver) PublicationYear() int32 {
+	return int32(r.book.PublicationYear)
+}
+
+func (r *bookResolver) Description() string {
+	return r.book.Description
+}
+
+func (r *bookResolver) Format() string {
+	return r.book.Format
+}
+
+func (r *bookResolver) Language() string {
+	return r.book.Language
+}
+
+func (r *bookResolver) PageCount() int32 {
+	return int32(r.book.PageCount)
+}
+
+func (r *bookResolver) EditionNumber() int32 {
+	return int32(r.book.EditionNumber)
+}
+
+func (r *bookResolver) CoverURL() *string {
+	if r.book.CoverURL == "" {
+		return nil
+	}
+	return &r.book.CoverURL
+}
+
+func (r *bookResolver) WorkID() graphql.ID {
+	return formatID(r.book.WorkID)
+}
+
+func (r *bookResolver) Author(ctx context.Context) (*authorResolver, error) {
+	author, err := loadersFrom(ctx).authors.Load(r.book.AuthorID)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	if author == nil {
+		return nil, &Error{Code: CodeNotFound, Message: "author not found"}
+	}
+	return &authorResolver{author}, nil
+}
+
+func (r *bookResolver) Reviews(ctx context.Context, args connectionArgs) (*connection[*reviewResolver], error) {
+	offset, first, err := args.window()
+	if err != nil {
+		return nil, err
+	}
+
+	l := loadersFrom(ctx)
+	p, err := l.workReviews.Load(pageKey{ParentID: r.book.WorkID, Offset: offset, First: first})
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	count := func() (int64, error) {
+		return l.reviewCounts.Load(r.book.WorkID)
+	}
+	return newConnection(p.Items, offset, p.HasNext, count, func(review *models.Review) *reviewResolver {
+		return &reviewResolver{review}
+	}), nil
+}
+
+func (r *bookResolver) Rating(ctx context.Context) (*ratingResolver, error) {
+	rating, err := loadersFrom(ctx).ratings.Load(r.book.WorkID)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	return &ratingResolver{rating}, nil
+}
+
+type reviewResolver struct {
+	review *models.Review
+}
+
+func (r *reviewResolver) ID() graphql.ID {
+	return formatID(r.review.ID)
+}
+
+func (r *reviewResolver) Rating() int32 {
+	return int32(r.review.Rating)
+}
+
+func (r *reviewResolver) Comment() string {
+	return r.review.Comment
+}
+
+func (r *reviewResolver) DatePosted() graphql.Time {
+	return graphql.Time{Time: r.review.DatePosted}
+}
+
+func (r *reviewResolver) Book(ctx context.Context) (*bookResolver, error) {
+	book, err := loadersFrom(ctx).books.Load(r.review.BookID)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+	if book == nil {
+		return nil, &Error{Code: CodeNotFound, Message: "book not found"}
+	}
+	return &bookResolver{book}, nil
+}
+
+type ratingResolver struct {
+	rating dto.RatingSummary
+}
+
+func (r *ratingResolver) Average() float64 {
+	return r.rating.Average
+}
+
+func (r *ratingResolver) Count() int32 {
+	return int32(r.rating.Count)
+}
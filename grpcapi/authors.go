@@ -0,0 +1,75 @@
+package grpcapi
+
+import (
+	"context"
+	libraryv1 "mentalartsapi/proto/library/v1"
+	"mentalartsapi/services"
+	"mentalartsapi/utils"
+
+	"gorm.io/gorm"
+)
+
+type authorServer struct {
+	libraryv1.UnimplementedAuthorServiceServer
+	db *gorm.DB
+}
+
+func (s *authorServer) CreateAuthor(ctx context.Context, req *libraryv1.CreateAuthorRequest) (*libraryv1.Author, error) {
+	author, err := services.CreateAuthor(s.db.WithContext(ctx), authorRequest(req.GetAuthor()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return authorMessage(author), nil
+}
+
+func (s *authorServer) ListAuthors(ctx context.Context, req *libraryv1.ListAuthorsRequest) (*libraryv1.ListAuthorsResponse, error) {
+	pagination := paginationQuery(req.GetPage(), req.GetPageSize())
+	authors, total, err := services.ListAuthors(s.db.WithContext(ctx), pagination)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	response := &libraryv1.ListAuthorsResponse{
+		Data:       make([]*libraryv1.Author, 0, len(authors)),
+		Pagination: paginationMessage(utils.CreatePaginationResponse(total, pagination)),
+	}
+	for _, author := range authors {
+		response.Data = append(response.Data, authorMessage(author))
+	}
+	return response, nil
+}
+
+func (s *authorServer) GetAuthor(ctx context.Context, req *libraryv1.GetAuthorRequest) (*libraryv1.Author, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	author, err := services.GetAuthor(s.db.WithContext(ctx), id)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return authorMessage(author), nil
+}
+
+func (s *authorServer) UpdateAuthor(ctx context.Context, req *libraryv1.UpdateAuthorRequest) (*libraryv1.Author, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	author, err := services.UpdateAuthor(s.db.WithContext(ctx), id, authorRequest(req.GetAuthor()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return authorMessage(author), nil
+}
+
+func (s *authorServer) DeleteAuthor(ctx context.Context, req *libraryv1.DeleteAuthorRequest) (*libraryv1.DeleteResponse, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if err := services.DeleteAuthor(s.db.WithContext(ctx), id); err != nil {
+		return nil, statusError(err)
+	}
+	return &libraryv1.DeleteResponse{Message: "author deleted successfully"}, nil
+}
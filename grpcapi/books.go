@@ -0,0 +1,102 @@
+package grpcapi
+
+import (
+	"context"
+	"mentalartsapi/dto"
+	libraryv1 "mentalartsapi/proto/library/v1"
+	"mentalartsapi/services"
+	"mentalartsapi/utils"
+
+	"gorm.io/gorm"
+)
+
+type bookServer struct {
+	libraryv1.UnimplementedBookServiceServer
+	db *gorm.DB
+}
+
+func (s *bookServer) CreateBook(ctx context.Context, req *libraryv1.CreateBookRequest) (*libraryv1.Book, error) {
+	request, err := bookRequest(req.GetBook())
+	if err != nil {
+		return nil, err
+	}
+	book, err := services.CreateBook(s.db.WithContext(ctx), request)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return bookMessage(book), nil
+}
+
+func (s *bookServer) ListBooks(ctx context.Context, req *libraryv1.ListBooksRequest) (*libraryv1.ListBooksResponse, error) {
+	filters := dto.BookFilterQuery{
+		Query:    req.GetQ(),
+		Format:   req.GetBookFormat(),
+		Language: req.GetLanguage(),
+		YearFrom: int(req.GetYearFrom()),
+		YearTo:   int(req.GetYearTo()),
+	}
+	var err error
+	if filters.AuthorID, err = parseID("author_id", req.GetAuthorId()); err != nil {
+		return nil, err
+	}
+	if filters.WorkID, err = parseID("work_id", req.GetWorkId()); err != nil {
+		return nil, err
+	}
+	if filters.PublisherID, err = parseID("publisher_id", req.GetPublisherId()); err != nil {
+		return nil, err
+	}
+	pagination := paginationQuery(req.GetPage(), req.GetPageSize())
+
+	books, total, err := services.ListBooks(s.db.WithContext(ctx), filters, pagination)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	response := &libraryv1.ListBooksResponse{
+		Data:       make([]*libraryv1.Book, 0, len(books)),
+		Pagination: paginationMessage(utils.CreatePaginationResponse(total, pagination)),
+	}
+	for _, book := range books {
+		response.Data = append(response.Data, bookMessage(book))
+	}
+	return response, nil
+}
+
+func (s *bookServer) GetBook(ctx context.Context, req *libraryv1.GetBookRequest) (*libraryv1.BookDetails, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	book, err := services.GetBook(s.db.WithContext(ctx), id)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return bookDetailsMessage(book), nil
+}
+
+func (s *bookServer) UpdateBook(ctx context.Context, req *libraryv1.UpdateBookRequest) (*libraryv1.Book, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	request, err := bookRequest(req.GetBook())
+	if err != nil {
+		return nil, err
+	}
+	book, err := services.UpdateBook(s.db.WithContext(ctx), id, request)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return bookMessage(book), nil
+}
+
+func (s *bookServer) DeleteBook(ctx context.Context, req *libraryv1.DeleteBookRequest) (*libraryv1.DeleteResponse, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if err := services.DeleteBook(s.db.WithContext(ctx), id); err != nil {
+		return nil, statusError(err)
+	}
+	return &libraryv1.DeleteResponse{Message: "book deleted successfully"}, nil
+}
@@ -0,0 +1,175 @@
+package grpcapi
+
+import (
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"mentalartsapi/models"
+	libraryv1 "mentalartsapi/proto/library/v1"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// idString returns an ID in the form of the REST API, and the zero ID,
+// which refers to nothing, as ""
+func idString(id ids.ID) string {
+	if id == 0 {
+		return ""
+	}
+	return id.String()
+}
+
+// parseID parses an ID of a request in the form of the REST API, so that
+// sequential IDs are rejected while public IDs are enabled. An empty ID is
+// the zero ID.
+func parseID(field, s string) (ids.ID, error) {
+	var id ids.ID
+	if err := id.UnmarshalParam(s); err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "%s: %v", field, err)
+	}
+	return id, nil
+}
+
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func toTime(t *timestamppb.Timestamp) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return t.AsTime()
+}
+
+func authorMessage(author models.Author) *libraryv1.Author {
+	message := &libraryv1.Author{
+		Id:        idString(author.ID),
+		Name:      author.Name,
+		Biography: author.Biography,
+		BirthDate: timestamp(author.BirthDate),
+		CreatedAt: timestamp(author.CreatedAt),
+		UpdatedAt: timestamp(author.UpdatedAt),
+	}
+	for _, book := range author.Books {
+		message.Books = append(message.Books, bookMessage(book))
+	}
+	return message
+}
+
+func bookMessage(book models.Book) *libraryv1.Book {
+	message := &libraryv1.Book{
+		Id:              idString(book.ID),
+		Title:           book.Title,
+		Isbn:            book.ISBN,
+		PublicationYear: int32(book.PublicationYear),
+		Description:     book.Description,
+		Format:          book.Format,
+		Language:        book.Language,
+		PageCount:       int32(book.PageCount),
+		EditionNumber:   int32(book.EditionNumber),
+		AuthorId:        idString(book.AuthorID),
+		WorkId:          idString(book.WorkID),
+		CoverUrl:        book.CoverURL,
+		CreatedAt:       timestamp(book.CreatedAt),
+		UpdatedAt:       timestamp(book.UpdatedAt),
+	}
+	// The author is only loaded when the query preloads it
+	if book.Author.ID != 0 {
+		message.Author = authorMessage(book.Author)
+	}
+	if book.PublisherID != nil {
+		id := idString(*book.PublisherID)
+		message.PublisherId = &id
+	}
+	if book.Publisher != nil {
+		message.Publisher = &libraryv1.Publisher{
+			Id:      idString(book.Publisher.ID),
+			Name:    book.Publisher.Name,
+			Country: book.Publisher.Country,
+			Website: book.Publisher.Website,
+		}
+	}
+	return message
+}
+
+func bookDetailsMessage(response dto.BookResponse) *libraryv1.BookDetails {
+	message := &libraryv1.BookDetails{
+		Book:   bookMessage(response.Book),
+		Rating: &libraryv1.Rating{Average: response.Rating.Average, Count: response.Rating.Count},
+	}
+	for _, edition := range response.Editions {
+		message.Editions = append(message.Editions, bookMessage(edition))
+	}
+	for _, review := range response.Reviews {
+		message.Reviews = append(message.Reviews, reviewMessage(review))
+	}
+	return message
+}
+
+func reviewMessage(review models.Review) *libraryv1.Review {
+	return &libraryv1.Review{
+		Id:         idString(review.ID),
+		Rating:     int32(review.Rating),
+		Comment:    review.Comment,
+		DatePosted: timestamp(review.DatePosted),
+		WorkId:     idString(review.WorkID),
+		BookId:     idString(review.BookID),
+		CreatedAt:  timestamp(review.CreatedAt),
+		UpdatedAt:  timestamp(review.UpdatedAt),
+	}
+}
+
+func paginationMessage(pagination dto.Pagination) *libraryv1.Pagination {
+	return &libraryv1.Pagination{
+		TotalRecords: pagination.TotalRecords,
+		TotalPages:   int32(pagination.TotalPages),
+		Page:         int32(pagination.Page),
+		PageSize:     int32(pagination.PageSize),
+		HasMore:      pagination.HasMore,
+	}
+}
+
+func authorRequest(input *libraryv1.AuthorInput) dto.AuthorRequest {
+	return dto.AuthorRequest{
+		Name:      input.GetName(),
+		Biography: input.GetBiography(),
+		BirthDate: toTime(input.GetBirthDate()),
+	}
+}
+
+func bookRequest(input *libraryv1.BookInput) (dto.BookRequest, error) {
+	request := dto.BookRequest{
+		Title:           input.GetTitle(),
+		ISBN:            input.GetIsbn(),
+		PublicationYear: int(input.GetPublicationYear()),
+		Description:     input.GetDescription(),
+		Format:          input.GetFormat(),
+		Language:        input.GetLanguage(),
+		PageCount:       int(input.GetPageCount()),
+		EditionNumber:   int(input.GetEditionNumber()),
+	}
+	var err error
+	if request.AuthorID, err = parseID("author_id", input.GetAuthorId()); err != nil {
+		return request, err
+	}
+	if request.WorkID, err = parseID("work_id", input.GetWorkId()); err != nil {
+		return request, err
+	}
+	if input.PublisherId != nil {
+		id, err := parseID("publisher_id", input.GetPublisherId())
+		if err != nil {
+			return request, err
+		}
+		request.PublisherID = &id
+	}
+	return request, nil
+}
+
+func reviewRequest(input *libraryv1.ReviewInput) dto.ReviewRequest {
+	return dto.ReviewRequest{Rating: int(input.GetRating()), Comment: input.GetComment()}
+}
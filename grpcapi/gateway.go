@@ -0,0 +1,45 @@
+package grpcapi
+
+import (
+	"context"
+	"mentalartsapi/middleware"
+	libraryv1 "mentalartsapi/proto/library/v1"
+	"net/http"
+	"net/textproto"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// NewGateway returns an HTTP handler that maps JSON requests on the routes
+// annotated in the proto file to calls to the gRPC server at endpoint
+func NewGateway(ctx context.Context, endpoint string) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		// Use the snake_case field names of the REST API
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions:   protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+		// Forward the header that selects the tenant
+		runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+			if textproto.CanonicalMIMEHeaderKey(key) == textproto.CanonicalMIMEHeaderKey(middleware.TenantHeader) {
+				return key, true
+			}
+			return runtime.DefaultHeaderMatcher(key)
+		}),
+	)
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	for _, register := range []func(context.Context, *runtime.ServeMux, string, []grpc.DialOption) error{
+		libraryv1.RegisterAuthorServiceHandlerFromEndpoint,
+		libraryv1.RegisterBookServiceHandlerFromEndpoint,
+		libraryv1.RegisterReviewServiceHandlerFromEndpoint,
+	} {
+		if err := register(ctx, mux, endpoint, opts); err != nil {
+			return nil, err
+		}
+	}
+	return mux, nil
+}
@@ -0,0 +1,71 @@
+package grpcapi
+
+import (
+	"context"
+	libraryv1 "mentalartsapi/proto/library/v1"
+	"mentalartsapi/services"
+	"mentalartsapi/utils"
+
+	"gorm.io/gorm"
+)
+
+type reviewServer struct {
+	libraryv1.UnimplementedReviewServiceServer
+	db *gorm.DB
+}
+
+func (s *reviewServer) ListBookReviews(ctx context.Context, req *libraryv1.ListBookReviewsRequest) (*libraryv1.ListReviewsResponse, error) {
+	bookID, err := parseID("book_id", req.GetBookId())
+	if err != nil {
+		return nil, err
+	}
+	pagination := paginationQuery(req.GetPage(), req.GetPageSize())
+	reviews, total, err := services.ListBookReviews(s.db.WithContext(ctx), bookID, pagination)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	response := &libraryv1.ListReviewsResponse{
+		Data:       make([]*libraryv1.Review, 0, len(reviews)),
+		Pagination: paginationMessage(utils.CreatePaginationResponse(total, pagination)),
+	}
+	for _, review := range reviews {
+		response.Data = append(response.Data, reviewMessage(review))
+	}
+	return response, nil
+}
+
+func (s *reviewServer) CreateReview(ctx context.Context, req *libraryv1.CreateReviewRequest) (*libraryv1.Review, error) {
+	bookID, err := parseID("book_id", req.GetBookId())
+	if err != nil {
+		return nil, err
+	}
+	review, err := services.CreateReview(s.db.WithContext(ctx), bookID, reviewRequest(req.GetReview()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return reviewMessage(review), nil
+}
+
+func (s *reviewServer) UpdateReview(ctx context.Context, req *libraryv1.UpdateReviewRequest) (*libraryv1.Review, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	review, err := services.UpdateReview(s.db.WithContext(ctx), id, reviewRequest(req.GetReview()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return reviewMessage(review), nil
+}
+
+func (s *reviewServer) DeleteReview(ctx context.Context, req *libraryv1.DeleteReviewRequest) (*libraryv1.DeleteResponse, error) {
+	id, err := parseID("id", req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	if err := services.DeleteReview(s.db.WithContext(ctx), id); err != nil {
+		return nil, statusError(err)
+	}
+	return &libraryv1.DeleteResponse{Message: "review deleted successfully"}, nil
+}
@@ -0,0 +1,103 @@
+// Package grpcapi serves the gRPC API defined in proto/library/v1. Its
+// services call the same business logic as the REST handlers, and resolve
+// the tenant of a call from its metadata with the rules of the REST API.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"mentalartsapi/dto"
+	"mentalartsapi/middleware"
+	libraryv1 "mentalartsapi/proto/library/v1"
+	"mentalartsapi/services"
+	"mentalartsapi/tenancy"
+	"mentalartsapi/utils"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// NewServer returns a gRPC server with the author, book and review services
+// registered
+func NewServer(db *gorm.DB, config middleware.TenantConfig) *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(tenantInterceptor(db, config)))
+
+	libraryv1.RegisterAuthorServiceServer(server, &authorServer{db: db})
+	libraryv1.RegisterBookServiceServer(server, &bookServer{db: db})
+	libraryv1.RegisterReviewServiceServer(server, &reviewServer{db: db})
+
+	// Lets tools such as grpcurl discover the services
+	reflection.Register(server)
+	return server
+}
+
+// tenantInterceptor resolves the tenant of a call from the x-tenant-id and
+// authorization metadata or the authority, like the Tenant middleware does
+// from HTTP headers, and scopes the call's context to it
+func tenantInterceptor(db *gorm.DB, config middleware.TenantConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		header := func(name string) string {
+			if values := md.Get(name); len(values) > 0 {
+				return values[0]
+			}
+			return ""
+		}
+
+		// Calls proxied by the gateway carry the host the client asked for
+		host := header("x-forwarded-host")
+		if host == "" {
+			host = header(":authority")
+		}
+
+		tenant, err := middleware.LookupTenant(db.WithContext(ctx), config, header, host)
+		if err != nil {
+			return nil, status.Error(tenantErrorCode(err), err.Error())
+		}
+		return handler(tenancy.WithTenant(ctx, uint(tenant.ID)), req)
+	}
+}
+
+func tenantErrorCode(err error) codes.Code {
+	switch middleware.TenantErrorStatus(err) {
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
+	}
+	return codes.Internal
+}
+
+// statusError converts a service error to a gRPC status with the code
+// matching its kind
+func statusError(err error) error {
+	var serviceErr *services.Error
+	if !errors.As(err, &serviceErr) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if errors.Is(err, services.ErrNotFound) {
+		return status.Error(codes.NotFound, serviceErr.Message)
+	}
+	return status.Error(codes.InvalidArgument, serviceErr.Message)
+}
+
+// paginationQuery applies the defaults and limits of the REST list endpoints
+func paginationQuery(page, pageSize int32) dto.PaginationQuery {
+	pagination := dto.PaginationQuery{Page: utils.DefaultPage, PageSize: utils.DefaultPageSize}
+	if page > 0 {
+		pagination.Page = int(page)
+	}
+	if pageSize > 0 {
+		pagination.PageSize = min(int(pageSize), 100)
+	}
+	return pagination
+}
@@ -0,0 +1,159 @@
+package grpcapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"mentalartsapi/ids"
+	"mentalartsapi/middleware"
+	"mentalartsapi/models"
+	libraryv1 "mentalartsapi/proto/library/v1"
+	"mentalartsapi/tenancy"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Tenant{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, slug := range []string{"a", "b"} {
+		if err := db.Create(&models.Tenant{Name: slug, Slug: slug, Active: true}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func signToken(secret, tenant string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"tenant":"` + tenant + `"}`))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestTenantInterceptor(t *testing.T) {
+	db := testDB(t)
+	withToken := middleware.TenantConfig{TokenSecret: "secret", BaseDomain: "books.example.com", DefaultTenant: "a"}
+	untrusted := middleware.TenantConfig{BaseDomain: "books.example.com", DefaultTenant: "a"}
+
+	tests := []struct {
+		name       string
+		config     middleware.TenantConfig
+		metadata   []string
+		wantCode   codes.Code
+		wantTenant uint
+	}{
+		{name: "token", config: withToken, metadata: []string{"authorization", "Bearer " + signToken("secret", "b")}, wantTenant: 2},
+		{name: "no token and other tenant's metadata", config: withToken, metadata: []string{"x-tenant-id", "b"}, wantCode: codes.Unauthenticated},
+		{name: "no token and other tenant's host", config: withToken, metadata: []string{"x-forwarded-host", "b.books.example.com"}, wantCode: codes.Unauthenticated},
+		{
+			name:     "token and other tenant's metadata",
+			config:   withToken,
+			metadata: []string{"authorization", "Bearer " + signToken("secret", "a"), "x-tenant-id", "b"},
+			wantCode: codes.PermissionDenied,
+		},
+		{name: "untrusted metadata", config: untrusted, metadata: []string{"x-tenant-id", "b"}, wantCode: codes.PermissionDenied},
+		{name: "default tenant", config: untrusted, wantTenant: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tt.metadata...))
+			var tenantID uint
+			_, err := tenantInterceptor(db, tt.config)(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				tenantID, _ = tenancy.FromContext(ctx)
+				return nil, nil
+			})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("code = %v, want %v: %v", code, tt.wantCode, err)
+			}
+			if tenantID != tt.wantTenant {
+				t.Errorf("tenant = %d, want %d", tenantID, tt.wantTenant)
+			}
+		})
+	}
+}
+
+// TestPublicIDs exposes IDs in their public form and rejects sequential
+// ones while public IDs are enabled
+func TestPublicIDs(t *testing.T) {
+	codec, err := ids.NewHashids("salt", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids.Use(codec)
+	defer ids.Use(nil)
+
+	db := testDB(t)
+	if err := db.AutoMigrate(&models.Author{}, &models.Publisher{}, &models.Work{}, &models.Book{}); err != nil {
+		t.Fatal(err)
+	}
+	authors := &authorServer{db: db}
+	books := &bookServer{db: db}
+	ctx := context.Background()
+
+	author, err := authors.CreateAuthor(ctx, &libraryv1.CreateAuthorRequest{Author: &libraryv1.AuthorInput{Name: "Octavia E. Butler"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := ids.ID(1).String(); author.GetId() != want {
+		t.Fatalf("author id = %q, want the public ID %q", author.GetId(), want)
+	}
+	if _, err := authors.GetAuthor(ctx, &libraryv1.GetAuthorRequest{Id: author.GetId()}); err != nil {
+		t.Errorf("GetAuthor by public ID: %v", err)
+	}
+
+	book, err := books.CreateBook(ctx, &libraryv1.CreateBookRequest{Book: &libraryv1.BookInput{
+		Title: "Kindred", Isbn: "9780807083697", AuthorId: author.GetId(),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.GetAuthorId() != author.GetId() || book.GetWorkId() == "" || book.GetWorkId() == "1" {
+		t.Errorf("book author_id = %q, work_id = %q, want public IDs", book.GetAuthorId(), book.GetWorkId())
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "get", call: func() error {
+			_, err := authors.GetAuthor(ctx, &libraryv1.GetAuthorRequest{Id: "1"})
+			return err
+		}},
+		{name: "reference", call: func() error {
+			_, err := books.CreateBook(ctx, &libraryv1.CreateBookRequest{Book: &libraryv1.BookInput{Title: "Dawn", Isbn: "9780446603775", AuthorId: "1"}})
+			return err
+		}},
+		{name: "filter", call: func() error {
+			_, err := books.ListBooks(ctx, &libraryv1.ListBooksRequest{AuthorId: "1"})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run("sequential id in "+tt.name, func(t *testing.T) {
+			if code := status.Code(tt.call()); code != codes.InvalidArgument {
+				t.Errorf("code = %v, want %v", code, codes.InvalidArgument)
+			}
+		})
+	}
+}
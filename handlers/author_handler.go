@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"encoding/json"
+	"mentalartsapi/cache"
+	"mentalartsapi/content"
 	"mentalartsapi/dto"
 	"mentalartsapi/models"
+	"mentalartsapi/services"
 	"mentalartsapi/utils"
 	"net/http"
 
@@ -16,6 +20,16 @@ func InitDB(database *gorm.DB) {
 	db = database
 }
 
+// dbFor returns the database handle bound to the request context, which
+// scopes every query to the tenant resolved for the request. Operations of
+// a batch get the transaction of the batch.
+func dbFor(c *gin.Context) *gorm.DB {
+	if tx, ok := c.Request.Context().Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(c.Request.Context())
+	}
+	return db.WithContext(c.Request.Context())
+}
+
 // CreateAuthor godoc
 // @Summary Create a new author
 // @Description Create a new author with the input payload
@@ -23,30 +37,30 @@ func InitDB(database *gorm.DB) {
 // @Accept json
 // @Produce json
 // @Param author body dto.AuthorRequest true "Author data"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
 // @Success 201 {object} models.Author
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/authors [post]
 func CreateAuthor(c *gin.Context) {
 	var authorRequest dto.AuthorRequest
-	var author models.Author
 
-	if err := c.ShouldBindJSON(&authorRequest); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	if err := content.Bind(c, &authorRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	author.Name = authorRequest.Name
-	author.Biography = authorRequest.Biography
-	author.BirthDate = authorRequest.BirthDate
-
-	result := db.Create(&author)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: result.Error.Error()})
+	author, err := services.CreateAuthor(dbFor(c), authorRequest)
+	if err != nil {
+		renderServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, author)
+	content.Render(c, http.StatusCreated, author)
 }
 
 // GetAllAuthors godoc
@@ -57,39 +71,50 @@ func CreateAuthor(c *gin.Context) {
 // @Produce json
 // @Param page query int false "Page number"
 // @Param page_size query int false "Page size"
-// @Success 200 {object} map[string]interface{}
+// @Param fields query string false "Comma separated fields to return, e.g. name,birth_date"
+// @Param include query string false "Comma separated relations to expand: books (default)"
+// @Param limit[books] query int false "Books per author, 20 by default"
+// @Success 200 {object} dto.AuthorList
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/authors [get]
 func GetAllAuthors(c *gin.Context) {
 	var authors []models.Author
 	var totalCount int64
 
-	pagination := utils.ParsePaginationQuery(c)
-	
-	// Count total records
-	if err := db.Model(&models.Author{}).Count(&totalCount).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
-		return
-	}
-
-	// Get paginated authors with their books
-	if err := utils.Paginate(db, &pagination).
-		Preload("Books").
-		Find(&authors).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	fieldset, err := authorFieldset(c)
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Create pagination response
-	paginationResponse := utils.CreatePaginationResponse(totalCount, pagination)
-
-	// Create final response
-	response := gin.H{
-		"data":       authors,
-		"pagination": paginationResponse,
-	}
+	pagination := utils.ParsePaginationQuery(c)
 
-	c.JSON(http.StatusOK, response)
+	renderCached(c, func() (json.RawMessage, []string, error) {
+		// Count total records
+		if err := dbFor(c).Model(&models.Author{}).Count(&totalCount).Error; err != nil {
+			return nil, nil, err
+		}
+
+		// Get paginated authors with their books
+		if err := utils.Paginate(authorQuery(dbFor(c), fieldset), &pagination).
+			Find(&authors).Error; err != nil {
+			return nil, nil, err
+		}
+
+		response := dto.AuthorList{
+			Data:       authors,
+			Pagination: utils.CreatePaginationResponse(totalCount, pagination),
+		}
+
+		tags := []string{"authors"}
+		for _, author := range authors {
+			tags = append(tags, authorCacheTags(author, fieldset)...)
+		}
+		data, err := fieldset.FilterList(response)
+		return data, tags, err
+	})
 }
 
 // GetAuthor godoc
@@ -98,20 +123,38 @@ func GetAllAuthors(c *gin.Context) {
 // @Tags authors
 // @Accept json
 // @Produce json
-// @Param id path int true "Author ID"
+// @Param id path string true "Author ID"
+// @Param fields query string false "Comma separated fields to return, e.g. name,birth_date"
+// @Param include query string false "Comma separated relations to expand: books (default)"
+// @Param limit[books] query int false "Books to return, 20 by default"
 // @Success 200 {object} models.Author
+// @Failure 400 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/authors/{id} [get]
 func GetAuthor(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
 	var author models.Author
 
-	if err := db.Preload("Books").First(&author, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "author not found"})
+	fieldset, err := authorFieldset(c)
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, author)
+	renderCached(c, func() (json.RawMessage, []string, error) {
+		if err := authorQuery(dbFor(c), fieldset).First(&author, id).Error; err != nil {
+			return nil, nil, services.LookupError(err, "author")
+		}
+
+		data, err := fieldset.Filter(author)
+		return data, authorCacheTags(author, fieldset), err
+	})
 }
 
 // UpdateAuthor godoc
@@ -120,38 +163,34 @@ func GetAuthor(c *gin.Context) {
 // @Tags authors
 // @Accept json
 // @Produce json
-// @Param id path int true "Author ID"
+// @Param id path string true "Author ID"
 // @Param author body dto.AuthorRequest true "Author data"
 // @Success 200 {object} models.Author
 // @Failure 404 {object} dto.ErrorResponse
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/authors/{id} [put]
 func UpdateAuthor(c *gin.Context) {
-	id := c.Param("id")
-	var authorRequest dto.AuthorRequest
-	var author models.Author
-
-	if err := db.First(&author, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "author not found"})
+	id, ok := pathID(c, "id")
+	if !ok {
 		return
 	}
 
-	if err := c.ShouldBindJSON(&authorRequest); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	var authorRequest dto.AuthorRequest
+
+	if err := content.Bind(c, &authorRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	author.Name = authorRequest.Name
-	author.Biography = authorRequest.Biography
-	author.BirthDate = authorRequest.BirthDate
-
-	if err := db.Save(&author).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "internal server error"})
+	author, err := services.UpdateAuthor(dbFor(c), id, authorRequest)
+	if err != nil {
+		renderServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, author)
+	content.Render(c, http.StatusOK, author)
 }
 
 // DeleteAuthor godoc
@@ -160,24 +199,51 @@ func UpdateAuthor(c *gin.Context) {
 // @Tags authors
 // @Accept json
 // @Produce json
-// @Param id path int true "Author ID"
+// @Param id path string true "Author ID"
 // @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/authors/{id} [delete]
 func DeleteAuthor(c *gin.Context) {
-	id := c.Param("id")
-	var author models.Author
-
-	if err := db.First(&author, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: err.Error()})
+	id, ok := pathID(c, "id")
+	if !ok {
 		return
 	}
 
-	if err := db.Delete(&author).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	if err := services.DeleteAuthor(dbFor(c), id); err != nil {
+		renderServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.Response{Msg: "author deleted successfully"})
+	content.Render(c, http.StatusOK, dto.Response{Msg: "author deleted successfully"})
+}
+
+func authorFieldset(c *gin.Context) (utils.Fieldset, error) {
+	return utils.ParseFieldset(c, &models.Author{},
+		utils.Relation{Name: "books", Collection: true, Default: true})
+}
+
+// authorCacheTags returns the cache tags of an author shown in a response,
+// with those of their books when they are included
+func authorCacheTags(author models.Author, fieldset utils.Fieldset) []string {
+	tags := []string{cache.Row("authors", author.ID)}
+	if fieldset.Includes("books") {
+		tags = append(tags, cache.Children("authors", author.ID, "books"))
+		for _, book := range author.Books {
+			tags = append(tags, bookCacheTags(book)...)
+		}
+	}
+	return tags
+}
+
+// authorQuery selects the requested author fields and preloads the included
+// relations
+func authorQuery(query *gorm.DB, fieldset utils.Fieldset) *gorm.DB {
+	query = fieldset.Select(query)
+	if fieldset.Includes("books") {
+		query = utils.PreloadLimited(query, "Books", &models.Book{}, "author_id", "id", fieldset.Limit("books"))
+	}
+	return query
 }
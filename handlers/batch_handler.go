@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mentalartsapi/cache"
+	"mentalartsapi/content"
+	"mentalartsapi/dto"
+	"mentalartsapi/metrics"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxBatchOperations limits the size of a batch, which holds a transaction
+// open while it runs
+const maxBatchOperations = 100
+
+// batchPrefix is the path prefix of the routes a batch can call
+const batchPrefix = "/api/v1/"
+
+// Headers of a batch request that are not passed on to its operations,
+// which always send and accept JSON
+var batchSkippedHeaders = []string{"Accept", "Accept-Encoding", "Content-Length", "Content-Type", "Idempotency-Key"}
+
+// batchRoutes are the routes a batch can call, after batchPrefix: the
+// create, read, update and delete routes of the resources. Others, like
+// exports, imports and covers, stream or have effects outside the database
+// that a rollback can't undo. Segments starting with a colon match any
+// segment, including references.
+var batchRoutes = map[string][]string{
+	http.MethodGet: {
+		"authors", "authors/:id",
+		"books", "books/:id", "books/:id/reviews",
+		"works", "works/:id",
+		"publishers", "publishers/:id",
+		"series", "series/:id",
+	},
+	http.MethodPost: {"authors", "books", "books/:id/reviews", "publishers", "series"},
+	http.MethodPut: {
+		"authors/:id", "books/:id", "works/:id", "publishers/:id",
+		"series/:id", "series/:id/books/:book_id", "reviews/:id",
+	},
+	http.MethodDelete: {
+		"authors/:id", "books/:id", "publishers/:id",
+		"series/:id", "series/:id/books/:book_id", "reviews/:id",
+	},
+}
+
+// batchReference matches references to earlier results, e.g. $0.id or
+// $1.data.0.title
+var batchReference = regexp.MustCompile(`\$(\d+)((?:\.\w+)+)`)
+
+// txKey is the request context key of the transaction of a batch
+type txKey struct{}
+
+// errBatchFailed rolls back a batch when one of its operations fails
+var errBatchFailed = errors.New("batch operation failed")
+
+// Batch godoc
+// @Summary Run several operations in one transaction
+// @Description Run requests to the create, read, update and delete routes of the v1 resources in order, in one transaction. Operations may refer to fields of the results of earlier ones, e.g. "author_id": "$0.id". If one fails, none of their changes are kept.
+// @Tags batch
+// @Accept json
+// @Produce json
+// @Param batch body dto.BatchRequest true "Operations"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
+// @Success 200 {object} dto.BatchResponse
+// @Failure 400 {object} dto.BatchResponse
+// @Failure 401 {object} dto.BatchResponse
+// @Failure 404 {object} dto.BatchResponse
+// @Failure 409 {object} dto.BatchResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.BatchResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.BatchResponse
+// @Router /api/v1/batch [post]
+func Batch(router http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var batchRequest dto.BatchRequest
+		if err := content.Bind(c, &batchRequest); err != nil {
+			content.Render(c, content.BindStatus(err), dto.BatchResponse{Error: err.Error()})
+			return
+		}
+		if err := checkBatch(batchRequest.Operations); err != nil {
+			content.Render(c, http.StatusBadRequest, dto.BatchResponse{Error: err.Error()})
+			return
+		}
+
+		// Operations bypass the cache and their invalidations wait for the
+		// transaction to end, as they see changes it has not committed yet.
+		// What they create is only counted if it commits.
+		ctx, flush := cache.Defer(c.Request.Context())
+		ctx, commitMetrics := metrics.Defer(ctx)
+		c.Request = c.Request.WithContext(ctx)
+
+		response := dto.BatchResponse{Results: []dto.BatchResult{}}
+		status := http.StatusOK
+		err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+			var results []interface{}
+			for i, operation := range batchRequest.Operations {
+				result, err := runBatchOperation(c, router, tx, operation, results)
+				if err != nil {
+					status = http.StatusBadRequest
+					response.Error = fmt.Sprintf("operation %d: %v", i, err)
+					return errBatchFailed
+				}
+
+				response.Results = append(response.Results, result)
+				if result.Status >= http.StatusBadRequest {
+					status = result.Status
+					response.Error = fmt.Sprintf("operation %d failed with status %d, no changes were made", i, result.Status)
+					return errBatchFailed
+				}
+
+				var decoded interface{}
+				decoder := json.NewDecoder(bytes.NewReader(result.Body))
+				decoder.UseNumber()
+				decoder.Decode(&decoded)
+				results = append(results, decoded)
+			}
+			return nil
+		})
+		flush()
+		if err == nil {
+			commitMetrics()
+		}
+		if err != nil && !errors.Is(err, errBatchFailed) {
+			content.Render(c, http.StatusInternalServerError, dto.BatchResponse{Error: err.Error()})
+			return
+		}
+
+		content.Render(c, status, response)
+	}
+}
+
+// checkBatch checks the operations of a batch before any of them runs
+func checkBatch(operations []dto.BatchOperation) error {
+	if len(operations) == 0 {
+		return errors.New("a batch needs at least one operation")
+	}
+	if len(operations) > maxBatchOperations {
+		return fmt.Errorf("a batch has at most %d operations", maxBatchOperations)
+	}
+	for i, operation := range operations {
+		path, _, _ := strings.Cut(operation.Path, "?")
+		if !strings.HasPrefix(path, batchPrefix) {
+			return fmt.Errorf("operation %d: path must start with %s", i, batchPrefix)
+		}
+		if path == batchPrefix+"batch" {
+			return fmt.Errorf("operation %d: batches can't be nested", i)
+		}
+		if !batchRoute(operation.Method, strings.TrimPrefix(path, batchPrefix)) {
+			return fmt.Errorf("operation %d: %s %s can't be run in a batch", i, operation.Method, path)
+		}
+	}
+	return nil
+}
+
+// batchRoute reports whether a batch can call method on path
+func batchRoute(method, path string) bool {
+	segments := strings.Split(path, "/")
+	for _, route := range batchRoutes[method] {
+		patterns := strings.Split(route, "/")
+		if len(patterns) != len(segments) {
+			continue
+		}
+		matches := true
+		for i, pattern := range patterns {
+			if segments[i] == "" || (!strings.HasPrefix(pattern, ":") && pattern != segments[i]) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+// runBatchOperation sends an operation through the router as a request of
+// its own, made on behalf of the client of the batch, with tx in its
+// context so that its handler runs in the transaction
+func runBatchOperation(c *gin.Context, router http.Handler, tx *gorm.DB, operation dto.BatchOperation, results []interface{}) (dto.BatchResult, error) {
+	path, err := resolveBatchPath(operation.Path, results)
+	if err != nil {
+		return dto.BatchResult{}, err
+	}
+	body, err := resolveBatchBody(operation.Body, results)
+	if err != nil {
+		return dto.BatchResult{}, err
+	}
+
+	ctx := context.WithValue(c.Request.Context(), txKey{}, tx)
+	request, err := http.NewRequestWithContext(ctx, operation.Method, path, bytes.NewReader(body))
+	if err != nil {
+		return dto.BatchResult{}, err
+	}
+	request.Header = c.Request.Header.Clone()
+	for _, name := range batchSkippedHeaders {
+		request.Header.Del(name)
+	}
+	request.Header.Set("Accept", "application/json")
+	if len(body) > 0 {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	request.Host = c.Request.Host
+	request.RemoteAddr = c.Request.RemoteAddr
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	result := dto.BatchResult{Status: recorder.Code, Body: recorder.Body.Bytes()}
+	if len(result.Body) == 0 {
+		result.Body = nil
+	} else if !json.Valid(result.Body) {
+		result.Body, _ = json.Marshal(recorder.Body.String())
+	}
+	return result, nil
+}
+
+// resolveBatchPath replaces references in a path with the values they
+// refer to
+func resolveBatchPath(path string, results []interface{}) (string, error) {
+	var resolveErr error
+	resolved := batchReference.ReplaceAllStringFunc(path, func(reference string) string {
+		value, err := lookupBatchReference(reference, results)
+		if err != nil {
+			resolveErr = err
+			return reference
+		}
+		switch value := value.(type) {
+		case string:
+			return value
+		case json.Number:
+			return value.String()
+		}
+		resolveErr = fmt.Errorf("%s is not a string or a number", reference)
+		return reference
+	})
+	return resolved, resolveErr
+}
+
+// resolveBatchBody replaces the string values of a body that are references
+// with the values they refer to
+func resolveBatchBody(body json.RawMessage, results []interface{}) ([]byte, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var tree interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	tree, err := resolveBatchValue(tree, results)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+func resolveBatchValue(value interface{}, results []interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		if match := batchReference.FindStringIndex(value); match == nil || match[0] != 0 || match[1] != len(value) {
+			return value, nil
+		}
+		return lookupBatchReference(value, results)
+	case map[string]interface{}:
+		for key, child := range value {
+			resolved, err := resolveBatchValue(child, results)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = resolved
+		}
+	case []interface{}:
+		for i, child := range value {
+			resolved, err := resolveBatchValue(child, results)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = resolved
+		}
+	}
+	return value, nil
+}
+
+// lookupBatchReference returns the value a reference like $0.author.id
+// refers to. Object keys match case-insensitively, so $0.id finds the ID
+// of a record.
+func lookupBatchReference(reference string, results []interface{}) (interface{}, error) {
+	match := batchReference.FindStringSubmatch(reference)
+	index, err := strconv.Atoi(match[1])
+	if err != nil || index >= len(results) {
+		return nil, fmt.Errorf("%s refers to an operation that has not run", reference)
+	}
+
+	value := results[index]
+	for _, name := range strings.Split(match[2][1:], ".") {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			child, ok := node[name]
+			if !ok {
+				for key, candidate := range node {
+					if strings.EqualFold(key, name) {
+						child, ok = candidate, true
+						break
+					}
+				}
+			}
+			if !ok {
+				return nil, fmt.Errorf("%s refers to a field that does not exist", reference)
+			}
+			value = child
+		case []interface{}:
+			i, err := strconv.Atoi(name)
+			if err != nil || i >= len(node) {
+				return nil, fmt.Errorf("%s refers to an element that does not exist", reference)
+			}
+			value = node[i]
+		default:
+			return nil, fmt.Errorf("%s refers to a field that does not exist", reference)
+		}
+	}
+	return value, nil
+}
@@ -1,8 +1,15 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"mentalartsapi/cache"
+	"mentalartsapi/content"
 	"mentalartsapi/dto"
+	"mentalartsapi/marc"
 	"mentalartsapi/models"
+	"mentalartsapi/services"
 	"mentalartsapi/utils"
 	"net/http"
 
@@ -11,112 +18,231 @@ import (
 
 // CreateBook godoc
 // @Summary Create a new book
-// @Description Create a new book with the input payload
+// @Description Create a new edition. Without a work_id a new work is started from the edition's details.
 // @Tags books
 // @Accept json
 // @Produce json
 // @Param book body dto.BookRequest true "Book data"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
 // @Success 201 {object} models.Book
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/books [post]
 func CreateBook(c *gin.Context) {
 	var bookRequest dto.BookRequest
-	var book models.Book
-
-	if err := c.ShouldBindJSON(&bookRequest); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
-		return
-	}
 
-	// Check if author exists
-	var author models.Author
-	if err := db.First(&author, bookRequest.AuthorID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "author not found"})
+	if err := content.Bind(c, &bookRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	book.Title = bookRequest.Title
-	book.ISBN = bookRequest.ISBN
-	book.PublicationYear = bookRequest.PublicationYear
-	book.Description = bookRequest.Description
-	book.AuthorID = bookRequest.AuthorID
-
-	result := db.Create(&book)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: result.Error.Error()})
+	book, err := services.CreateBook(dbFor(c), bookRequest)
+	if err != nil {
+		renderServiceError(c, err)
 		return
 	}
 
-	// Load relations for response
-	db.Preload("Author").First(&book, book.ID)
-
-	c.JSON(http.StatusCreated, book)
+	content.Render(c, http.StatusCreated, book)
 }
 
 // GetAllBooks godoc
 // @Summary Get all books
-// @Description Get all books with pagination
+// @Description Get all books with pagination, optionally filtered
 // @Tags books
 // @Accept json
 // @Produce json
 // @Param page query int false "Page number"
 // @Param page_size query int false "Page size"
-// @Success 200 {object} map[string]interface{}
+// @Param q query string false "Title contains"
+// @Param author_id query string false "Author ID"
+// @Param work_id query string false "Work ID"
+// @Param publisher_id query string false "Publisher ID"
+// @Param book_format query string false "Edition format: hardcover, paperback, ebook or audiobook"
+// @Param language query string false "Language"
+// @Param year_from query int false "Earliest publication year"
+// @Param year_to query int false "Latest publication year"
+// @Param fields query string false "Comma separated fields to return, e.g. title,isbn"
+// @Param include query string false "Comma separated relations to expand: author (default), publisher"
+// @Success 200 {object} dto.BookList
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/books [get]
 func GetAllBooks(c *gin.Context) {
 	var books []models.Book
 	var totalCount int64
+	var filters dto.BookFilterQuery
 
-	pagination := utils.ParsePaginationQuery(c)
-	
-	// Count total records
-	if err := db.Model(&models.Book{}).Count(&totalCount).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Get paginated books with their author
-	if err := utils.Paginate(db, &pagination).
-		Preload("Author").
-		Find(&books).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	fieldset, err := utils.ParseFieldset(c, &models.Book{},
+		utils.Relation{Name: "author", Default: true},
+		utils.Relation{Name: "publisher"})
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// Create pagination response
-	paginationResponse := utils.CreatePaginationResponse(totalCount, pagination)
+	pagination := utils.ParsePaginationQuery(c)
 
-	// Create final response
-	response := gin.H{
-		"data":       books,
-		"pagination": paginationResponse,
-	}
+	renderCached(c, func() (json.RawMessage, []string, error) {
+		// Count total records
+		if err := utils.FilterBooks(dbFor(c).Model(&models.Book{}), filters).Count(&totalCount).Error; err != nil {
+			return nil, nil, err
+		}
+
+		// Get paginated books with the included relations
+		query := fieldset.Select(utils.FilterBooks(dbFor(c), filters), bookRelationColumns...)
+		if fieldset.Includes("author") {
+			query = query.Preload("Author")
+		}
+		if fieldset.Includes("publisher") {
+			query = query.Preload("Publisher")
+		}
+		if err := utils.Paginate(query, &pagination).Find(&books).Error; err != nil {
+			return nil, nil, err
+		}
 
-	c.JSON(http.StatusOK, response)
+		response := dto.BookList{
+			Data:       books,
+			Pagination: utils.CreatePaginationResponse(totalCount, pagination),
+		}
+
+		tags := []string{"books"}
+		for _, book := range books {
+			tags = append(tags, bookCacheTags(book)...)
+		}
+		data, err := fieldset.FilterList(response)
+		return data, tags, err
+	})
 }
 
 // GetBook godoc
 // @Summary Get a book
-// @Description Get a book by ID with author and reviews
+// @Description Get a book by ID with author, publisher, the other editions of its work, the reviews and rating of the work, and links to the previous and next volumes of any series it belongs to
 // @Tags books
 // @Accept json
 // @Produce json
-// @Param id path int true "Book ID"
-// @Success 200 {object} models.Book
+// @Param id path string true "Book ID"
+// @Param format query string false "json (default), marc (MARC21), marcxml or dc (Dublin Core)"
+// @Param fields query string false "Comma separated fields to return, e.g. title,isbn"
+// @Param include query string false "Comma separated relations to expand: author, publisher, reviews, editions, series and rating (all by default)"
+// @Param limit[reviews] query int false "Most recent reviews to return, 20 by default"
+// @Param limit[editions] query int false "Other editions to return, 20 by default"
+// @Success 200 {object} dto.BookResponse
+// @Failure 400 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/books/{id} [get]
 func GetBook(c *gin.Context) {
-	id := c.Param("id")
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
 	var book models.Book
 
-	if err := db.Preload("Author").Preload("Reviews").First(&book, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "book not found"})
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "marc" && format != "marcxml" && format != "dc" {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: "format must be json, marc, marcxml or dc"})
+		return
+	}
+
+	if format != "json" {
+		if err := dbFor(c).Preload("Author").Preload("Publisher").First(&book, id).Error; err != nil {
+			renderServiceError(c, services.LookupError(err, "book"))
+			return
+		}
+		renderBibliographicRecord(c, book, format)
 		return
 	}
 
-	c.JSON(http.StatusOK, book)
+	fieldset, err := utils.ParseFieldset(c, &models.Book{},
+		utils.Relation{Name: "author", Default: true},
+		utils.Relation{Name: "publisher", Default: true},
+		utils.Relation{Name: "reviews", Collection: true, Default: true},
+		utils.Relation{Name: "editions", Collection: true, Default: true},
+		utils.Relation{Name: "series", Default: true},
+		utils.Relation{Name: "rating", Default: true})
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	renderCached(c, func() (json.RawMessage, []string, error) {
+		query := fieldset.Select(dbFor(c), bookRelationColumns...)
+		if fieldset.Includes("author") {
+			query = query.Preload("Author")
+		}
+		if fieldset.Includes("publisher") {
+			query = query.Preload("Publisher")
+		}
+		if err := query.First(&book, id).Error; err != nil {
+			return nil, nil, services.LookupError(err, "book")
+		}
+
+		response := dto.BookResponse{Book: book}
+		tags := bookCacheTags(book)
+
+		// Reviews are shared by every edition of the work, newest first
+		if fieldset.Includes("reviews") {
+			if err := dbFor(c).Where("work_id = ?", book.WorkID).
+				Order("date_posted DESC, id DESC").
+				Limit(fieldset.Limit("reviews")).
+				Find(&response.Reviews).Error; err != nil {
+				return nil, nil, err
+			}
+			tags = append(tags, cache.Children("works", book.WorkID, "reviews"))
+		}
+
+		if fieldset.Includes("editions") {
+			response.Editions = []models.Book{}
+			if err := dbFor(c).Preload("Publisher").
+				Where("work_id = ? AND id <> ?", book.WorkID, book.ID).
+				Order("publication_year, edition_number, id").
+				Limit(fieldset.Limit("editions")).
+				Find(&response.Editions).Error; err != nil {
+				return nil, nil, err
+			}
+			tags = append(tags, cache.Children("works", book.WorkID, "books"))
+			for _, edition := range response.Editions {
+				tags = append(tags, bookCacheTags(edition)...)
+			}
+		}
+
+		if fieldset.Includes("rating") {
+			if response.Rating, err = services.WorkRating(dbFor(c), book.WorkID); err != nil {
+				return nil, nil, err
+			}
+			tags = append(tags, cache.Children("works", book.WorkID, "reviews"))
+		}
+
+		if fieldset.Includes("series") {
+			if response.Series, err = bookSeriesListings(c, book.ID); err != nil {
+				return nil, nil, err
+			}
+			tags = append(tags, cache.Children("books", book.ID, "series"))
+			for _, listing := range response.Series {
+				tags = append(tags, cache.Row("series", listing.SeriesID), cache.Children("series", listing.SeriesID, "books"))
+				for _, volume := range []*dto.SeriesVolume{listing.Previous, listing.Next} {
+					if volume != nil {
+						tags = append(tags, cache.Row("books", volume.BookID))
+					}
+				}
+			}
+		}
+
+		data, err := fieldset.Filter(response)
+		return data, tags, err
+	})
 }
 
 // UpdateBook godoc
@@ -125,49 +251,34 @@ func GetBook(c *gin.Context) {
 // @Tags books
 // @Accept json
 // @Produce json
-// @Param id path int true "Book ID"
+// @Param id path string true "Book ID"
 // @Param book body dto.BookRequest true "Book data"
 // @Success 200 {object} models.Book
 // @Failure 404 {object} dto.ErrorResponse
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/books/{id} [put]
 func UpdateBook(c *gin.Context) {
-	id := c.Param("id")
-	var bookRequest dto.BookRequest
-	var book models.Book
-
-	if err := db.First(&book, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "book not found"})
+	id, ok := pathID(c, "id")
+	if !ok {
 		return
 	}
 
-	if err := c.ShouldBindJSON(&bookRequest); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
-		return
-	}
+	var bookRequest dto.BookRequest
 
-	// Check if author exists
-	if err := db.First(&models.Author{}, bookRequest.AuthorID).Error; err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "author not found"})
+	if err := content.Bind(c, &bookRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	book.Title = bookRequest.Title
-	book.ISBN = bookRequest.ISBN
-	book.PublicationYear = bookRequest.PublicationYear
-	book.Description = bookRequest.Description
-	book.AuthorID = bookRequest.AuthorID
-
-	if err := db.Save(&book).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "internal server error"})
+	book, err := services.UpdateBook(dbFor(c), id, bookRequest)
+	if err != nil {
+		renderServiceError(c, err)
 		return
 	}
 
-	// Load relations for response
-	db.Preload("Author").First(&book, book.ID)
-
-	c.JSON(http.StatusOK, book)
+	content.Render(c, http.StatusOK, book)
 }
 
 // DeleteBook godoc
@@ -176,24 +287,163 @@ func UpdateBook(c *gin.Context) {
 // @Tags books
 // @Accept json
 // @Produce json
-// @Param id path int true "Book ID"
+// @Param id path string true "Book ID"
 // @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/books/{id} [delete]
 func DeleteBook(c *gin.Context) {
-	id := c.Param("id")
-	var book models.Book
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
 
-	if err := db.First(&book, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "book not found"})
+	if err := services.DeleteBook(dbFor(c), id); err != nil {
+		renderServiceError(c, err)
 		return
 	}
 
-	if err := db.Delete(&book).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	content.Render(c, http.StatusOK, dto.Response{Msg: "book deleted successfully"})
+}
+
+// renderBibliographicRecord writes a book as a MARC21, MARCXML or Dublin
+// Core record
+func renderBibliographicRecord(c *gin.Context, book models.Book, format string) {
+	switch format {
+	case "marc":
+		data, err := marc.Marshal(marc.FromBook(book))
+		if err != nil {
+			content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/marc", data)
+	case "marcxml":
+		var buf bytes.Buffer
+		writer := marc.NewXMLWriter(&buf)
+		if err := writer.Write(marc.FromBook(book)); err != nil {
+			content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		writer.Close()
+		c.Data(http.StatusOK, "application/marcxml+xml", buf.Bytes())
+	case "dc":
+		data, err := xml.MarshalIndent(marc.DublinCoreFromBook(book), "", "  ")
+		if err != nil {
+			content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/xml", append([]byte(xml.Header), data...))
+	}
+}
+
+// bookRelationColumns are the foreign keys a sparse book query still selects
+// so that its relations can be loaded
+var bookRelationColumns = []string{"author_id", "work_id", "publisher_id"}
+
+// bookCacheTags returns the cache tags of a book shown in a response: its
+// own and those of the author and publisher it refers to
+func bookCacheTags(book models.Book) []string {
+	tags := []string{cache.Row("books", book.ID), cache.Row("authors", book.AuthorID)}
+	if book.PublisherID != nil {
+		tags = append(tags, cache.Row("publishers", *book.PublisherID))
+	}
+	return tags
+}
+
+// BookActions runs the custom methods of the books collection
+func BookActions(c *gin.Context) {
+	customMethod(c, map[string]gin.HandlerFunc{
+		"bulkCreate": BulkCreateBooks,
+		"bulkUpdate": BulkUpdateBooks,
+		"bulkDelete": BulkDeleteBooks,
+	})
+}
+
+// BulkCreateBooks godoc
+// @Summary Create books in bulk
+// @Description Create up to 500 books, each item being the body of POST /api/v1/books. Every item is validated on its own and reported in the results. In atomic mode, the default, nothing is created unless every item is valid; in partial mode the valid items are created.
+// @Tags books
+// @Accept json
+// @Produce json
+// @Param books body dto.BulkRequest true "Books"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
+// @Success 200 {object} dto.BulkResponse
+// @Success 207 {object} dto.BulkResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.BulkResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/books:bulkCreate [post]
+func BulkCreateBooks(c *gin.Context) {
+	var bulkRequest dto.BulkRequest
+
+	if err := content.Bind(c, &bulkRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.Response{Msg: "book deleted successfully"})
-} 
\ No newline at end of file
+	response, err := services.BulkCreateBooks(dbFor(c), bulkRequest)
+	renderBulk(c, response, err)
+}
+
+// BulkUpdateBooks godoc
+// @Summary Update books in bulk
+// @Description Update up to 500 books, each item being the id of a book and the body of PUT /api/v1/books/{id}. Every item is validated on its own and reported in the results. In atomic mode, the default, nothing is updated unless every item is valid; in partial mode the valid items are updated.
+// @Tags books
+// @Accept json
+// @Produce json
+// @Param books body dto.BulkRequest true "Book updates"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
+// @Success 200 {object} dto.BulkResponse
+// @Success 207 {object} dto.BulkResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.BulkResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/books:bulkUpdate [post]
+func BulkUpdateBooks(c *gin.Context) {
+	var bulkRequest dto.BulkRequest
+
+	if err := content.Bind(c, &bulkRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response, err := services.BulkUpdateBooks(dbFor(c), bulkRequest)
+	renderBulk(c, response, err)
+}
+
+// BulkDeleteBooks godoc
+// @Summary Delete books in bulk
+// @Description Delete up to 500 books by ID. In atomic mode, the default, nothing is deleted unless every book exists; in partial mode the existing books are deleted.
+// @Tags books
+// @Accept json
+// @Produce json
+// @Param books body dto.BulkDeleteRequest true "Book IDs"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
+// @Success 200 {object} dto.BulkResponse
+// @Success 207 {object} dto.BulkResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.BulkResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/books:bulkDelete [post]
+func BulkDeleteBooks(c *gin.Context) {
+	var bulkRequest dto.BulkDeleteRequest
+
+	if err := content.Bind(c, &bulkRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response, err := services.BulkDeleteBooks(dbFor(c), bulkRequest)
+	renderBulk(c, response, err)
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mentalartsapi/cache"
+	"mentalartsapi/content"
+	"mentalartsapi/covers"
+	"mentalartsapi/dto"
+	"mentalartsapi/models"
+	"mentalartsapi/services"
+	"mentalartsapi/storage"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var coverStore storage.Store
+var maxCoverBytes int64 = 5 << 20
+
+// InitCovers sets the store cover images are kept in and the largest
+// accepted upload
+func InitCovers(store storage.Store, maxBytes int64) {
+	coverStore = store
+	if maxBytes > 0 {
+		maxCoverBytes = maxBytes
+	}
+}
+
+// UploadCover godoc
+// @Summary Upload a book cover
+// @Description Upload a JPEG, PNG or WebP cover image as multipart form field "cover". The type is detected from the content, and small, medium and large JPEG thumbnails are generated.
+// @Tags books
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path string true "Book ID"
+// @Param cover formData file true "Cover image"
+// @Success 200 {object} models.Book
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 415 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/books/{id}/cover [put]
+func UploadCover(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var book models.Book
+
+	if coverStore == nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: "cover storage is not configured"})
+		return
+	}
+
+	if err := dbFor(c).First(&book, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "book"))
+		return
+	}
+
+	// Leave some room for the multipart envelope around the image
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCoverBytes+64<<10)
+
+	file, header, err := c.Request.FormFile("cover")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			content.Render(c, http.StatusRequestEntityTooLarge, dto.ErrorResponse{Error: coverTooLargeMessage()})
+			return
+		}
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: "multipart form field \"cover\" is required"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxCoverBytes {
+		content.Render(c, http.StatusRequestEntityTooLarge, dto.ErrorResponse{Error: coverTooLargeMessage()})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxCoverBytes+1))
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if int64(len(data)) > maxCoverBytes {
+		content.Render(c, http.StatusRequestEntityTooLarge, dto.ErrorResponse{Error: coverTooLargeMessage()})
+		return
+	}
+
+	contentType, extension, err := covers.Sniff(data)
+	if err != nil {
+		content.Render(c, http.StatusUnsupportedMediaType, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	thumbnails, err := covers.Thumbnails(data)
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: "cover image could not be decoded: " + err.Error()})
+		return
+	}
+
+	// Every upload gets its own prefix so that caches never serve a stale cover
+	prefix := fmt.Sprintf("covers/%d/%d/%x", book.TenantID, book.ID, time.Now().UnixNano())
+	originalKey := fmt.Sprintf("%s/original.%s", prefix, extension)
+
+	keys := []string{originalKey}
+	if err := coverStore.Put(c.Request.Context(), originalKey, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	thumbnailURLs := make(map[string]string, len(thumbnails))
+	for name, thumbnail := range thumbnails {
+		key := fmt.Sprintf("%s/%s.jpg", prefix, name)
+		keys = append(keys, key)
+		if err := coverStore.Put(c.Request.Context(), key, bytes.NewReader(thumbnail), int64(len(thumbnail)), "image/jpeg"); err != nil {
+			deleteCoverObjects(c, keys)
+			content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		thumbnailURLs[name] = coverStore.URL(key)
+	}
+
+	previousKeys := book.CoverKeys
+	book.CoverURL = coverStore.URL(originalKey)
+	book.CoverThumbnails = thumbnailURLs
+	book.CoverKeys = keys
+
+	if err := dbFor(c).Save(&book).Error; err != nil {
+		deleteCoverObjects(c, keys)
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	cache.Invalidate(c.Request.Context(), cache.Row("books", book.ID))
+	deleteCoverObjects(c, previousKeys)
+
+	content.Render(c, http.StatusOK, book)
+}
+
+// DeleteCover godoc
+// @Summary Delete a book cover
+// @Description Delete the cover image and thumbnails of a book
+// @Tags books
+// @Accept json
+// @Produce json
+// @Param id path string true "Book ID"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/books/{id}/cover [delete]
+func DeleteCover(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var book models.Book
+
+	if err := dbFor(c).First(&book, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "book"))
+		return
+	}
+
+	if book.CoverURL == "" {
+		content.Render(c, http.StatusNotFound, dto.ErrorResponse{Error: "book has no cover"})
+		return
+	}
+
+	keys := book.CoverKeys
+	book.CoverURL = ""
+	book.CoverThumbnails = nil
+	book.CoverKeys = nil
+
+	if err := dbFor(c).Save(&book).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	cache.Invalidate(c.Request.Context(), cache.Row("books", book.ID))
+	deleteCoverObjects(c, keys)
+
+	content.Render(c, http.StatusOK, dto.Response{Msg: "cover deleted successfully"})
+}
+
+// deleteCoverObjects removes stored cover objects on a best-effort basis;
+// an orphaned object is preferable to failing the request
+func deleteCoverObjects(c *gin.Context, keys []string) {
+	if coverStore == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := coverStore.Delete(c.Request.Context(), key); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Could not delete cover object", "key", key, "error", err)
+		}
+	}
+}
+
+func coverTooLargeMessage() string {
+	return fmt.Sprintf("cover must not be larger than %d bytes", maxCoverBytes)
+}
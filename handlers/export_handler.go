@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"mentalartsapi/content"
+	"mentalartsapi/dto"
+	"mentalartsapi/export"
+	"mentalartsapi/models"
+	"mentalartsapi/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushInterval is the number of records written between flushes to
+// the client
+const exportFlushInterval = 500
+
+// exportWriteTimeout is how long each flush of an export may take to reach
+// the client. It replaces the server's write timeout, which would cut off
+// exports that take longer as a whole.
+var exportWriteTimeout time.Duration
+
+// InitExports sets the time each flush of an export may take, or 0 for no
+// limit
+func InitExports(writeTimeout time.Duration) {
+	exportWriteTimeout = writeTimeout
+}
+
+// ExportBooks godoc
+// @Summary Export books
+// @Description Stream all books matching the list filters as CSV, NDJSON or MARCXML, including author, publisher and rating aggregates
+// @Tags export
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/marcxml+xml
+// @Param format query string false "csv (default), ndjson or marcxml"
+// @Param q query string false "Title contains"
+// @Param author_id query string false "Author ID"
+// @Param work_id query string false "Work ID"
+// @Param publisher_id query string false "Publisher ID"
+// @Param book_format query string false "Edition format: hardcover, paperback, ebook or audiobook"
+// @Param language query string false "Language"
+// @Param year_from query int false "Earliest publication year"
+// @Param year_to query int false "Latest publication year"
+// @Success 200 {file} file
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/export/books [get]
+func ExportBooks(c *gin.Context) {
+	var filters dto.BookFilterQuery
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	format := export.Format(c.DefaultQuery("format", string(export.CSV)))
+	writer, err := export.NewWriter(c.Writer, format)
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: "format must be csv, ndjson or marcxml"})
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="books.`+exportExtension(format)+`"`)
+	c.Status(http.StatusOK)
+
+	extendWriteDeadline(c)
+	written := 0
+	query := utils.FilterBooks(dbFor(c).Model(&models.Book{}), filters)
+	err = export.Books(query, func(record export.Record) error {
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushInterval == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+			extendWriteDeadline(c)
+		}
+		return nil
+	})
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		// Once streaming has started the status can't be changed, so the
+		// truncated body is all the client gets
+		if !c.Writer.Written() {
+			// The error is JSON, not a file to download
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		slog.WarnContext(c.Request.Context(), "Export aborted", "records", written, "error", err)
+		c.Abort()
+	}
+}
+
+// extendWriteDeadline gives the export exportWriteTimeout from now to write
+// what comes next
+func extendWriteDeadline(c *gin.Context) {
+	if exportWriteTimeout <= 0 {
+		return
+	}
+	err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		slog.WarnContext(c.Request.Context(), "Could not extend export write deadline", "error", err)
+	}
+}
+
+func exportExtension(format export.Format) string {
+	if format == export.MARCXML {
+		return "xml"
+	}
+	return string(format)
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mentalartsapi/dto"
+	"mentalartsapi/health"
+	"mentalartsapi/ids"
+	"mentalartsapi/middleware"
+	"mentalartsapi/models"
+	"mentalartsapi/tenancy"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// testRouter serves the author, book and review routes and batches from an
+// in-memory database with one connection, as a pool that is never large
+// enough would
+func testRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.Use(tenancy.Plugin{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Migrate(db, "default"); err != nil {
+		t.Fatal(err)
+	}
+	InitDB(db)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	v1 := router.Group("/api/v1")
+	v1.Use(middleware.Negotiate(), middleware.Tenant(db, middleware.TenantConfig{DefaultTenant: "default"}))
+	{
+		v1.POST("/authors", CreateAuthor)
+		v1.GET("/authors", GetAllAuthors)
+		v1.GET("/authors/:id", GetAuthor)
+		v1.PUT("/authors/:id", UpdateAuthor)
+		v1.DELETE("/authors/:id", DeleteAuthor)
+		v1.POST("/books", CreateBook)
+		v1.GET("/books", GetAllBooks)
+		v1.GET("/books/:id", GetBook)
+		v1.GET("/books/:id/reviews", GetBookReviews)
+		v1.POST("/books/:id/reviews", CreateReview)
+		v1.POST("/books:action", BookActions)
+		v1.POST("/batch", Batch(router))
+	}
+	return router, db
+}
+
+func serve(router http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// batch sends a batch with a deadline, so that an operation waiting for a
+// connection the batch holds fails rather than hangs
+func batch(t *testing.T, router http.Handler, operations string) (int, dto.BatchResponse) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/batch", strings.NewReader(`{"operations": [`+operations+`]}`)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response dto.BatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	return w.Code, response
+}
+
+func TestBatchReferences(t *testing.T) {
+	router, _ := testRouter(t)
+	status, response := batch(t, router, `
+		{"method": "POST", "path": "/api/v1/authors", "body": {"name": "Ursula K. Le Guin"}},
+		{"method": "POST", "path": "/api/v1/books", "body": {"title": "A Wizard of Earthsea", "isbn": "9780547773742", "author_id": "$0.id"}},
+		{"method": "GET", "path": "/api/v1/books/$1.id"}`)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %+v", status, response)
+	}
+
+	var author models.Author
+	var book dto.BookResponse
+	json.Unmarshal(response.Results[0].Body, &author)
+	json.Unmarshal(response.Results[2].Body, &book)
+	if book.Title != "A Wizard of Earthsea" || book.AuthorID != author.ID {
+		t.Errorf("book = %+v, want A Wizard of Earthsea by author %v", book, author.ID)
+	}
+}
+
+func TestBatchRollback(t *testing.T) {
+	router, db := testRouter(t)
+	status, response := batch(t, router, `
+		{"method": "POST", "path": "/api/v1/authors", "body": {"name": "Ursula K. Le Guin"}},
+		{"method": "POST", "path": "/api/v1/books", "body": {"isbn": "9780547773742", "author_id": "$0.id"}}`)
+	if status != http.StatusBadRequest || len(response.Results) != 2 {
+		t.Fatalf("status = %d, results = %d, want 400 after 2 operations", status, len(response.Results))
+	}
+	if want := "operation 1 failed with status 400, no changes were made"; response.Error != want {
+		t.Errorf("error = %q, want %q", response.Error, want)
+	}
+
+	var authors int64
+	db.Model(&models.Author{}).Count(&authors)
+	if authors != 0 {
+		t.Errorf("%d authors kept after the batch failed", authors)
+	}
+}
+
+func TestBatchRejected(t *testing.T) {
+	router, db := testRouter(t)
+	author := `{"method": "POST", "path": "/api/v1/authors", "body": {"name": "Ursula K. Le Guin"}}, `
+	tests := []struct {
+		name      string
+		operation string
+		want      string
+	}{
+		{name: "nested", operation: `{"method": "POST", "path": "/api/v1/batch", "body": {"operations": []}}`, want: "operation 1: batches can't be nested"},
+		{name: "action", operation: `{"method": "POST", "path": "/api/v1/books:bulkDelete", "body": {"ids": []}}`, want: "operation 1: POST /api/v1/books:bulkDelete can't be run in a batch"},
+		{name: "export", operation: `{"method": "GET", "path": "/api/v1/export/books?format=csv"}`, want: "operation 1: GET /api/v1/export/books can't be run in a batch"},
+		{name: "import", operation: `{"method": "POST", "path": "/api/v1/import?mode=commit"}`, want: "operation 1: POST /api/v1/import can't be run in a batch"},
+		{name: "cover", operation: `{"method": "DELETE", "path": "/api/v1/books/$0.id/cover"}`, want: "operation 1: DELETE /api/v1/books/$0.id/cover can't be run in a batch"},
+		{name: "admin", operation: `{"method": "DELETE", "path": "/api/v1/admin/tenants/1"}`, want: "operation 1: DELETE /api/v1/admin/tenants/1 can't be run in a batch"},
+		{name: "other version", operation: `{"method": "GET", "path": "/api/v2/books"}`, want: "operation 1: path must start with /api/v1/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, response := batch(t, router, author+tt.operation)
+			if status != http.StatusBadRequest || response.Error != tt.want {
+				t.Errorf("status = %d, error = %q, want 400 and %q", status, response.Error, tt.want)
+			}
+			if len(response.Results) != 0 {
+				t.Errorf("%d operations ran, want none", len(response.Results))
+			}
+		})
+	}
+
+	var authors int64
+	db.Model(&models.Author{}).Count(&authors)
+	if authors != 0 {
+		t.Errorf("%d authors created by rejected batches", authors)
+	}
+}
+
+// TestLookupErrors answers 404 only for missing records, and 500 when they
+// could not be looked up
+func TestLookupErrors(t *testing.T) {
+	router, db := testRouter(t)
+	paths := []string{"/api/v1/books/9", "/api/v1/books/9?format=marc", "/api/v1/authors/9"}
+	for _, path := range paths {
+		if w := serve(router, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, w.Code)
+		}
+	}
+
+	if err := db.Migrator().DropTable(&models.Book{}, &models.Author{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		if w := serve(router, http.MethodGet, path, ""); w.Code != http.StatusInternalServerError {
+			t.Errorf("GET %s with its table missing = %d, want 500", path, w.Code)
+		}
+	}
+}
+
+// TestIDs rejects malformed and, with public IDs enabled, sequential IDs in
+// paths and bodies
+func TestIDs(t *testing.T) {
+	router, _ := testRouter(t)
+	for _, path := range []string{"/api/v1/authors/007", "/api/v1/authors/-1", "/api/v1/authors/1.0", "/api/v1/authors/0"} {
+		if w := serve(router, http.MethodGet, path, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s = %d, want 400", path, w.Code)
+		}
+	}
+
+	codec, err := ids.NewHashids("salt", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids.Use(codec)
+	defer ids.Use(nil)
+
+	w := serve(router, http.MethodPost, "/api/v1/authors", `{"name": "Octavia E. Butler"}`)
+	var author struct {
+		ID string `json:"ID"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &author); err != nil || author.ID != ids.ID(1).String() {
+		t.Fatalf("created author = %s, want the public ID %q", w.Body, ids.ID(1).String())
+	}
+	if w := serve(router, http.MethodGet, "/api/v1/authors/"+author.ID, ""); w.Code != http.StatusOK {
+		t.Errorf("GET by public ID = %d, want 200", w.Code)
+	}
+
+	tests := []struct {
+		method, path, body string
+	}{
+		{method: http.MethodGet, path: "/api/v1/authors/1"},
+		{method: http.MethodPost, path: "/api/v1/books", body: `{"title": "Kindred", "isbn": "9780807083697", "author_id": 1}`},
+		{method: http.MethodPost, path: "/api/v1/books", body: `{"title": "Kindred", "isbn": "9780807083697", "author_id": "1"}`},
+	}
+	for _, tt := range tests {
+		if w := serve(router, tt.method, tt.path, tt.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s = %d, want 400", tt.method, tt.path, tt.body, w.Code)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	var down error
+	checker := health.NewChecker(time.Second)
+	checker.Add("database", func(ctx context.Context) error { return down })
+	router := gin.New()
+	router.GET("/healthz", Liveness)
+	router.GET("/readyz", Readiness(checker))
+	router.GET("/health", HealthDetails(checker))
+
+	want := map[string]int{"/healthz": http.StatusOK, "/readyz": http.StatusOK, "/health": http.StatusOK}
+	for path, status := range want {
+		if w := serve(router, http.MethodGet, path, ""); w.Code != status {
+			t.Errorf("GET %s = %d, want %d", path, w.Code, status)
+		}
+	}
+
+	down = errors.New("connection refused")
+	want = map[string]int{"/healthz": http.StatusOK, "/readyz": http.StatusServiceUnavailable, "/health": http.StatusServiceUnavailable}
+	for path, status := range want {
+		if w := serve(router, http.MethodGet, path, ""); w.Code != status {
+			t.Errorf("GET %s with the database down = %d, want %d", path, w.Code, status)
+		}
+	}
+	w := serve(router, http.MethodGet, "/health", "")
+	var report health.Report
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil || report.Checks["database"].Error != "connection refused" {
+		t.Errorf("report = %s, want the database's error", w.Body)
+	}
+}
+
+// TestExtendWriteDeadline keeps streaming an export for longer than the
+// server's write timeout, as long as each part is written in time
+func TestExtendWriteDeadline(t *testing.T) {
+	InitExports(200 * time.Millisecond)
+	defer InitExports(0)
+
+	router := gin.New()
+	router.GET("/export", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		extendWriteDeadline(c)
+		for range 4 {
+			time.Sleep(75 * time.Millisecond)
+			c.Writer.WriteString("row\n")
+			c.Writer.Flush()
+			extendWriteDeadline(c)
+		}
+	})
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != strings.Repeat("row\n", 4) {
+		t.Errorf("export = %q, %v, want 4 rows", body, err)
+	}
+}
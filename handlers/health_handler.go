@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"mentalartsapi/health"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Liveness answers as long as the server handles requests, whatever the
+// state of its dependencies, so that it is only restarted when stuck
+func Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusUp})
+}
+
+// Readiness answers 200 when every dependency is usable and 503 otherwise,
+// so that no traffic is sent to the server until it can serve it
+func Readiness(checker *health.Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := checker.Run(c.Request.Context())
+		c.JSON(healthStatus(report), gin.H{"status": report.Status})
+	}
+}
+
+// HealthDetails reports the status and latency of every dependency, with
+// the status code of Readiness
+func HealthDetails(checker *health.Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := checker.Run(c.Request.Context())
+		c.JSON(healthStatus(report), report)
+	}
+}
+
+func healthStatus(report health.Report) int {
+	if report.Status != health.StatusUp {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mentalartsapi/cache"
+	"mentalartsapi/content"
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"mentalartsapi/services"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pathID parses the ID in a path parameter. Malformed IDs are answered with
+// a 400 and reported as not ok.
+func pathID(c *gin.Context, name string) (ids.ID, bool) {
+	id, err := ids.Parse(c.Param(name))
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return 0, false
+	}
+	return id, true
+}
+
+// renderServiceError answers with the status matching a service error
+func renderServiceError(c *gin.Context, err error) {
+	var serviceErr *services.Error
+	if !errors.As(err, &serviceErr) {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if errors.Is(err, services.ErrNotFound) {
+		status = http.StatusNotFound
+	}
+	content.Render(c, status, dto.ErrorResponse{Error: serviceErr.Message})
+}
+
+// renderCached answers a read with the JSON data cached under the path and
+// query of the request, loading it and its cache tags with load when it is
+// missing. The query is part of the key, as it chooses the fields and
+// relations of the response.
+func renderCached(c *gin.Context, load func() (json.RawMessage, []string, error)) {
+	key := c.Request.URL.Path + "?" + c.Request.URL.Query().Encode()
+	data, err := cache.Fetch(c.Request.Context(), key, func() ([]byte, []string, error) {
+		return load()
+	})
+	if err != nil {
+		renderServiceError(c, err)
+		return
+	}
+	content.Render(c, http.StatusOK, json.RawMessage(data))
+}
+
+// customMethod runs the custom method of a collection named in the action
+// parameter, e.g. bulkCreate for /books:bulkCreate. Gin can't route literal
+// colons, so the custom methods of a collection share a /books:action route.
+func customMethod(c *gin.Context, methods map[string]gin.HandlerFunc) {
+	name, ok := strings.CutPrefix(c.Param("action"), ":")
+	handler, known := methods[name]
+	if !ok || !known {
+		content.Render(c, http.StatusNotFound, dto.ErrorResponse{Error: "unknown method " + c.Param("action")})
+		return
+	}
+	handler(c)
+}
+
+// renderBulk answers a bulk request with 200 when every item was written,
+// 207 when some were and 422 when none were
+func renderBulk(c *gin.Context, response dto.BulkResponse, err error) {
+	if err != nil {
+		renderServiceError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	switch {
+	case response.Failed == 0:
+	case response.Succeeded == 0:
+		status = http.StatusUnprocessableEntity
+	default:
+		status = http.StatusMultiStatus
+	}
+	content.Render(c, status, response)
+}
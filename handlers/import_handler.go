@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"mentalartsapi/content"
+	"mentalartsapi/dto"
+	"mentalartsapi/importer"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+var maxImportBytes int64 = 64 << 20
+
+// ImportCatalogue godoc
+// @Summary Bulk import authors and books
+// @Description Upsert authors by name and books by ISBN from a CSV file (with a header row), NDJSON, MARC21 or MARCXML. The file is sent as the request body or as multipart field "file". Rows are written in batched transactions and failures are reported per row. Nothing is written unless mode=commit.
+// @Tags import
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Accept application/marc
+// @Accept application/marcxml+xml
+// @Accept multipart/form-data
+// @Produce json
+// @Param format query string false "csv, ndjson, marc or marcxml, detected from the content type or file name if omitted"
+// @Param mode query string false "dry_run (default) or commit"
+// @Param file formData file false "Import file"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
+// @Success 200 {object} importer.Report
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 415 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/import [post]
+func ImportCatalogue(c *gin.Context) {
+	var dryRun bool
+	switch mode := c.DefaultQuery("mode", "dry_run"); mode {
+	case "dry_run", "dry-run":
+		dryRun = true
+	case "commit":
+	default:
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: "mode must be dry_run or commit"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+
+	body := io.Reader(c.Request.Body)
+	format := importer.Format(c.Query("format"))
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, header, err := c.Request.FormFile("file")
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				content.Render(c, http.StatusRequestEntityTooLarge, dto.ErrorResponse{Error: err.Error()})
+				return
+			}
+			content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: "multipart form field \"file\" is required"})
+			return
+		}
+		defer file.Close()
+		body = file
+		if format == "" {
+			format = importer.FormatFromFilename(header.Filename)
+		}
+	} else if format == "" {
+		format = importFormatFromContentType(c.ContentType())
+	}
+
+	switch format {
+	case importer.CSV, importer.NDJSON, importer.MARC21, importer.MARCXML:
+	default:
+		content.Render(c, http.StatusUnsupportedMediaType, dto.ErrorResponse{Error: "import format must be csv, ndjson, marc or marcxml"})
+		return
+	}
+
+	report, err := importer.Import(c.Request.Context(), dbFor(c), body, format, importer.Options{DryRun: dryRun})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, importer.ErrInvalidFile) {
+			status = http.StatusBadRequest
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		content.Render(c, status, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	content.Render(c, http.StatusOK, report)
+}
+
+func importFormatFromContentType(contentType string) importer.Format {
+	switch contentType {
+	case "text/csv", "application/csv":
+		return importer.CSV
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return importer.NDJSON
+	case "application/marc":
+		return importer.MARC21
+	case "application/marcxml+xml":
+		return importer.MARCXML
+	}
+	return ""
+}
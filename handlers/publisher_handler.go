@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"mentalartsapi/cache"
+	"mentalartsapi/content"
+	"mentalartsapi/dto"
+	"mentalartsapi/models"
+	"mentalartsapi/services"
+	"mentalartsapi/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreatePublisher godoc
+// @Summary Create a new publisher
+// @Description Create a new publisher with the input payload
+// @Tags publishers
+// @Accept json
+// @Produce json
+// @Param publisher body dto.PublisherRequest true "Publisher data"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
+// @Success 201 {object} models.Publisher
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/publishers [post]
+func CreatePublisher(c *gin.Context) {
+	var publisherRequest dto.PublisherRequest
+	var publisher models.Publisher
+
+	if err := content.Bind(c, &publisherRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	publisher.Name = publisherRequest.Name
+	publisher.Country = publisherRequest.Country
+	publisher.Website = publisherRequest.Website
+
+	if err := dbFor(c).Create(&publisher).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	content.Render(c, http.StatusCreated, publisher)
+}
+
+// GetAllPublishers godoc
+// @Summary Get all publishers
+// @Description Get all publishers with pagination
+// @Tags publishers
+// @Accept json
+// @Produce json
+// @Param page query int false "Page number"
+// @Param page_size query int false "Page size"
+// @Param fields query string false "Comma separated fields to return, e.g. name,country"
+// @Param include query string false "Comma separated relations to expand: books"
+// @Param limit[books] query int false "Books per publisher, 20 by default"
+// @Success 200 {object} dto.PublisherList
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/publishers [get]
+func GetAllPublishers(c *gin.Context) {
+	var publishers []models.Publisher
+	var totalCount int64
+
+	fieldset, err := utils.ParseFieldset(c, &models.Publisher{},
+		utils.Relation{Name: "books", Collection: true})
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	pagination := utils.ParsePaginationQuery(c)
+
+	// Count total records
+	if err := dbFor(c).Model(&models.Publisher{}).Count(&totalCount).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Get paginated publishers
+	if err := utils.Paginate(publisherQuery(dbFor(c), fieldset), &pagination).Find(&publishers).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := dto.PublisherList{
+		Data:       publishers,
+		Pagination: utils.CreatePaginationResponse(totalCount, pagination),
+	}
+
+	data, err := fieldset.FilterList(response)
+	if err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	content.Render(c, http.StatusOK, data)
+}
+
+// GetPublisher godoc
+// @Summary Get a publisher
+// @Description Get a publisher by ID with the editions it published
+// @Tags publishers
+// @Accept json
+// @Produce json
+// @Param id path string true "Publisher ID"
+// @Param fields query string false "Comma separated fields to return, e.g. name,country"
+// @Param include query string false "Comma separated relations to expand: books (default)"
+// @Param limit[books] query int false "Books to return, 20 by default"
+// @Success 200 {object} models.Publisher
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/publishers/{id} [get]
+func GetPublisher(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var publisher models.Publisher
+
+	fieldset, err := utils.ParseFieldset(c, &models.Publisher{},
+		utils.Relation{Name: "books", Collection: true, Default: true})
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := publisherQuery(dbFor(c), fieldset).First(&publisher, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "publisher"))
+		return
+	}
+
+	data, err := fieldset.Filter(publisher)
+	if err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	content.Render(c, http.StatusOK, data)
+}
+
+// UpdatePublisher godoc
+// @Summary Update a publisher
+// @Description Update a publisher with the input payload
+// @Tags publishers
+// @Accept json
+// @Produce json
+// @Param id path string true "Publisher ID"
+// @Param publisher body dto.PublisherRequest true "Publisher data"
+// @Success 200 {object} models.Publisher
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/publishers/{id} [put]
+func UpdatePublisher(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var publisherRequest dto.PublisherRequest
+	var publisher models.Publisher
+
+	if err := dbFor(c).First(&publisher, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "publisher"))
+		return
+	}
+
+	if err := content.Bind(c, &publisherRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	publisher.Name = publisherRequest.Name
+	publisher.Country = publisherRequest.Country
+	publisher.Website = publisherRequest.Website
+
+	if err := dbFor(c).Save(&publisher).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: "internal server error"})
+		return
+	}
+	cache.Invalidate(c.Request.Context(), cache.Row("publishers", publisher.ID))
+
+	content.Render(c, http.StatusOK, publisher)
+}
+
+// DeletePublisher godoc
+// @Summary Delete a publisher
+// @Description Delete a publisher by ID. Its editions are kept without a publisher.
+// @Tags publishers
+// @Accept json
+// @Produce json
+// @Param id path string true "Publisher ID"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/publishers/{id} [delete]
+func DeletePublisher(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var publisher models.Publisher
+
+	if err := dbFor(c).First(&publisher, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "publisher"))
+		return
+	}
+
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Book{}).Where("publisher_id = ?", publisher.ID).Update("publisher_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&publisher).Error
+	})
+	if err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	// Responses showing its editions are tagged with it too
+	cache.Invalidate(c.Request.Context(), cache.Row("publishers", publisher.ID))
+
+	content.Render(c, http.StatusOK, dto.Response{Msg: "publisher deleted successfully"})
+}
+
+// publisherQuery selects the requested publisher fields and preloads the
+// included relations
+func publisherQuery(query *gorm.DB, fieldset utils.Fieldset) *gorm.DB {
+	query = fieldset.Select(query)
+	if fieldset.Includes("books") {
+		query = utils.PreloadLimited(query, "Books", &models.Book{}, "publisher_id", "id", fieldset.Limit("books"))
+	}
+	return query
+}
@@ -1,11 +1,11 @@
 package handlers
 
 import (
+	"mentalartsapi/content"
 	"mentalartsapi/dto"
-	"mentalartsapi/models"
+	"mentalartsapi/services"
 	"mentalartsapi/utils"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,98 +16,76 @@ import (
 // @Tags reviews
 // @Accept json
 // @Produce json
-// @Param id path int true "Book ID"
+// @Param id path string true "Book ID"
 // @Param review body dto.ReviewRequest true "Review data"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
 // @Success 201 {object} models.Review
 // @Failure 400 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/books/{id}/reviews [post]
 func CreateReview(c *gin.Context) {
-	bookID := c.Param("id")
-	var reviewRequest dto.ReviewRequest
-	var review models.Review
-
-	// Check if book exists
-	var book models.Book
-	if err := db.First(&book, bookID).Error; err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "book not found"})
+	id, ok := pathID(c, "id")
+	if !ok {
 		return
 	}
 
-	if err := c.ShouldBindJSON(&reviewRequest); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	var reviewRequest dto.ReviewRequest
+
+	if err := content.Bind(c, &reviewRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	review.Rating = reviewRequest.Rating
-	review.Comment = reviewRequest.Comment
-	review.DatePosted = time.Now()
-	review.BookID = book.ID
-
-	result := db.Create(&review)
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: result.Error.Error()})
+	review, err := services.CreateReview(dbFor(c), id, reviewRequest)
+	if err != nil {
+		renderServiceError(c, err)
 		return
 	}
 
-	// Load relations for response
-	db.Preload("Book").First(&review, review.ID)
-
-	c.JSON(http.StatusCreated, review)
+	content.Render(c, http.StatusCreated, review)
 }
 
 // GetBookReviews godoc
 // @Summary Get all reviews for a book
-// @Description Get all reviews for a book with pagination
+// @Description Get all reviews for a book with pagination, including reviews posted on other editions of the same work
 // @Tags reviews
 // @Accept json
 // @Produce json
-// @Param id path int true "Book ID"
+// @Param id path string true "Book ID"
 // @Param page query int false "Page number"
 // @Param page_size query int false "Page size"
-// @Success 200 {object} map[string]interface{}
+// @Success 200 {object} dto.ReviewList
+// @Failure 400 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/books/{id}/reviews [get]
 func GetBookReviews(c *gin.Context) {
-	bookID := c.Param("id")
-	var reviews []models.Review
-	var totalCount int64
-
-	// Check if book exists
-	var book models.Book
-	if err := db.First(&book, bookID).Error; err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "book not found"})
+	id, ok := pathID(c, "id")
+	if !ok {
 		return
 	}
 
 	pagination := utils.ParsePaginationQuery(c)
-	
-	// Count total records
-	if err := db.Model(&models.Review{}).Where("book_id = ?", bookID).Count(&totalCount).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
-		return
-	}
 
-	// Get paginated reviews
-	if err := utils.Paginate(db, &pagination).
-		Where("book_id = ?", bookID).
-		Find(&reviews).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	reviews, totalCount, err := services.ListBookReviews(dbFor(c), id, pagination)
+	if err != nil {
+		renderServiceError(c, err)
 		return
 	}
 
-	// Create pagination response
-	paginationResponse := utils.CreatePaginationResponse(totalCount, pagination)
-
 	// Create final response
-	response := gin.H{
-		"data":       reviews,
-		"pagination": paginationResponse,
+	response := dto.ReviewList{
+		Data:       reviews,
+		Pagination: utils.CreatePaginationResponse(totalCount, pagination),
 	}
 
-	c.JSON(http.StatusOK, response)
+	content.Render(c, http.StatusOK, response)
 }
 
 // UpdateReview godoc
@@ -116,37 +94,34 @@ func GetBookReviews(c *gin.Context) {
 // @Tags reviews
 // @Accept json
 // @Produce json
-// @Param id path int true "Review ID"
+// @Param id path string true "Review ID"
 // @Param review body dto.ReviewRequest true "Review data"
 // @Success 200 {object} models.Review
 // @Failure 404 {object} dto.ErrorResponse
 // @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/reviews/{id} [put]
 func UpdateReview(c *gin.Context) {
-	id := c.Param("id")
-	var reviewRequest dto.ReviewRequest
-	var review models.Review
-
-	if err := db.First(&review, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "review not found"})
+	id, ok := pathID(c, "id")
+	if !ok {
 		return
 	}
 
-	if err := c.ShouldBindJSON(&reviewRequest); err != nil {
-		c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+	var reviewRequest dto.ReviewRequest
+
+	if err := content.Bind(c, &reviewRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	review.Rating = reviewRequest.Rating
-	review.Comment = reviewRequest.Comment
-
-	if err := db.Save(&review).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "internal server error"})
+	review, err := services.UpdateReview(dbFor(c), id, reviewRequest)
+	if err != nil {
+		renderServiceError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, review)
+	content.Render(c, http.StatusOK, review)
 }
 
 // DeleteReview godoc
@@ -155,24 +130,119 @@ func UpdateReview(c *gin.Context) {
 // @Tags reviews
 // @Accept json
 // @Produce json
-// @Param id path int true "Review ID"
+// @Param id path string true "Review ID"
 // @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.ErrorResponse
 // @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
 // @Failure 500 {object} dto.ErrorResponse
 // @Router /api/v1/reviews/{id} [delete]
 func DeleteReview(c *gin.Context) {
-	id := c.Param("id")
-	var review models.Review
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
 
-	if err := db.First(&review, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: "review not found"})
+	if err := services.DeleteReview(dbFor(c), id); err != nil {
+		renderServiceError(c, err)
 		return
 	}
 
-	if err := db.Delete(&review).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+	content.Render(c, http.StatusOK, dto.Response{Msg: "review deleted successfully"})
+}
+
+// ReviewActions runs the custom methods of the reviews collection
+func ReviewActions(c *gin.Context) {
+	customMethod(c, map[string]gin.HandlerFunc{
+		"bulkCreate": BulkCreateReviews,
+		"bulkUpdate": BulkUpdateReviews,
+		"bulkDelete": BulkDeleteReviews,
+	})
+}
+
+// BulkCreateReviews godoc
+// @Summary Create reviews in bulk
+// @Description Create up to 500 reviews, each item being the book_id of the reviewed book and the body of POST /api/v1/books/{id}/reviews. Every item is validated on its own and reported in the results. In atomic mode, the default, nothing is created unless every item is valid; in partial mode the valid items are created.
+// @Tags reviews
+// @Accept json
+// @Produce json
+// @Param reviews body dto.BulkRequest true "Reviews"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
+// @Success 200 {object} dto.BulkResponse
+// @Success 207 {object} dto.BulkResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.BulkResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/reviews:bulkCreate [post]
+func BulkCreateReviews(c *gin.Context) {
+	var bulkRequest dto.BulkRequest
+
+	if err := content.Bind(c, &bulkRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response, err := services.BulkCreateReviews(dbFor(c), bulkRequest)
+	renderBulk(c, response, err)
+}
+
+// BulkUpdateReviews godoc
+// @Summary Update reviews in bulk
+// @Description Update up to 500 reviews, each item being the id of a review and the body of PUT /api/v1/reviews/{id}. Every item is validated on its own and reported in the results. In atomic mode, the default, nothing is updated unless every item is valid; in partial mode the valid items are updated.
+// @Tags reviews
+// @Accept json
+// @Produce json
+// @Param reviews body dto.BulkRequest true "Review updates"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
+// @Success 200 {object} dto.BulkResponse
+// @Success 207 {object} dto.BulkResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.BulkResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/reviews:bulkUpdate [post]
+func BulkUpdateReviews(c *gin.Context) {
+	var bulkRequest dto.BulkRequest
+
+	if err := content.Bind(c, &bulkRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, dto.Response{Msg: "review deleted successfully"})
-} 
\ No newline at end of file
+	response, err := services.BulkUpdateReviews(dbFor(c), bulkRequest)
+	renderBulk(c, response, err)
+}
+
+// BulkDeleteReviews godoc
+// @Summary Delete reviews in bulk
+// @Description Delete up to 500 reviews by ID. In atomic mode, the default, nothing is deleted unless every review exists; in partial mode the existing reviews are deleted.
+// @Tags reviews
+// @Accept json
+// @Produce json
+// @Param reviews body dto.BulkDeleteRequest true "Review IDs"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
+// @Success 200 {object} dto.BulkResponse
+// @Success 207 {object} dto.BulkResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.BulkResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/reviews:bulkDelete [post]
+func BulkDeleteReviews(c *gin.Context) {
+	var bulkRequest dto.BulkDeleteRequest
+
+	if err := content.Bind(c, &bulkRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response, err := services.BulkDeleteReviews(dbFor(c), bulkRequest)
+	renderBulk(c, response, err)
+}
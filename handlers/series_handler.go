@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"errors"
+	"mentalartsapi/cache"
+	"mentalartsapi/content"
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"mentalartsapi/models"
+	"mentalartsapi/services"
+	"mentalartsapi/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateSeries godoc
+// @Summary Create a new series
+// @Description Create a new series with the input payload
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param series body dto.SeriesRequest true "Series data"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
+// @Success 201 {object} models.Series
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/series [post]
+func CreateSeries(c *gin.Context) {
+	var seriesRequest dto.SeriesRequest
+	var series models.Series
+
+	if err := content.Bind(c, &seriesRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	series.Title = seriesRequest.Title
+	series.Description = seriesRequest.Description
+
+	if err := dbFor(c).Create(&series).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	content.Render(c, http.StatusCreated, series)
+}
+
+// GetAllSeries godoc
+// @Summary Get all series
+// @Description Get all series with pagination
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param page query int false "Page number"
+// @Param page_size query int false "Page size"
+// @Success 200 {object} dto.SeriesList
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/series [get]
+func GetAllSeries(c *gin.Context) {
+	var series []models.Series
+	var totalCount int64
+
+	pagination := utils.ParsePaginationQuery(c)
+
+	// Count total records
+	if err := dbFor(c).Model(&models.Series{}).Count(&totalCount).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Get paginated series
+	if err := utils.Paginate(dbFor(c), &pagination).Find(&series).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := dto.SeriesList{
+		Data:       series,
+		Pagination: utils.CreatePaginationResponse(totalCount, pagination),
+	}
+
+	content.Render(c, http.StatusOK, response)
+}
+
+// GetSeries godoc
+// @Summary Get a series
+// @Description Get a series by ID with its volumes in reading order
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param id path string true "Series ID"
+// @Success 200 {object} models.Series
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/series/{id} [get]
+func GetSeries(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var series models.Series
+
+	if err := dbFor(c).
+		Preload("Entries", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		}).
+		Preload("Entries.Book").
+		First(&series, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "series"))
+		return
+	}
+
+	content.Render(c, http.StatusOK, series)
+}
+
+// UpdateSeries godoc
+// @Summary Update a series
+// @Description Update a series with the input payload
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param id path string true "Series ID"
+// @Param series body dto.SeriesRequest true "Series data"
+// @Success 200 {object} models.Series
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/series/{id} [put]
+func UpdateSeries(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var seriesRequest dto.SeriesRequest
+	var series models.Series
+
+	if err := dbFor(c).First(&series, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "series"))
+		return
+	}
+
+	if err := content.Bind(c, &seriesRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	series.Title = seriesRequest.Title
+	series.Description = seriesRequest.Description
+
+	if err := dbFor(c).Save(&series).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: "internal server error"})
+		return
+	}
+	cache.Invalidate(c.Request.Context(), cache.Row("series", series.ID))
+
+	content.Render(c, http.StatusOK, series)
+}
+
+// DeleteSeries godoc
+// @Summary Delete a series
+// @Description Delete a series by ID. Its books are kept.
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param id path string true "Series ID"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/series/{id} [delete]
+func DeleteSeries(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var series models.Series
+
+	if err := dbFor(c).First(&series, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "series"))
+		return
+	}
+
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("series_id = ?", series.ID).Delete(&models.SeriesEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&series).Error
+	})
+	if err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	cache.Invalidate(c.Request.Context(), cache.Row("series", series.ID))
+
+	content.Render(c, http.StatusOK, dto.Response{Msg: "series deleted successfully"})
+}
+
+// SetSeriesBook godoc
+// @Summary Add a book to a series or move it
+// @Description Place a book at the given position in a series. Positions may be fractional, e.g. 2.5 for a novella between volumes 2 and 3.
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param id path string true "Series ID"
+// @Param book_id path string true "Book ID"
+// @Param entry body dto.SeriesEntryRequest true "Position in the series"
+// @Success 200 {object} models.SeriesEntry
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/series/{id}/books/{book_id} [put]
+func SetSeriesBook(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	bookID, ok := pathID(c, "book_id")
+	if !ok {
+		return
+	}
+
+	var entryRequest dto.SeriesEntryRequest
+	var series models.Series
+	var book models.Book
+
+	if err := dbFor(c).First(&series, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "series"))
+		return
+	}
+
+	if err := dbFor(c).First(&book, bookID).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "book"))
+		return
+	}
+
+	if err := content.Bind(c, &entryRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Two volumes can't share a position
+	var taken int64
+	if err := dbFor(c).Model(&models.SeriesEntry{}).
+		Where("series_id = ? AND position = ? AND book_id <> ?", series.ID, *entryRequest.Position, book.ID).
+		Count(&taken).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if taken > 0 {
+		content.Render(c, http.StatusConflict, dto.ErrorResponse{Error: "position already taken"})
+		return
+	}
+
+	var entry models.SeriesEntry
+	err := dbFor(c).Where("series_id = ? AND book_id = ?", series.ID, book.ID).First(&entry).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	entry.SeriesID = series.ID
+	entry.BookID = book.ID
+	entry.Position = *entryRequest.Position
+
+	if err := dbFor(c).Save(&entry).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	invalidateSeriesEntry(c, entry)
+
+	entry.Book = book
+	content.Render(c, http.StatusOK, entry)
+}
+
+// RemoveSeriesBook godoc
+// @Summary Remove a book from a series
+// @Description Remove a book from a series. The book itself is kept.
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param id path string true "Series ID"
+// @Param book_id path string true "Book ID"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/series/{id}/books/{book_id} [delete]
+func RemoveSeriesBook(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+	bookID, ok := pathID(c, "book_id")
+	if !ok {
+		return
+	}
+
+	var entry models.SeriesEntry
+
+	if err := dbFor(c).Where("series_id = ? AND book_id = ?", id, bookID).First(&entry).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		content.Render(c, http.StatusNotFound, dto.ErrorResponse{Error: "book is not part of the series"})
+		return
+	} else if err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := dbFor(c).Unscoped().Delete(&entry).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	invalidateSeriesEntry(c, entry)
+
+	content.Render(c, http.StatusOK, dto.Response{Msg: "book removed from series successfully"})
+}
+
+// invalidateSeriesEntry drops the cached responses listing the series of the
+// book of entry, and the neighbours of the other volumes of its series
+func invalidateSeriesEntry(c *gin.Context, entry models.SeriesEntry) {
+	cache.Invalidate(c.Request.Context(),
+		cache.Children("books", entry.BookID, "series"),
+		cache.Children("series", entry.SeriesID, "books"))
+}
+
+// bookSeriesListings returns every series a book belongs to together with
+// the volumes just before and after it
+func bookSeriesListings(c *gin.Context, bookID ids.ID) ([]dto.SeriesListing, error) {
+	var entries []models.SeriesEntry
+	if err := dbFor(c).Where("book_id = ?", bookID).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	listings := []dto.SeriesListing{}
+	for _, entry := range entries {
+		var series models.Series
+		if err := dbFor(c).First(&series, entry.SeriesID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return nil, err
+		}
+
+		previous, err := seriesNeighbour(c, entry, "position < ?", "position DESC")
+		if err != nil {
+			return nil, err
+		}
+		next, err := seriesNeighbour(c, entry, "position > ?", "position")
+		if err != nil {
+			return nil, err
+		}
+
+		listings = append(listings, dto.SeriesListing{
+			SeriesID: series.ID,
+			Title:    series.Title,
+			Position: entry.Position,
+			Previous: previous,
+			Next:     next,
+		})
+	}
+
+	return listings, nil
+}
+
+// seriesNeighbour finds the closest volume to entry in the given direction
+func seriesNeighbour(c *gin.Context, entry models.SeriesEntry, condition, order string) (*dto.SeriesVolume, error) {
+	var neighbour models.SeriesEntry
+	err := dbFor(c).Preload("Book").
+		Where("series_id = ?", entry.SeriesID).
+		Where(condition, entry.Position).
+		Order(order).
+		First(&neighbour).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.SeriesVolume{
+		BookID:   neighbour.BookID,
+		Title:    neighbour.Book.Title,
+		Position: neighbour.Position,
+		Href:     "/api/v1/books/" + neighbour.BookID.String(),
+	}, nil
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"mentalartsapi/content"
+	"mentalartsapi/dto"
+	"mentalartsapi/models"
+	"mentalartsapi/services"
+	"mentalartsapi/utils"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// CreateTenant godoc
+// @Summary Provision a new tenant
+// @Description Create a new tenant with the input payload
+// @Tags tenants
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "Admin token"
+// @Param tenant body dto.TenantRequest true "Tenant data"
+// @Param Idempotency-Key header string false "Retries with the same key replay the first response"
+// @Success 201 {object} models.Tenant
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 413 {object} dto.ErrorResponse
+// @Failure 422 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/tenants [post]
+func CreateTenant(c *gin.Context) {
+	var tenantRequest dto.TenantRequest
+	var tenant models.Tenant
+
+	if err := content.Bind(c, &tenantRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !slugPattern.MatchString(tenantRequest.Slug) {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: "slug must be lowercase letters, digits and hyphens"})
+		return
+	}
+
+	var existing int64
+	if err := dbFor(c).Unscoped().Model(&models.Tenant{}).Where("slug = ?", tenantRequest.Slug).Count(&existing).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if existing > 0 {
+		content.Render(c, http.StatusConflict, dto.ErrorResponse{Error: "tenant slug already in use"})
+		return
+	}
+
+	tenant.Name = tenantRequest.Name
+	tenant.Slug = tenantRequest.Slug
+	tenant.Active = tenantRequest.Active == nil || *tenantRequest.Active
+
+	if err := dbFor(c).Create(&tenant).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	content.Render(c, http.StatusCreated, tenant)
+}
+
+// GetAllTenants godoc
+// @Summary Get all tenants
+// @Description Get all tenants with pagination
+// @Tags tenants
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "Admin token"
+// @Param page query int false "Page number"
+// @Param page_size query int false "Page size"
+// @Success 200 {object} dto.TenantList
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/tenants [get]
+func GetAllTenants(c *gin.Context) {
+	var tenants []models.Tenant
+	var totalCount int64
+
+	pagination := utils.ParsePaginationQuery(c)
+
+	if err := dbFor(c).Model(&models.Tenant{}).Count(&totalCount).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := utils.Paginate(dbFor(c), &pagination).Order("id").Find(&tenants).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := dto.TenantList{
+		Data:       tenants,
+		Pagination: utils.CreatePaginationResponse(totalCount, pagination),
+	}
+
+	content.Render(c, http.StatusOK, response)
+}
+
+// GetTenant godoc
+// @Summary Get a tenant
+// @Description Get a tenant by ID
+// @Tags tenants
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "Admin token"
+// @Param id path string true "Tenant ID"
+// @Success 200 {object} models.Tenant
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/tenants/{id} [get]
+func GetTenant(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var tenant models.Tenant
+
+	if err := dbFor(c).First(&tenant, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "tenant"))
+		return
+	}
+
+	content.Render(c, http.StatusOK, tenant)
+}
+
+// UpdateTenant godoc
+// @Summary Update a tenant
+// @Description Rename, re-slug, activate or deactivate a tenant
+// @Tags tenants
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "Admin token"
+// @Param id path string true "Tenant ID"
+// @Param tenant body dto.TenantRequest true "Tenant data"
+// @Success 200 {object} models.Tenant
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 409 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/tenants/{id} [put]
+func UpdateTenant(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var tenantRequest dto.TenantRequest
+	var tenant models.Tenant
+
+	if err := dbFor(c).First(&tenant, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "tenant"))
+		return
+	}
+
+	if err := content.Bind(c, &tenantRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if !slugPattern.MatchString(tenantRequest.Slug) {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: "slug must be lowercase letters, digits and hyphens"})
+		return
+	}
+
+	var existing int64
+	if err := dbFor(c).Unscoped().Model(&models.Tenant{}).Where("slug = ? AND id <> ?", tenantRequest.Slug, tenant.ID).Count(&existing).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+	if existing > 0 {
+		content.Render(c, http.StatusConflict, dto.ErrorResponse{Error: "tenant slug already in use"})
+		return
+	}
+
+	tenant.Name = tenantRequest.Name
+	tenant.Slug = tenantRequest.Slug
+	if tenantRequest.Active != nil {
+		tenant.Active = *tenantRequest.Active
+	}
+
+	if err := dbFor(c).Save(&tenant).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	content.Render(c, http.StatusOK, tenant)
+}
+
+// DeleteTenant godoc
+// @Summary Delete a tenant
+// @Description Delete a tenant by ID. Its catalogue is kept but no longer reachable.
+// @Tags tenants
+// @Accept json
+// @Produce json
+// @Param X-Admin-Token header string true "Admin token"
+// @Param id path string true "Tenant ID"
+// @Success 200 {object} dto.Response
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/admin/tenants/{id} [delete]
+func DeleteTenant(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var tenant models.Tenant
+
+	if err := dbFor(c).First(&tenant, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "tenant"))
+		return
+	}
+
+	if err := dbFor(c).Delete(&tenant).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	content.Render(c, http.StatusOK, dto.Response{Msg: "tenant deleted successfully"})
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"mentalartsapi/cache"
+	"mentalartsapi/content"
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"mentalartsapi/models"
+	"mentalartsapi/services"
+	"mentalartsapi/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetAllWorks godoc
+// @Summary Get all works
+// @Description Get all works with pagination
+// @Tags works
+// @Accept json
+// @Produce json
+// @Param page query int false "Page number"
+// @Param page_size query int false "Page size"
+// @Param fields query string false "Comma separated fields to return, e.g. title,author_id"
+// @Param include query string false "Comma separated relations to expand: author (default), editions"
+// @Param limit[editions] query int false "Editions per work, 20 by default"
+// @Success 200 {object} dto.WorkList
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/works [get]
+func GetAllWorks(c *gin.Context) {
+	var works []models.Work
+	var totalCount int64
+
+	fieldset, err := utils.ParseFieldset(c, &models.Work{},
+		utils.Relation{Name: "author", Default: true},
+		utils.Relation{Name: "editions", Collection: true})
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	pagination := utils.ParsePaginationQuery(c)
+
+	// Count total records
+	if err := dbFor(c).Model(&models.Work{}).Count(&totalCount).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Get paginated works with the included relations
+	if err := utils.Paginate(workQuery(dbFor(c), fieldset), &pagination).
+		Find(&works).Error; err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := dto.WorkList{
+		Data:       works,
+		Pagination: utils.CreatePaginationResponse(totalCount, pagination),
+	}
+
+	data, err := fieldset.FilterList(response)
+	if err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	content.Render(c, http.StatusOK, data)
+}
+
+// GetWork godoc
+// @Summary Get a work
+// @Description Get a work by ID with its author, all of its editions and its aggregated rating
+// @Tags works
+// @Accept json
+// @Produce json
+// @Param id path string true "Work ID"
+// @Param fields query string false "Comma separated fields to return, e.g. title,author_id"
+// @Param include query string false "Comma separated relations to expand: author, editions and rating (all by default)"
+// @Param limit[editions] query int false "Editions to return, 20 by default"
+// @Success 200 {object} dto.WorkResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/works/{id} [get]
+func GetWork(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var work models.Work
+
+	fieldset, err := utils.ParseFieldset(c, &models.Work{},
+		utils.Relation{Name: "author", Default: true},
+		utils.Relation{Name: "editions", Collection: true, Default: true},
+		utils.Relation{Name: "rating", Default: true})
+	if err != nil {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := workQuery(dbFor(c), fieldset).First(&work, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "work"))
+		return
+	}
+
+	response := dto.WorkResponse{Work: work}
+	if fieldset.Includes("rating") {
+		if response.Rating, err = services.WorkRating(dbFor(c), work.ID); err != nil {
+			content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	data, err := fieldset.Filter(response)
+	if err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	content.Render(c, http.StatusOK, data)
+}
+
+// UpdateWork godoc
+// @Summary Update a work
+// @Description Update a work with the input payload. Changing the author moves all editions to the new author.
+// @Tags works
+// @Accept json
+// @Produce json
+// @Param id path string true "Work ID"
+// @Param work body dto.WorkRequest true "Work data"
+// @Success 200 {object} models.Work
+// @Failure 404 {object} dto.ErrorResponse
+// @Failure 400 {object} dto.ErrorResponse
+// @Failure 429 {object} dto.ErrorResponse
+// @Failure 500 {object} dto.ErrorResponse
+// @Router /api/v1/works/{id} [put]
+func UpdateWork(c *gin.Context) {
+	id, ok := pathID(c, "id")
+	if !ok {
+		return
+	}
+
+	var workRequest dto.WorkRequest
+	var work models.Work
+
+	if err := dbFor(c).First(&work, id).Error; err != nil {
+		renderServiceError(c, services.LookupError(err, "work"))
+		return
+	}
+
+	if err := content.Bind(c, &workRequest); err != nil {
+		content.Render(c, content.BindStatus(err), dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Check if author exists
+	if err := dbFor(c).First(&models.Author{}, workRequest.AuthorID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		content.Render(c, http.StatusBadRequest, dto.ErrorResponse{Error: "author not found"})
+		return
+	} else if err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	work.Title = workRequest.Title
+	work.Description = workRequest.Description
+	work.AuthorID = workRequest.AuthorID
+
+	var bookIDs []ids.ID
+	err := dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&work).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Book{}).Where("work_id = ?", work.ID).Pluck("id", &bookIDs).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Book{}).Where("work_id = ?", work.ID).Update("author_id", work.AuthorID).Error
+	})
+	if err != nil {
+		content.Render(c, http.StatusInternalServerError, dto.ErrorResponse{Error: "internal server error"})
+		return
+	}
+
+	// The editions of the work have moved to its author
+	tags := []string{"books", cache.Children("authors", work.AuthorID, "books")}
+	for _, bookID := range bookIDs {
+		tags = append(tags, cache.Row("books", bookID))
+	}
+	cache.Invalidate(c.Request.Context(), tags...)
+
+	// Load relations for response
+	dbFor(c).Preload("Author").First(&work, work.ID)
+
+	content.Render(c, http.StatusOK, work)
+}
+
+// workQuery selects the requested work fields and preloads the included
+// relations
+func workQuery(query *gorm.DB, fieldset utils.Fieldset) *gorm.DB {
+	query = fieldset.Select(query, "author_id")
+	if fieldset.Includes("author") {
+		query = query.Preload("Author")
+	}
+	if fieldset.Includes("editions") {
+		query = utils.PreloadLimited(query, "Editions", &models.Book{}, "work_id", "publication_year, edition_number, id", fieldset.Limit("editions")).
+			Preload("Editions.Publisher")
+	}
+	return query
+}
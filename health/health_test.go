@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	checker := NewChecker(20 * time.Millisecond)
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	checker.Add("redis", func(ctx context.Context) error { return errors.New("connection refused") })
+	checker.Add("storage", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	// A check that ignores its context fails once it is too slow
+	checker.Add("slow", func(ctx context.Context) error {
+		time.Sleep(40 * time.Millisecond)
+		return nil
+	})
+
+	report := checker.Run(context.Background())
+	if report.Status != StatusDown {
+		t.Errorf("status = %s, want %s", report.Status, StatusDown)
+	}
+	want := map[string]CheckResult{
+		"database": {Status: StatusUp},
+		"redis":    {Status: StatusDown, Error: "connection refused"},
+		"storage":  {Status: StatusDown, Error: context.DeadlineExceeded.Error()},
+		"slow":     {Status: StatusDown, Error: context.DeadlineExceeded.Error()},
+	}
+	for name, w := range want {
+		got := report.Checks[name]
+		if got.Status != w.Status || got.Error != w.Error {
+			t.Errorf("%s = %s %q, want %s %q", name, got.Status, got.Error, w.Status, w.Error)
+		}
+	}
+
+	checker = NewChecker(time.Second)
+	checker.Add("database", func(ctx context.Context) error { return errors.New("down") })
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	if report := checker.Run(context.Background()); report.Status != StatusUp || len(report.Checks) != 1 {
+		t.Errorf("report = %+v, want the replaced check up", report)
+	}
+}
@@ -0,0 +1,170 @@
+// Package ids parses and formats the IDs of API resources.
+//
+// IDs are the numeric primary keys of the records. With public IDs enabled
+// they are written and read as hashids instead, short opaque strings that
+// map one to one to the keys, so that clients can't enumerate the catalogue
+// by counting. Nothing is stored for them, so they can be switched on for
+// an existing database, but changing the salt changes every public ID.
+package ids
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/speps/go-hashids/v2"
+)
+
+// ErrInvalid is returned for malformed IDs
+var ErrInvalid = errors.New("invalid id")
+
+// ID is the primary key of a record, written in JSON as its public ID
+type ID uint
+
+// Codec converts IDs to and from their public form
+type Codec interface {
+	Encode(id uint64) (string, error)
+	Decode(s string) (uint64, error)
+}
+
+// codec is the public ID codec, nil while IDs are exposed as numbers
+var codec Codec
+
+// Use exposes IDs in the public form of c, or as numbers when c is nil.
+// It is meant to be called once at startup.
+func Use(c Codec) {
+	codec = c
+}
+
+// Enabled reports whether IDs are exposed in a public form
+func Enabled() bool {
+	return codec != nil
+}
+
+// Parse parses an ID as written by String. Numeric IDs must be positive
+// decimal integers without signs or leading zeros.
+func Parse(s string) (ID, error) {
+	if codec != nil {
+		n, err := codec.Decode(s)
+		if err != nil || n == 0 || n > math.MaxUint {
+			return 0, fmt.Errorf("%w %q", ErrInvalid, s)
+		}
+		return ID(n), nil
+	}
+
+	n, err := strconv.ParseUint(s, 10, strconv.IntSize)
+	if err != nil || n == 0 || s[0] == '0' {
+		return 0, fmt.Errorf("%w %q", ErrInvalid, s)
+	}
+	return ID(n), nil
+}
+
+// String returns the public form of the ID, or its number. The zero ID,
+// which refers to nothing, is empty in public form.
+func (id ID) String() string {
+	if codec == nil {
+		return strconv.FormatUint(uint64(id), 10)
+	}
+	if id == 0 {
+		return ""
+	}
+	s, err := codec.Encode(uint64(id))
+	if err != nil {
+		// Every uint fits the codecs, so this is a programming error
+		panic(fmt.Sprintf("ids: encode %d: %v", uint64(id), err))
+	}
+	return s
+}
+
+// MarshalJSON writes the ID as a number, or as a string in public form
+func (id ID) MarshalJSON() ([]byte, error) {
+	if codec == nil {
+		return strconv.AppendUint(nil, uint64(id), 10), nil
+	}
+	return json.Marshal(id.String())
+}
+
+// UnmarshalJSON reads an ID written as a number or a string. In public form
+// only strings are accepted, and null or an empty string is the zero ID.
+func (id *ID) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*id = 0
+		return nil
+	}
+	if data[0] != '"' {
+		if codec != nil {
+			return fmt.Errorf("%w %s, expected a string", ErrInvalid, data)
+		}
+		n, err := strconv.ParseUint(string(data), 10, strconv.IntSize)
+		if err != nil {
+			return fmt.Errorf("%w %s", ErrInvalid, data)
+		}
+		*id = ID(n)
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return id.UnmarshalParam(s)
+}
+
+// UnmarshalParam reads an ID from a query parameter for gin's binding. An
+// empty parameter is the zero ID.
+func (id *ID) UnmarshalParam(param string) error {
+	if param == "" {
+		*id = 0
+		return nil
+	}
+	parsed, err := Parse(param)
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// Hashids encodes IDs as hashids
+type Hashids struct {
+	hash *hashids.HashID
+}
+
+// NewHashids returns a hashids codec. The salt makes the IDs of a
+// deployment unguessable and must be kept secret and stable.
+func NewHashids(salt string, minLength int) (*Hashids, error) {
+	if salt == "" {
+		return nil, errors.New("ids: hashids need a salt")
+	}
+	data := hashids.NewData()
+	data.Salt = salt
+	data.MinLength = minLength
+	hash, err := hashids.NewWithData(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Hashids{hash: hash}, nil
+}
+
+func (h *Hashids) Encode(id uint64) (string, error) {
+	if id > math.MaxInt64 {
+		return "", fmt.Errorf("ids: %d is too large for hashids", id)
+	}
+	return h.hash.EncodeInt64([]int64{int64(id)})
+}
+
+func (h *Hashids) Decode(s string) (uint64, error) {
+	// DecodeInt64WithError re-encodes the result, so only the canonical
+	// hash of an ID decodes
+	numbers, err := h.hash.DecodeInt64WithError(s)
+	if err != nil {
+		return 0, err
+	}
+	if len(numbers) != 1 || numbers[0] < 0 {
+		return 0, ErrInvalid
+	}
+	return uint64(numbers[0]), nil
+}
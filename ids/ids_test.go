@@ -0,0 +1,99 @@
+package ids
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func useHashids(t *testing.T, salt string) *Hashids {
+	t.Helper()
+	codec, err := NewHashids(salt, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Use(codec)
+	t.Cleanup(func() { Use(nil) })
+	return codec
+}
+
+func TestParseNumeric(t *testing.T) {
+	for _, s := range []string{"1", "42", "18446744073709551615"} {
+		id, err := Parse(s)
+		if err != nil || id.String() != s {
+			t.Errorf("Parse(%q) = %v, %v", s, id, err)
+		}
+	}
+	for _, s := range []string{"", "0", "007", "-1", "+1", "1.5", "x", "18446744073709551616"} {
+		if _, err := Parse(s); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) error = %v, want %v", s, err, ErrInvalid)
+		}
+	}
+}
+
+func TestHashidsRoundTrip(t *testing.T) {
+	useHashids(t, "salt")
+	for _, n := range []ID{1, 2, 1000, math.MaxInt64} {
+		s := n.String()
+		if len(s) < 8 {
+			t.Errorf("public ID %q of %d shorter than the minimum length", s, n)
+		}
+		if id, err := Parse(s); err != nil || id != n {
+			t.Errorf("Parse(%q) = %d, %v, want %d", s, id, err, n)
+		}
+	}
+	if s := ID(0).String(); s != "" {
+		t.Errorf("zero ID = %q, want empty", s)
+	}
+}
+
+// TestHashidsRejected rejects numeric IDs, hashes of another salt and
+// hashes that decode but aren't the canonical form of an ID
+func TestHashidsRejected(t *testing.T) {
+	other, err := NewHashids("other salt", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherHash, _ := other.Encode(1)
+	codec := useHashids(t, "salt")
+	several, _ := codec.hash.EncodeInt64([]int64{1, 2})
+
+	for _, s := range []string{"1", "42", "", otherHash, several, ID(1).String() + "a"} {
+		if _, err := Parse(s); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) error = %v, want %v", s, err, ErrInvalid)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type book struct {
+		ID          ID  `json:"id"`
+		AuthorID    ID  `json:"author_id"`
+		PublisherID *ID `json:"publisher_id"`
+	}
+
+	data, _ := json.Marshal(book{ID: 3, AuthorID: 4})
+	if want := `{"id":3,"author_id":4,"publisher_id":null}`; string(data) != want {
+		t.Errorf("numeric JSON = %s, want %s", data, want)
+	}
+	var numeric book
+	if err := json.Unmarshal([]byte(`{"id": 3, "author_id": "4"}`), &numeric); err != nil || numeric.ID != 3 || numeric.AuthorID != 4 {
+		t.Errorf("numeric Unmarshal = %+v, %v", numeric, err)
+	}
+
+	useHashids(t, "salt")
+	data, _ = json.Marshal(book{ID: 3})
+	if want := `{"id":"` + ID(3).String() + `","author_id":"","publisher_id":null}`; string(data) != want {
+		t.Errorf("public JSON = %s, want %s", data, want)
+	}
+	var public book
+	if err := json.Unmarshal(data, &public); err != nil || public.ID != 3 || public.AuthorID != 0 {
+		t.Errorf("public Unmarshal = %+v, %v", public, err)
+	}
+	for _, body := range []string{`{"id": 3}`, `{"id": "3"}`} {
+		if err := json.Unmarshal([]byte(body), &public); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Unmarshal(%s) error = %v, want %v", body, err, ErrInvalid)
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mentalartsapi/cache"
+	"mentalartsapi/ids"
+	"mentalartsapi/metrics"
+	"mentalartsapi/models"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Format of an import file
+type Format string
+
+const (
+	CSV     Format = "csv"
+	NDJSON  Format = "ndjson"
+	MARC21  Format = "marc"
+	MARCXML Format = "marcxml"
+)
+
+// FormatFromFilename detects the format of an import file from its
+// extension. It returns an empty format if the extension is unknown.
+func FormatFromFilename(name string) Format {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return CSV
+	case ".ndjson", ".jsonl":
+		return NDJSON
+	case ".mrc", ".marc":
+		return MARC21
+	case ".xml":
+		return MARCXML
+	}
+	return ""
+}
+
+// DefaultBatchSize is the number of rows written per transaction
+const DefaultBatchSize = 500
+
+var validFormats = map[string]bool{
+	models.FormatHardcover: true,
+	models.FormatPaperback: true,
+	models.FormatEbook:     true,
+	models.FormatAudiobook: true,
+}
+
+var (
+	// ErrInvalidFile is returned when an import file can't be read at all
+	ErrInvalidFile = errors.New("invalid import file")
+
+	errDryRun = errors.New("dry run")
+)
+
+// Options control an import
+type Options struct {
+	// DryRun validates and writes every row inside a transaction that is
+	// rolled back at the end, so the report matches what a commit would do
+	DryRun    bool
+	BatchSize int
+}
+
+// RowError describes why a single row was not imported
+type RowError struct {
+	Row     int    `json:"row"`
+	ISBN    string `json:"isbn,omitempty"`
+	Message string `json:"error"`
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+}
+
+// Report summarises an import
+type Report struct {
+	DryRun         bool       `json:"dry_run"`
+	Rows           int        `json:"rows"`
+	AuthorsCreated int        `json:"authors_created"`
+	BooksCreated   int        `json:"books_created"`
+	BooksUpdated   int        `json:"books_updated"`
+	Failed         int        `json:"failed"`
+	Errors         []RowError `json:"errors"`
+}
+
+// Import upserts authors by name and books by ISBN from a CSV, NDJSON,
+// MARC21 or MARCXML file. Rows that fail are reported individually instead of failing the
+// whole file. Queries run through db, so they are scoped to the tenant in
+// its context.
+func Import(ctx context.Context, db *gorm.DB, r io.Reader, format Format, opts Options) (*Report, error) {
+	reader, err := newRowReader(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	imp := &importer{
+		reader:  reader,
+		opts:    opts,
+		authors: map[string]ids.ID{},
+		isbns:   map[string]int{},
+		report:  &Report{DryRun: opts.DryRun, Errors: []RowError{}},
+	}
+
+	db = db.WithContext(ctx)
+	if opts.DryRun {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := imp.run(tx); err != nil {
+				return err
+			}
+			return errDryRun
+		})
+		if errors.Is(err, errDryRun) {
+			err = nil
+		}
+	} else {
+		err = imp.run(db)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !opts.DryRun {
+		metrics.AuthorsCreated.Add(float64(imp.report.AuthorsCreated))
+		metrics.BooksCreated.Add(float64(imp.report.BooksCreated))
+		cache.Invalidate(ctx, imp.cacheTags...)
+	}
+
+	// Rows retried after a failed batch are reported out of order
+	sort.SliceStable(imp.report.Errors, func(i, j int) bool {
+		return imp.report.Errors[i].Row < imp.report.Errors[j].Row
+	})
+	return imp.report, nil
+}
+
+type importer struct {
+	reader rowReader
+	opts   Options
+	// authors maps normalised author names to IDs seen so far
+	authors map[string]ids.ID
+	// isbns maps the ISBNs seen so far to the row they were first seen on
+	isbns  map[string]int
+	report *Report
+	// cacheTags are the cache tags of the committed changes
+	cacheTags []string
+}
+
+func (imp *importer) run(db *gorm.DB) error {
+	batch := make([]Row, 0, imp.opts.BatchSize)
+	for {
+		row, err := imp.reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var rowErr *RowError
+			if errors.As(err, &rowErr) {
+				imp.report.Rows++
+				imp.fail(*rowErr)
+				continue
+			}
+			return err
+		}
+
+		imp.report.Rows++
+		if err := imp.validate(row); err != nil {
+			imp.fail(RowError{Row: row.Line, ISBN: row.ISBN, Message: err.Error()})
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == imp.opts.BatchSize {
+			if err := imp.flush(db, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	if len(batch) > 0 {
+		return imp.flush(db, batch)
+	}
+	return nil
+}
+
+func (imp *importer) fail(rowErr RowError) {
+	imp.report.Failed++
+	imp.report.Errors = append(imp.report.Errors, rowErr)
+}
+
+func (imp *importer) validate(row Row) error {
+	switch {
+	case row.Title == "":
+		return errors.New("title is required")
+	case row.ISBN == "":
+		return errors.New("isbn is required")
+	case row.Author == "":
+		return errors.New("author is required")
+	case row.Format != "" && !validFormats[row.Format]:
+		return fmt.Errorf("format %q is not one of hardcover, paperback, ebook, audiobook", row.Format)
+	case row.PageCount < 0:
+		return errors.New("page_count must not be negative")
+	case row.EditionNumber < 0:
+		return errors.New("edition_number must not be negative")
+	}
+
+	if row.AuthorBirthDate != "" {
+		if _, err := parseDate(row.AuthorBirthDate); err != nil {
+			return errors.New("author_birth_date must be a YYYY-MM-DD date")
+		}
+	}
+
+	if first, ok := imp.isbns[row.ISBN]; ok {
+		return fmt.Errorf("isbn already appears on row %d", first)
+	}
+	imp.isbns[row.ISBN] = row.Line
+	return nil
+}
+
+// flush writes a batch in one transaction. If the batch fails as a whole,
+// its rows are retried one by one so that the failure is pinned to a row.
+func (imp *importer) flush(db *gorm.DB, batch []Row) error {
+	var result *batchResult
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = imp.write(tx, batch)
+		return err
+	})
+	if err == nil {
+		imp.apply(result)
+		return nil
+	}
+	if len(batch) == 1 {
+		imp.fail(RowError{Row: batch[0].Line, ISBN: batch[0].ISBN, Message: err.Error()})
+		return nil
+	}
+
+	for _, row := range batch {
+		if err := imp.flush(db, []Row{row}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchResult holds the outcome of a batch until its transaction commits
+type batchResult struct {
+	authors        map[string]ids.ID
+	authorsCreated int
+	booksCreated   int
+	booksUpdated   int
+	errors         []RowError
+	cacheTags      []string
+}
+
+func (imp *importer) apply(result *batchResult) {
+	for name, id := range result.authors {
+		imp.authors[name] = id
+	}
+	imp.report.AuthorsCreated += result.authorsCreated
+	imp.report.BooksCreated += result.booksCreated
+	imp.report.BooksUpdated += result.booksUpdated
+	imp.cacheTags = append(imp.cacheTags, result.cacheTags...)
+	for _, rowErr := range result.errors {
+		imp.fail(rowErr)
+	}
+}
+
+func (imp *importer) write(tx *gorm.DB, batch []Row) (*batchResult, error) {
+	result := &batchResult{authors: map[string]ids.ID{}}
+
+	authorIDs, err := imp.resolveAuthors(tx, batch, result)
+	if err != nil {
+		return nil, err
+	}
+
+	isbns := make([]string, len(batch))
+	for i, row := range batch {
+		isbns[i] = row.ISBN
+	}
+	// Deleted books keep their ISBNs, which stay unique
+	var existing []models.Book
+	if err := tx.Unscoped().Where("isbn IN ?", isbns).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	existingByISBN := make(map[string]models.Book, len(existing))
+	for _, book := range existing {
+		existingByISBN[book.ISBN] = book
+	}
+
+	var newRows []Row
+	for _, row := range batch {
+		authorID := authorIDs[normaliseName(row.Author)]
+		book, ok := existingByISBN[row.ISBN]
+		if !ok {
+			newRows = append(newRows, row)
+			continue
+		}
+
+		if book.DeletedAt.Valid {
+			result.errors = append(result.errors, RowError{Row: row.Line, ISBN: row.ISBN,
+				Message: "isbn belongs to a deleted book"})
+			continue
+		}
+		if book.AuthorID != authorID {
+			result.errors = append(result.errors, RowError{Row: row.Line, ISBN: row.ISBN,
+				Message: "isbn belongs to a book by a different author"})
+			continue
+		}
+
+		if err := tx.Model(&book).Updates(map[string]interface{}{
+			"title":            row.Title,
+			"publication_year": row.PublicationYear,
+			"description":      row.Description,
+			"format":           row.Format,
+			"language":         row.Language,
+			"page_count":       row.PageCount,
+			"edition_number":   row.EditionNumber,
+		}).Error; err != nil {
+			return nil, err
+		}
+		result.booksUpdated++
+		result.cacheTags = append(result.cacheTags, "books", cache.Row("books", book.ID))
+	}
+
+	if len(newRows) == 0 {
+		return result, nil
+	}
+
+	// Every new book starts a work of its own, as it does through the API
+	works := make([]models.Work, len(newRows))
+	for i, row := range newRows {
+		works[i] = models.Work{
+			Title:       row.Title,
+			Description: row.Description,
+			AuthorID:    authorIDs[normaliseName(row.Author)],
+		}
+	}
+	if err := tx.CreateInBatches(&works, imp.opts.BatchSize).Error; err != nil {
+		return nil, err
+	}
+
+	books := make([]models.Book, len(newRows))
+	for i, row := range newRows {
+		books[i] = models.Book{
+			Title:           row.Title,
+			ISBN:            row.ISBN,
+			PublicationYear: row.PublicationYear,
+			Description:     row.Description,
+			Format:          row.Format,
+			Language:        row.Language,
+			PageCount:       row.PageCount,
+			EditionNumber:   row.EditionNumber,
+			AuthorID:        works[i].AuthorID,
+			WorkID:          works[i].ID,
+		}
+	}
+	if err := tx.Omit("Author", "Work", "Publisher").CreateInBatches(&books, imp.opts.BatchSize).Error; err != nil {
+		return nil, err
+	}
+	result.booksCreated = len(books)
+	result.cacheTags = append(result.cacheTags, "books")
+	for _, book := range books {
+		result.cacheTags = append(result.cacheTags, cache.Children("authors", book.AuthorID, "books"))
+	}
+
+	return result, nil
+}
+
+// resolveAuthors looks up the authors of a batch by name and creates the
+// ones that don't exist yet
+func (imp *importer) resolveAuthors(tx *gorm.DB, batch []Row, result *batchResult) (map[string]ids.ID, error) {
+	authorIDs := map[string]ids.ID{}
+	var missing []string
+	firstRow := map[string]Row{}
+	for _, row := range batch {
+		name := normaliseName(row.Author)
+		if id, ok := imp.authors[name]; ok {
+			authorIDs[name] = id
+			continue
+		}
+		if _, ok := firstRow[name]; !ok {
+			firstRow[name] = row
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return authorIDs, nil
+	}
+
+	// Stored names may be spaced differently, so the query finds the names
+	// with the same words and the normalised names are compared here
+	conditions := make([]string, len(missing))
+	patterns := make([]interface{}, len(missing))
+	for i, name := range missing {
+		conditions[i] = `LOWER(name) LIKE ? ESCAPE '\'`
+		patterns[i] = namePattern(name)
+	}
+	var found []models.Author
+	if err := tx.Where(strings.Join(conditions, " OR "), patterns...).Order("id").Find(&found).Error; err != nil {
+		return nil, err
+	}
+	for _, author := range found {
+		name := normaliseName(author.Name)
+		if _, ok := firstRow[name]; !ok {
+			continue
+		}
+		if _, ok := authorIDs[name]; !ok {
+			authorIDs[name] = author.ID
+			result.authors[name] = author.ID
+		}
+	}
+
+	var created []models.Author
+	for _, name := range missing {
+		if _, ok := authorIDs[name]; ok {
+			continue
+		}
+		row := firstRow[name]
+		birthDate, _ := parseDate(row.AuthorBirthDate)
+		created = append(created, models.Author{
+			Name:      strings.TrimSpace(row.Author),
+			Biography: row.AuthorBiography,
+			BirthDate: birthDate,
+		})
+	}
+	if len(created) == 0 {
+		return authorIDs, nil
+	}
+
+	if err := tx.CreateInBatches(&created, imp.opts.BatchSize).Error; err != nil {
+		return nil, err
+	}
+	for _, author := range created {
+		name := normaliseName(author.Name)
+		authorIDs[name] = author.ID
+		result.authors[name] = author.ID
+	}
+	result.authorsCreated = len(created)
+	result.cacheTags = append(result.cacheTags, "authors")
+
+	return authorIDs, nil
+}
+
+func normaliseName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// namePattern returns a LIKE pattern matching the names whose words are the
+// words of a normalised name, whatever the spacing around them
+func namePattern(name string) string {
+	return "%" + strings.Join(strings.Fields(likeEscaper.Replace(name)), "%") + "%"
+}
+
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
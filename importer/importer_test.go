@@ -0,0 +1,77 @@
+package importer
+
+import (
+	"context"
+	"mentalartsapi/models"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Author{}, &models.Publisher{}, &models.Work{}, &models.Book{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func importCSV(t *testing.T, db *gorm.DB, csv string) *Report {
+	t.Helper()
+	report, err := Import(context.Background(), db, strings.NewReader(csv), CSV, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestImportDeletedISBN(t *testing.T) {
+	db := testDB(t)
+	importCSV(t, db, "title,isbn,author\nThe Dispossessed,9780061054884,Ursula K. Le Guin\n")
+	if err := db.Where("isbn = ?", "9780061054884").Delete(&models.Book{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	report := importCSV(t, db, "title,isbn,author\nThe Dispossessed,9780061054884,Ursula K. Le Guin\n")
+	if report.Failed != 1 || report.BooksCreated != 0 {
+		t.Fatalf("report = %+v, want the row failed", report)
+	}
+	if got, want := report.Errors[0].Message, "isbn belongs to a deleted book"; got != want {
+		t.Errorf("error = %q, want %q", got, want)
+	}
+}
+
+// TestImportAuthorNames matches stored authors whatever their case and
+// spacing, on either side
+func TestImportAuthorNames(t *testing.T) {
+	db := testDB(t)
+	authors := []models.Author{{Name: " Ursula  K. Le Guin"}, {Name: "Octavia_Butler"}}
+	if err := db.Create(&authors).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	report := importCSV(t, db, "title,isbn,author\n"+
+		"The Dispossessed,9780061054884,ursula k.   le guin\n"+
+		"Kindred,9780807083697,Octavia Butler\n")
+	if report.Failed != 0 || report.BooksCreated != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	// Underscores are not wildcards, so Octavia Butler is a new author
+	if report.AuthorsCreated != 1 {
+		t.Errorf("%d authors created, want 1", report.AuthorsCreated)
+	}
+
+	var book models.Book
+	if err := db.Where("isbn = ?", "9780061054884").First(&book).Error; err != nil {
+		t.Fatal(err)
+	}
+	if book.AuthorID != authors[0].ID {
+		t.Errorf("book by author %d, want the existing author %d", book.AuthorID, authors[0].ID)
+	}
+}
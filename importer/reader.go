@@ -0,0 +1,212 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mentalartsapi/marc"
+	"strconv"
+	"strings"
+)
+
+// Row is one book of an import file together with its author
+type Row struct {
+	Line            int    `json:"-"`
+	Title           string `json:"title"`
+	ISBN            string `json:"isbn"`
+	PublicationYear int    `json:"publication_year"`
+	Description     string `json:"description"`
+	Format          string `json:"format"`
+	Language        string `json:"language"`
+	PageCount       int    `json:"page_count"`
+	EditionNumber   int    `json:"edition_number"`
+	Author          string `json:"author"`
+	AuthorBiography string `json:"author_biography"`
+	AuthorBirthDate string `json:"author_birth_date"`
+}
+
+// rowReader yields rows until io.EOF. A *RowError means that a single row
+// could not be read and the next call continues with the following row.
+type rowReader interface {
+	next() (Row, error)
+}
+
+func newRowReader(r io.Reader, format Format) (rowReader, error) {
+	switch format {
+	case CSV:
+		return newCSVReader(r)
+	case NDJSON:
+		return &ndjsonReader{scanner: newLineScanner(r)}, nil
+	case MARC21:
+		return &marcReader{read: marc.NewReader(r).Read}, nil
+	case MARCXML:
+		return &marcReader{read: marc.NewXMLReader(r).Read}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported import format %q", ErrInvalidFile, format)
+	}
+}
+
+type csvReader struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: csv file is empty", ErrInvalidFile)
+		}
+		return nil, fmt.Errorf("%w: could not read csv header: %v", ErrInvalidFile, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"title", "isbn", "author"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("%w: csv header is missing the %q column", ErrInvalidFile, required)
+		}
+	}
+
+	return &csvReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvReader) next() (Row, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return Row{}, &RowError{Row: parseErr.StartLine, Message: parseErr.Err.Error()}
+		}
+		return Row{}, err
+	}
+
+	line, _ := r.reader.FieldPos(0)
+	field := func(name string) string {
+		if i, ok := r.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	row := Row{
+		Line:            line,
+		Title:           field("title"),
+		ISBN:            field("isbn"),
+		Description:     field("description"),
+		Format:          field("format"),
+		Language:        field("language"),
+		Author:          field("author"),
+		AuthorBiography: field("author_biography"),
+		AuthorBirthDate: field("author_birth_date"),
+	}
+
+	for name, target := range map[string]*int{
+		"publication_year": &row.PublicationYear,
+		"page_count":       &row.PageCount,
+		"edition_number":   &row.EditionNumber,
+	} {
+		value := field(name)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return Row{}, &RowError{Row: line, ISBN: row.ISBN, Message: fmt.Sprintf("%s must be a whole number", name)}
+		}
+		*target = number
+	}
+
+	return row, nil
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	return scanner
+}
+
+func (r *ndjsonReader) next() (Row, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var row Row
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row); err != nil {
+			return Row{}, &RowError{Row: r.line, Message: "invalid json: " + err.Error()}
+		}
+		row.Line = r.line
+		trimRow(&row)
+		return row, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return Row{}, err
+	}
+	return Row{}, io.EOF
+}
+
+func trimRow(row *Row) {
+	for _, value := range []*string{&row.Title, &row.ISBN, &row.Description, &row.Format,
+		&row.Language, &row.Author, &row.AuthorBiography, &row.AuthorBirthDate} {
+		*value = strings.TrimSpace(*value)
+	}
+}
+
+// marcReader maps MARC21 bibliographic records onto rows. Row numbers are
+// record numbers, counting from 1.
+type marcReader struct {
+	read   func() (marc.Record, error)
+	record int
+}
+
+func (r *marcReader) next() (Row, error) {
+	record, err := r.read()
+	if errors.Is(err, io.EOF) {
+		return Row{}, io.EOF
+	}
+	r.record++
+	if errors.Is(err, marc.ErrInvalidRecord) {
+		return Row{}, &RowError{Row: r.record, Message: err.Error()}
+	}
+	if err != nil {
+		return Row{}, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+
+	book, err := marc.ToBook(record)
+	if err != nil {
+		return Row{}, &RowError{Row: r.record, Message: err.Error()}
+	}
+
+	return Row{
+		Line:            r.record,
+		Title:           book.Title,
+		ISBN:            book.ISBN,
+		PublicationYear: book.PublicationYear,
+		Description:     book.Description,
+		Language:        book.Language,
+		PageCount:       book.PageCount,
+		Author:          book.Author.Name,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// records decodes the JSON records written to buf
+func records(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var result []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("record %q is not JSON: %v", line, err)
+		}
+		result = append(result, record)
+	}
+	return result
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+	ctx := WithRequestID(context.Background(), "req-1")
+
+	logger.DebugContext(ctx, "hidden")
+	logger.InfoContext(ctx, "shown")
+	logger.With("component", "cache").WarnContext(ctx, "with attrs")
+	logger.Info("no request")
+
+	got := records(t, &buf)
+	if len(got) != 3 {
+		t.Fatalf("%d records, want 3: %s", len(got), buf.String())
+	}
+	for i, want := range []string{"req-1", "req-1", ""} {
+		id, _ := got[i][RequestIDKey].(string)
+		if id != want {
+			t.Errorf("record %q request_id = %q, want %q", got[i]["msg"], id, want)
+		}
+	}
+	if got[1]["component"] != "cache" {
+		t.Errorf("record lost its attributes: %v", got[1])
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, want := range map[string]slog.Level{"debug": slog.LevelDebug, " WARN ": slog.LevelWarn, "error": slog.LevelError} {
+		if level, err := ParseLevel(name); err != nil || level != want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", name, level, err, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) succeeded")
+	}
+}
+
+func TestRequests(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(New(&buf, slog.LevelInfo))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Requests())
+	router.GET("/books/:id", func(c *gin.Context) {
+		c.Status(map[string]int{"1": http.StatusOK, "2": http.StatusNotFound, "3": http.StatusInternalServerError}[c.Param("id")])
+	})
+
+	ids := []string{"1", "2", "3"}
+	for _, id := range ids {
+		req := httptest.NewRequest(http.MethodGet, "/books/"+id, nil)
+		router.ServeHTTP(httptest.NewRecorder(), req.WithContext(WithRequestID(req.Context(), "req-"+id)))
+	}
+
+	got := records(t, &buf)
+	if len(got) != 3 {
+		t.Fatalf("%d records, want 3", len(got))
+	}
+	for i, want := range []string{"INFO", "WARN", "ERROR"} {
+		if got[i]["level"] != want || got[i]["route"] != "/books/:id" || got[i][RequestIDKey] != "req-"+ids[i] {
+			t.Errorf("record %d = %v, want level %s", i, got[i], want)
+		}
+	}
+}
+
+func TestGORMLoggerTrace(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewGORMLogger(New(&buf, slog.LevelDebug), 10*time.Millisecond)
+	statement := func() (string, int64) { return "SELECT 1", 1 }
+
+	logger.Trace(context.Background(), time.Now(), statement, nil)
+	logger.Trace(context.Background(), time.Now().Add(-time.Second), statement, nil)
+	logger.Trace(context.Background(), time.Now(), statement, errors.New("no such table"))
+	// Lookups of missing records are not failures
+	logger.Trace(context.Background(), time.Now(), statement, gorm.ErrRecordNotFound)
+
+	got := records(t, &buf)
+	want := []struct{ level, msg string }{
+		{"DEBUG", "query"}, {"WARN", "slow query"}, {"ERROR", "query failed"}, {"DEBUG", "query"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("%d records, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		if got[i]["level"] != w.level || got[i]["msg"] != w.msg || got[i]["sql"] != "SELECT 1" {
+			t.Errorf("record %d = %v, want %s %q", i, got[i], w.level, w.msg)
+		}
+	}
+}
@@ -1,15 +1,39 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
+	"log/slog"
+	"mentalartsapi/cache"
+	"mentalartsapi/config"
+	"mentalartsapi/docs"
+	"mentalartsapi/graph"
+	"mentalartsapi/grpcapi"
 	"mentalartsapi/handlers"
+	"mentalartsapi/health"
+	"mentalartsapi/ids"
+	"mentalartsapi/logging"
+	"mentalartsapi/metrics"
+	"mentalartsapi/middleware"
 	"mentalartsapi/models"
-	_ "mentalartsapi/docs" // swagger docs
+	"mentalartsapi/openapi"
+	"mentalartsapi/ratelimit"
+	"mentalartsapi/storage"
+	"mentalartsapi/tenancy"
+	"mentalartsapi/tracing"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"gorm.io/driver/postgres"
@@ -36,43 +60,222 @@ import (
 // @description Type "Bearer" followed by a space and JWT token.
 func main() {
 	// Load .env file if it exists
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found or error loading it.")
+	envErr := godotenv.Load()
+
+	// Settings come from defaults, a config file, the environment and
+	// flags, in increasing order of precedence
+	cfg, args, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
 
-	// Set default values if environment variables are not set
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "123abcd")
-	dbName := getEnv("DB_NAME", "postgres")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbSSLMode := getEnv("DB_SSLMODE", "disable")
-	apiPort := getEnv("API_PORT", "8000")
+	// Print the effective configuration without connecting to anything
+	if len(args) > 0 && args[0] == "config" {
+		if err := cfg.Dump(os.Stdout); err != nil {
+			log.Fatalf("Could not print configuration: %v", err)
+		}
+		return
+	}
+
+	// Log JSON records from LOG_LEVEL up, including those of the log package
+	logLevel, _ := logging.ParseLevel(cfg.Logging.Level)
+	logger := logging.New(os.Stderr, logLevel)
+	slog.SetDefault(logger)
+	if envErr != nil {
+		slog.Info("No .env file found or error loading it.")
+	}
 
 	// Configure Gin mode
-	ginMode := getEnv("GIN_MODE", "debug")
-	gin.SetMode(ginMode)
+	gin.SetMode(cfg.Server.Mode)
 
 	// Connect to database
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
-		dbHost, dbUser, dbPassword, dbName, dbPort, dbSSLMode)
+	db, err := gorm.Open(postgres.Open(cfg.Database.DSN()), &gorm.Config{
+		Logger: logging.NewGORMLogger(logger, cfg.Database.SlowQueryThreshold),
+	})
+	if err != nil {
+		fatal("Could not connect database", err)
+	}
+
+	// Scope every query to the tenant of the request
+	if err := db.Use(tenancy.Plugin{}); err != nil {
+		fatal("Could not register tenancy plugin", err)
+	}
+
+	// Time every query and export the connection pool stats
+	if err := db.Use(metrics.GORMPlugin{}); err != nil {
+		fatal("Could not register metrics plugin", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		fatal("Could not get database connection pool", err)
+	}
+	if err := metrics.RegisterDB(sqlDB, cfg.Database.Name); err != nil {
+		fatal("Could not register database metrics", err)
+	}
+
+	// Size the connection pool, and close it once the server has drained
+	sqlDB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.Database.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.Database.ConnMaxIdleTime)
+	defer sqlDB.Close()
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// Trace requests and their SQL statements when an OTLP endpoint is set
+	if err := db.Use(tracing.GORMPlugin{}); err != nil {
+		fatal("Could not register tracing plugin", err)
+	}
+	tracerProvider, err := tracing.InstallFromEnv(context.Background())
 	if err != nil {
-		log.Fatalf("Could not connect database: %v", err)
+		fatal("Could not configure tracing", err)
+	}
+	if tracerProvider != nil {
+		defer tracerProvider.Shutdown(context.Background())
 	}
 
 	// Auto migrate models
-	db.AutoMigrate(&models.Author{}, &models.Book{}, &models.Review{})
+	if err := models.Migrate(db, cfg.Tenancy.DefaultTenant); err != nil {
+		fatal("Could not migrate database", err)
+	}
+
+	// Cache hot reads; imports from the CLI invalidate a shared cache too
+	cacheStore, err := newCacheStore(cfg.Cache)
+	if err != nil {
+		fatal("Could not initialize cache", err)
+	}
+	if cacheStore != nil {
+		cache.Use(cacheStore, cfg.Cache.TTL)
+	}
+
+	// Run a CLI command instead of the server if one was given
+	if len(args) > 0 && args[0] == "import" {
+		if err := runImport(db, cfg.Tenancy.DefaultTenant, args[1:]); err != nil {
+			fatal("Import failed", err)
+		}
+		return
+	}
+
+	// Expose IDs as hashids instead of numbers if configured
+	codec, err := publicIDCodec(cfg.PublicIDs)
+	if err != nil {
+		fatal("Could not configure public IDs", err)
+	}
+	ids.Use(codec)
 
 	// Initialize DB in handlers
 	handlers.InitDB(db)
+	handlers.InitExports(cfg.Server.WriteTimeout)
 
 	// Create router
-	router := gin.Default()
+	tenantConfig := middleware.TenantConfig{
+		BaseDomain:    cfg.Tenancy.BaseDomain,
+		TokenSecret:   cfg.Tenancy.JWTSecret,
+		TrustHeaders:  cfg.Tenancy.TrustHeaders,
+		DefaultTenant: cfg.Tenancy.DefaultTenant,
+	}
+	limitStore, err := newRateLimitStore(cfg.RateLimit)
+	if err != nil {
+		fatal("Could not initialize rate limiting", err)
+	}
+	router := setupRouter(db, tenantConfig, cfg.Tenancy.AdminToken, cfg.Idempotency, limitStore, cfg.RateLimit, cfg.Server.Proxies())
+
+	// Cover image storage
+	coverStore, err := newCoverStore(router, cfg.Covers, cfg.S3)
+	if err != nil {
+		fatal("Could not initialize cover storage", err)
+	}
+	handlers.InitCovers(coverStore, cfg.Covers.MaxBytes)
+
+	// gRPC API and its optional JSON gateway, behind the middleware of the
+	// REST API
+	stopGRPC, err := startGRPC(db, tenantConfig, cfg.GRPC, cfg.Server, func(gateway http.Handler) http.Handler {
+		return setupGateway(gateway, db, tenantConfig, cfg.Tenancy.AdminToken, cfg.Idempotency, limitStore, cfg.RateLimit, cfg.Server.Proxies())
+	})
+	if err != nil {
+		fatal("Could not start gRPC server", err)
+	}
+
+	// Start server
+	server := newServer(cfg.Server.Port, router, cfg.Server)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server starting", "port", cfg.Server.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serverErr:
+		fatal("Server failed", err)
+	case <-ctx.Done():
+	}
+
+	// Stop accepting requests and let those in flight finish, up to the
+	// deadline. The database pool and the tracer are closed by the deferred
+	// calls once they have.
+	slog.Info("Shutting down", "timeout", cfg.Server.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Server did not drain in time", "error", err)
+	}
+	stopGRPC(shutdownCtx)
+	slog.Info("Server stopped")
+}
+
+// newServer creates an HTTP server on port with the timeouts and header size
+// limit of settings. Exports extend their write deadline as they stream, so
+// the write timeout only needs to be long enough for other responses.
+func newServer(port int, handler http.Handler, settings config.Server) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           handler,
+		ReadHeaderTimeout: settings.ReadHeaderTimeout,
+		ReadTimeout:       settings.ReadTimeout,
+		WriteTimeout:      settings.WriteTimeout,
+		IdleTimeout:       settings.IdleTimeout,
+		MaxHeaderBytes:    settings.MaxHeaderBytes,
+	}
+}
+
+// setupRouter registers the HTTP routes. Every route under /api/v1 must be
+// annotated on its handler, so that it is in the OpenAPI spec. Clients are
+// rate limited with the buckets of limitStore, unless it is nil, and
+// identified by IP when anonymous. Only trustedProxies may forward the IP
+// of the client; the IP of any other peer is the client's.
+func setupRouter(db *gorm.DB, tenantConfig middleware.TenantConfig, adminToken string, idempotency config.Idempotency,
+	limitStore ratelimit.Store, limits config.RateLimit, trustedProxies []string) *gin.Engine {
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		fatal("Could not trust proxies", err)
+	}
+
+	// Give every request an ID for its logs and errors, log it, trace it,
+	// and count and time it by route
+	router.Use(middleware.RequestID(), logging.Requests(), middleware.Recovery(), tracing.HTTP(), metrics.HTTP())
+
+	tenant := middleware.Tenant(db, tenantConfig)
+
+	// Each group has buckets of its own, and writes cost more than reads.
+	// Clients are limited before their tenant is looked up, so that floods
+	// don't reach the database.
+	clientKey := middleware.ClientKey(tenantConfig.TokenSecret, adminToken)
+	limitAPI := middleware.RateLimitByMethod(limitStore, clientKey, "api", limits.Reads, limits.Writes)
+	limitExports := middleware.RateLimit(limitStore, clientKey, "export", limits.Exports)
+	limitGraphQL := middleware.RateLimit(limitStore, clientKey, "graphql", limits.GraphQL)
+	limitAdmin := middleware.RateLimitByMethod(limitStore, clientKey, "admin", limits.Reads, limits.Writes)
+
+	// POSTs with an Idempotency-Key replay their first response when retried
+	idempotent := middleware.Idempotency(db, idempotency.TTL, idempotency.MaxBodyBytes)
+
+	// Requests are checked against the OpenAPI spec before the handlers run,
+	// and outside release mode so are the responses
+	validator := openapi.MustNewValidator(docs.OpenAPI)
+	validate := middleware.ValidateRequests(validator, gin.Mode() != gin.ReleaseMode)
 
 	// API v1 routes
 	v1 := router.Group("/api/v1")
+	v1.Use(middleware.Negotiate(), limitAPI, tenant, idempotent, validate)
 	{
 		// Authors routes
 		v1.POST("/authors", handlers.CreateAuthor)
@@ -87,34 +290,278 @@ func main() {
 		v1.GET("/books/:id", handlers.GetBook)
 		v1.PUT("/books/:id", handlers.UpdateBook)
 		v1.DELETE("/books/:id", handlers.DeleteBook)
+		v1.PUT("/books/:id/cover", handlers.UploadCover)
+		v1.DELETE("/books/:id/cover", handlers.DeleteCover)
+		v1.POST("/books:action", handlers.BookActions)
+
+		// Works routes
+		v1.GET("/works", handlers.GetAllWorks)
+		v1.GET("/works/:id", handlers.GetWork)
+		v1.PUT("/works/:id", handlers.UpdateWork)
+
+		// Publishers routes
+		v1.POST("/publishers", handlers.CreatePublisher)
+		v1.GET("/publishers", handlers.GetAllPublishers)
+		v1.GET("/publishers/:id", handlers.GetPublisher)
+		v1.PUT("/publishers/:id", handlers.UpdatePublisher)
+		v1.DELETE("/publishers/:id", handlers.DeletePublisher)
+
+		// Series routes
+		v1.POST("/series", handlers.CreateSeries)
+		v1.GET("/series", handlers.GetAllSeries)
+		v1.GET("/series/:id", handlers.GetSeries)
+		v1.PUT("/series/:id", handlers.UpdateSeries)
+		v1.DELETE("/series/:id", handlers.DeleteSeries)
+		v1.PUT("/series/:id/books/:book_id", handlers.SetSeriesBook)
+		v1.DELETE("/series/:id/books/:book_id", handlers.RemoveSeriesBook)
 
 		// Reviews routes
 		v1.GET("/books/:id/reviews", handlers.GetBookReviews)
 		v1.POST("/books/:id/reviews", handlers.CreateReview)
 		v1.PUT("/reviews/:id", handlers.UpdateReview)
 		v1.DELETE("/reviews/:id", handlers.DeleteReview)
+		v1.POST("/reviews:action", handlers.ReviewActions)
+
+		// Import route
+		v1.POST("/import", handlers.ImportCatalogue)
+
+		// Batch route, which runs its operations through the router
+		v1.POST("/batch", handlers.Batch(router))
+	}
+
+	// Export routes choose their format from the query string, not Accept
+	exports := router.Group("/api/v1/export")
+	exports.Use(limitExports, tenant, validate)
+	{
+		exports.GET("/books", handlers.ExportBooks)
 	}
 
+	// GraphQL API, authenticated and scoped to a tenant like the REST API
+	router.POST("/graphql", limitGraphQL, tenant, idempotent, graph.NewHandler(db))
+
+	// Tenant admin routes
+	admin := router.Group("/api/v1/admin")
+	admin.Use(middleware.Negotiate(), limitAdmin, middleware.AdminToken(adminToken), idempotent, validate)
+	{
+		admin.POST("/tenants", handlers.CreateTenant)
+		admin.GET("/tenants", handlers.GetAllTenants)
+		admin.GET("/tenants/:id", handlers.GetTenant)
+		admin.PUT("/tenants/:id", handlers.UpdateTenant)
+		admin.DELETE("/tenants/:id", handlers.DeleteTenant)
+	}
+
+	// Probes: liveness, readiness and the status of every dependency
+	checker := newHealthChecker(db)
+	router.GET("/healthz", handlers.Liveness)
+	router.GET("/readyz", handlers.Readiness(checker))
+	router.GET("/health", handlers.HealthDetails(checker))
+
+	// Prometheus metrics
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	// Test routes
 	router.GET("/ping", handlers.HandlePing)
 	router.GET("/hello", handlers.HandleHello)
 	router.GET("/helloWithPayload", handlers.HandleHelloWithPayload)
 
-	// Swagger documentation
-	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// OpenAPI spec, also browsable with Swagger UI
+	router.GET("/openapi.json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", docs.OpenAPI)
+	})
+	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("/openapi.json")))
 
-	// Start server
-	log.Printf("Server starting on port %s...\n", apiPort)
-	router.Run(fmt.Sprintf(":%s", apiPort))
+	return router
+}
+
+// setupGateway serves the gRPC JSON gateway on the routes of the REST API
+// it maps to, behind the same middleware: clients share their rate limit
+// buckets with the REST API, POSTs may send an Idempotency-Key and requests
+// are checked against the OpenAPI spec. Its responses are shaped by the
+// proto file, so they are not.
+func setupGateway(gateway http.Handler, db *gorm.DB, tenantConfig middleware.TenantConfig, adminToken string, idempotency config.Idempotency,
+	limitStore ratelimit.Store, limits config.RateLimit, trustedProxies []string) *gin.Engine {
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		fatal("Could not trust proxies", err)
+	}
+	router.Use(middleware.RequestID(), logging.Requests(), middleware.Recovery(), tracing.HTTP(), metrics.HTTP())
+
+	clientKey := middleware.ClientKey(tenantConfig.TokenSecret, adminToken)
+	limitAPI := middleware.RateLimitByMethod(limitStore, clientKey, "api", limits.Reads, limits.Writes)
+	idempotent := middleware.Idempotency(db, idempotency.TTL, idempotency.MaxBodyBytes)
+	validate := middleware.ValidateRequests(openapi.MustNewValidator(docs.OpenAPI), false)
+
+	// The gRPC server resolves the tenant again from the forwarded headers
+	v1 := router.Group("/api/v1")
+	v1.Use(limitAPI, middleware.Tenant(db, tenantConfig), idempotent, validate)
+	{
+		forward := gin.WrapH(gateway)
+		for _, path := range []string{"/authors", "/books", "/books/:id/reviews"} {
+			v1.GET(path, forward)
+			v1.POST(path, forward)
+		}
+		for _, path := range []string{"/authors/:id", "/books/:id"} {
+			v1.GET(path, forward)
+			v1.PUT(path, forward)
+			v1.DELETE(path, forward)
+		}
+		v1.PUT("/reviews/:id", forward)
+		v1.DELETE("/reviews/:id", forward)
+	}
+	return router
+}
+
+// newHealthChecker checks that the database is reachable and migrated, and
+// that the cache store is reachable
+func newHealthChecker(db *gorm.DB) *health.Checker {
+	checker := health.NewChecker(2 * time.Second)
+	checker.Add("database", func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	})
+	checker.Add("migrations", func(ctx context.Context) error {
+		return models.CheckSchema(db.WithContext(ctx))
+	})
+	checker.Add("cache", cache.Ping)
+	return checker
+}
+
+// newRateLimitStore returns the store of the rate limit buckets, or nil when
+// rate limiting is off
+func newRateLimitStore(settings config.RateLimit) (ratelimit.Store, error) {
+	switch settings.Store {
+	case "memory":
+		return ratelimit.NewMemoryStore(), nil
+	case "redis":
+		options, err := redis.ParseURL(settings.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_REDIS_URL: %w", err)
+		}
+		return ratelimit.NewRedisStore(redis.NewClient(options), "ratelimit:"), nil
+	default:
+		return nil, nil
+	}
 }
 
-// getEnv gets value from environment or returns default value
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// newCacheStore returns the store of the cache of hot reads, or nil when
+// the cache is off
+func newCacheStore(settings config.Cache) (cache.Store, error) {
+	switch settings.Store {
+	case "memory":
+		return cache.NewMemoryStore(settings.Size)
+	case "redis":
+		options, err := redis.ParseURL(settings.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("CACHE_REDIS_URL: %w", err)
+		}
+		return cache.NewRedisStore(redis.NewClient(options), "cache:"), nil
+	default:
+		return nil, nil
+	}
+}
+
+// fatal logs an error that prevents the API from running and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// newCoverStore creates the storage backend for cover images selected by
+// COVER_STORAGE. Local covers are served by the API itself.
+func newCoverStore(router *gin.Engine, covers config.Covers, s3 config.S3) (storage.Store, error) {
+	switch covers.Storage {
+	case "local":
+		store, err := storage.NewLocalStore(covers.Dir, covers.BaseURL)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(store.BaseURL, "/") {
+			router.Static(store.BaseURL, covers.Dir)
+		}
+		return store, nil
+	case "s3":
+		return &storage.S3Store{
+			Endpoint:  s3.Endpoint,
+			Bucket:    s3.Bucket,
+			Region:    s3.Region,
+			AccessKey: s3.AccessKey,
+			SecretKey: s3.SecretKey,
+			PublicURL: s3.PublicURL,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown COVER_STORAGE %q", covers.Storage)
+	}
+}
+
+// publicIDCodec creates the public ID codec selected by PUBLIC_IDS. It
+// returns nil when IDs are exposed as numbers.
+func publicIDCodec(settings config.PublicIDs) (ids.Codec, error) {
+	switch settings.Mode {
+	case "":
+		return nil, nil
+	case "hashids":
+		return ids.NewHashids(settings.Salt, settings.MinLength)
+	default:
+		return nil, fmt.Errorf("unknown PUBLIC_IDS %q", settings.Mode)
+	}
+}
+
+// startGRPC serves the gRPC API on its own port and, when a gateway port is
+// set, the grpc-gateway JSON mapping of it on another, wrapped by wrap, with
+// the HTTP server settings of the REST API. The returned function stops
+// both, letting calls in flight finish until ctx is done.
+func startGRPC(db *gorm.DB, tenantConfig middleware.TenantConfig, settings config.GRPC, serverSettings config.Server,
+	wrap func(http.Handler) http.Handler) (func(ctx context.Context), error) {
+	port, gatewayPort := settings.Port, settings.GatewayPort
+	var gatewayServer *http.Server
+	if gatewayPort != 0 {
+		gateway, err := grpcapi.NewGateway(context.Background(), fmt.Sprintf("localhost:%d", port))
+		if err != nil {
+			return nil, err
+		}
+		gatewayServer = newServer(gatewayPort, wrap(gateway), serverSettings)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, err
+	}
+	server := grpcapi.NewServer(db, tenantConfig)
+	go func() {
+		slog.Info("gRPC server starting", "port", port)
+		if err := server.Serve(listener); err != nil {
+			fatal("gRPC server failed", err)
+		}
+	}()
+
+	if gatewayServer != nil {
+		go func() {
+			slog.Info("gRPC gateway starting", "port", gatewayPort)
+			if err := gatewayServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal("gRPC gateway failed", err)
+			}
+		}()
+	}
+
+	stop := func(ctx context.Context) {
+		if gatewayServer != nil {
+			gatewayServer.Shutdown(ctx)
+		}
+		stopped := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			server.Stop()
+		}
 	}
-	return value
+	return stop, nil
 }
 
 // Vanilla implementation
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"mentalartsapi/config"
+	"mentalartsapi/docs"
+	"mentalartsapi/middleware"
+	"mentalartsapi/models"
+	"mentalartsapi/openapi"
+	"mentalartsapi/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+var (
+	pathParam = regexp.MustCompile(`:(\w+)`)
+	// customMethod matches custom method paths like /books:bulkCreate,
+	// which share a /books:action route
+	customMethod = regexp.MustCompile(`(\w):\w+$`)
+)
+
+// TestOpenAPIRoutes fails when a route under /api/v1 is missing from the
+// spec, or the spec documents a route that is not registered
+func TestOpenAPIRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, middleware.TenantConfig{}, "", config.Idempotency{TTL: time.Hour}, nil, config.RateLimit{}, nil)
+
+	var routes []string
+	for _, route := range router.Routes() {
+		if strings.HasPrefix(route.Path, "/api/v1/") {
+			routes = append(routes, route.Method+" "+pathParam.ReplaceAllString(route.Path, "{$1}"))
+		}
+	}
+
+	doc, err := openapi.Generate(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var operations []string
+	for path, item := range doc.Paths {
+		for method := range *item {
+			route := customMethod.ReplaceAllString(path, "$1{action}")
+			operations = append(operations, strings.ToUpper(method)+" "+route)
+		}
+	}
+
+	sort.Strings(routes)
+	sort.Strings(operations)
+	for _, missing := range difference(routes, operations) {
+		t.Errorf("route %s is not in the OpenAPI spec, annotate its handler", missing)
+	}
+	for _, extra := range difference(operations, routes) {
+		t.Errorf("OpenAPI operation %s has no route", extra)
+	}
+}
+
+// TestOpenAPIUpToDate fails when the committed spec differs from the one
+// generated from the annotations
+func TestOpenAPIUpToDate(t *testing.T) {
+	doc, err := openapi.Generate(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := openapi.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, docs.OpenAPI) {
+		t.Error("docs/openapi.json is out of date, run go generate ./docs")
+	}
+}
+
+func TestServeOpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter(nil, middleware.TenantConfig{}, "", config.Idempotency{TTL: time.Hour}, nil, config.RateLimit{}, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: status %d", w.Code)
+	}
+	if !bytes.Equal(w.Body.Bytes(), docs.OpenAPI) {
+		t.Error("GET /openapi.json did not return the committed spec")
+	}
+}
+
+// TestGateway checks that gateway requests go through the middleware of
+// the REST API before they reach the gateway
+func TestGateway(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Tenant{}, &models.IdempotencyKey{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Tenant{Name: "Default", Slug: "default", Active: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	gateway := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id":"1"}`))
+	})
+	reads, _ := ratelimit.ParseLimit("2/1m")
+	writes, _ := ratelimit.ParseLimit("10/1m")
+	router := setupGateway(gateway, db, middleware.TenantConfig{DefaultTenant: "default"}, "",
+		config.Idempotency{TTL: time.Hour, MaxBodyBytes: 1024}, ratelimit.NewMemoryStore(), config.RateLimit{Reads: reads, Writes: writes}, nil)
+	send := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send(http.MethodPost, "/api/v1/books", `{"title": 5}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid body: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := send(http.MethodGet, "/api/v1/books", "", middleware.TenantHeader, "other"); w.Code != http.StatusForbidden {
+		t.Errorf("untrusted tenant header: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if calls != 0 {
+		t.Fatalf("gateway called %d times for rejected requests", calls)
+	}
+
+	for i := 0; i < 2; i++ {
+		send(http.MethodPost, "/api/v1/authors", `{"name": "Octavia E. Butler"}`, middleware.IdempotencyKeyHeader, "a")
+	}
+	if calls != 1 {
+		t.Errorf("gateway called %d times for a retried Idempotency-Key, want 1", calls)
+	}
+
+	// The rejected GET above took a read token
+	if w := send(http.MethodGet, "/api/v1/authors/1", ""); w.Code != http.StatusOK {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := send(http.MethodGet, "/api/v1/books/1/reviews", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+// difference returns the elements of a that are not in b
+func difference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, s := range b {
+		in[s] = true
+	}
+	var diff []string
+	for _, s := range a {
+		if !in[s] {
+			diff = append(diff, s)
+		}
+	}
+	return diff
+}
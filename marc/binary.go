@@ -0,0 +1,212 @@
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ISO 2709 delimiters
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+)
+
+const leaderLength = 24
+
+// Limits of the 4 and 5 digit lengths and positions of ISO 2709
+const (
+	// MaxFieldLength is the longest field value, leaving room for its
+	// terminator
+	MaxFieldLength  = 9998
+	maxRecordLength = 99999
+)
+
+var (
+	ErrInvalidRecord = errors.New("invalid MARC21 record")
+	// ErrRecordTooLong is returned for records that don't fit the lengths of
+	// ISO 2709
+	ErrRecordTooLong = errors.New("MARC21 record too long")
+)
+
+// Reader reads MARC21 records in ISO 2709 transmission format
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF when there are none left
+func (r *Reader) Read() (Record, error) {
+	// Skip whitespace some tools put between records
+	for {
+		b, err := r.r.Peek(1)
+		if err != nil {
+			return Record{}, err
+		}
+		if b[0] != '\n' && b[0] != '\r' && b[0] != ' ' {
+			break
+		}
+		r.r.ReadByte()
+	}
+
+	prefix, err := r.r.Peek(5)
+	if err != nil {
+		return Record{}, fmt.Errorf("%w: truncated leader", ErrInvalidRecord)
+	}
+	length, ok := parseDigits(prefix)
+	if !ok || length < leaderLength+1 {
+		// Discard the rest of the broken record so that reading can resume
+		r.r.ReadBytes(recordTerminator)
+		return Record{}, fmt.Errorf("%w: bad record length %q", ErrInvalidRecord, prefix)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		return Record{}, fmt.Errorf("%w: truncated record", ErrInvalidRecord)
+	}
+	return Unmarshal(data)
+}
+
+// Unmarshal decodes a single ISO 2709 record
+func Unmarshal(data []byte) (Record, error) {
+	if len(data) < leaderLength+1 || data[len(data)-1] != recordTerminator {
+		return Record{}, fmt.Errorf("%w: missing record terminator", ErrInvalidRecord)
+	}
+
+	record := Record{Leader: string(data[:leaderLength])}
+	base, ok := parseDigits(data[12:17])
+	if !ok || base <= leaderLength || base > len(data) {
+		return Record{}, fmt.Errorf("%w: bad base address", ErrInvalidRecord)
+	}
+
+	directory := data[leaderLength : base-1]
+	if len(directory)%12 != 0 {
+		return Record{}, fmt.Errorf("%w: bad directory", ErrInvalidRecord)
+	}
+
+	for i := 0; i < len(directory); i += 12 {
+		entry := directory[i : i+12]
+		tag := string(entry[:3])
+		length, ok1 := parseDigits(entry[3:7])
+		start, ok2 := parseDigits(entry[7:12])
+		// Fields end before the record terminator
+		if !ok1 || !ok2 || length < 1 || start < 0 || base+start+length > len(data)-1 {
+			return Record{}, fmt.Errorf("%w: bad directory entry for %s", ErrInvalidRecord, tag)
+		}
+
+		// Drop the field terminator
+		field := data[base+start : base+start+length-1]
+		if isControlTag(tag) {
+			record.ControlFields = append(record.ControlFields, ControlField{Tag: tag, Value: string(field)})
+			continue
+		}
+
+		if len(field) < 2 {
+			return Record{}, fmt.Errorf("%w: data field %s has no indicators", ErrInvalidRecord, tag)
+		}
+		dataField := DataField{Tag: tag, Ind1: string(field[0]), Ind2: string(field[1])}
+		for _, chunk := range bytes.Split(field[2:], []byte{subfieldDelimiter}) {
+			if len(chunk) == 0 {
+				continue
+			}
+			dataField.Subfields = append(dataField.Subfields, Subfield{Code: string(chunk[0]), Value: string(chunk[1:])})
+		}
+		record.DataFields = append(record.DataFields, dataField)
+	}
+
+	return record, nil
+}
+
+// Marshal encodes a record in ISO 2709 transmission format, computing the
+// record length, base address and directory
+func Marshal(record Record) ([]byte, error) {
+	var directory, fields bytes.Buffer
+
+	addField := func(tag string, value []byte) error {
+		if len(tag) != 3 {
+			return fmt.Errorf("%w: bad tag %q", ErrInvalidRecord, tag)
+		}
+		if len(value) > MaxFieldLength {
+			return fmt.Errorf("%w: field %s is longer than %d bytes", ErrRecordTooLong, tag, MaxFieldLength)
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", tag, len(value)+1, fields.Len())
+		fields.Write(value)
+		fields.WriteByte(fieldTerminator)
+		return nil
+	}
+
+	for _, field := range record.ControlFields {
+		if err := addField(field.Tag, []byte(field.Value)); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range record.DataFields {
+		var value bytes.Buffer
+		value.WriteString(indicator(field.Ind1))
+		value.WriteString(indicator(field.Ind2))
+		for _, subfield := range field.Subfields {
+			value.WriteByte(subfieldDelimiter)
+			value.WriteString(subfield.Code)
+			value.WriteString(subfield.Value)
+		}
+		if err := addField(field.Tag, value.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	directory.WriteByte(fieldTerminator)
+
+	base := leaderLength + directory.Len()
+	length := base + fields.Len() + 1
+	if length > maxRecordLength {
+		return nil, fmt.Errorf("%w: record is longer than %d bytes", ErrRecordTooLong, maxRecordLength)
+	}
+
+	leader := []byte(record.Leader)
+	if len(leader) != leaderLength {
+		leader = []byte(DefaultLeader)
+	}
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+
+	out := make([]byte, 0, length)
+	out = append(out, leader...)
+	out = append(out, directory.Bytes()...)
+	out = append(out, fields.Bytes()...)
+	out = append(out, recordTerminator)
+	return out, nil
+}
+
+// parseDigits parses a number of ISO 2709, which is only ever ASCII digits,
+// without the signs and spaces strconv accepts
+func parseDigits(b []byte) (int, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+// isControlTag reports whether tag is a control field (001-009), which has
+// no indicators or subfields
+func isControlTag(tag string) bool {
+	return len(tag) == 3 && tag[0] == '0' && tag[1] == '0'
+}
+
+func indicator(value string) string {
+	if len(value) != 1 {
+		return " "
+	}
+	return value
+}
@@ -0,0 +1,193 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mentalartsapi/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func sampleRecord() Record {
+	return Record{
+		Leader:        DefaultLeader,
+		ControlFields: []ControlField{{Tag: "001", Value: "42"}},
+		DataFields: []DataField{
+			dataField("020", " ", " ", Subfield{Code: "a", Value: "9780441478125"}),
+			dataField("245", "1", "0", Subfield{Code: "a", Value: "The left hand of darkness"}),
+		},
+	}
+}
+
+// setDirectoryEntry overwrites the length and start of the first directory
+// entry of a record
+func setDirectoryEntry(data []byte, length, start string) []byte {
+	data = bytes.Clone(data)
+	copy(data[leaderLength+3:leaderLength+7], length)
+	copy(data[leaderLength+7:leaderLength+12], start)
+	return data
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	valid, err := Marshal(sampleRecord())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "no record terminator", data: valid[:len(valid)-1]},
+		{name: "signed start", data: setDirectoryEntry(valid, "0003", "-9958")},
+		{name: "signed length", data: setDirectoryEntry(valid, "-003", "00000")},
+		{name: "plus sign", data: setDirectoryEntry(valid, "0003", "+0000")},
+		{name: "spaces", data: setDirectoryEntry(valid, "0003", " 0000")},
+		{name: "zero length", data: setDirectoryEntry(valid, "0000", "00000")},
+		{name: "start past the data", data: setDirectoryEntry(valid, "0003", "99990")},
+		{name: "field over the record terminator", data: setDirectoryEntry(valid, "0003", "00049")},
+		{name: "signed base address", data: append(append(bytes.Clone(valid[:12]), "-0061"...), valid[17:]...)},
+		{name: "base address past the data", data: append(append(bytes.Clone(valid[:12]), "99999"...), valid[17:]...)},
+		{name: "directory not in entries", data: append(append(bytes.Clone(valid[:12]), "00060"...), valid[17:]...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Unmarshal(tt.data); !errors.Is(err, ErrInvalidRecord) {
+				t.Errorf("err = %v, want %v", err, ErrInvalidRecord)
+			}
+		})
+	}
+}
+
+func TestReaderBadLength(t *testing.T) {
+	valid, err := Marshal(sampleRecord())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := append([]byte("+0100"), valid[5:]...)
+
+	reader := NewReader(bytes.NewReader(append(signed, valid...)))
+	if _, err := reader.Read(); !errors.Is(err, ErrInvalidRecord) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidRecord)
+	}
+	// Reading resumes with the next record
+	if _, err := reader.Read(); err != nil {
+		t.Fatalf("record after a broken one: %v", err)
+	}
+	if _, err := reader.Read(); err != io.EOF {
+		t.Fatalf("err = %v, want EOF", err)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	longest := strings.Repeat("x", MaxFieldLength-4)
+	record := sampleRecord()
+	record.DataFields = append(record.DataFields, dataField("520", " ", " ", Subfield{Code: "a", Value: longest}))
+
+	data, err := Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.ControlFields, record.ControlFields) || !reflect.DeepEqual(got.DataFields, record.DataFields) {
+		t.Errorf("round trip = %+v, want %+v", got, record)
+	}
+}
+
+func TestMarshalTooLong(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []DataField
+	}{
+		{
+			name:   "field",
+			fields: []DataField{dataField("520", " ", " ", Subfield{Code: "a", Value: strings.Repeat("x", MaxFieldLength-3)})},
+		},
+		{
+			name: "record",
+			fields: func() []DataField {
+				var fields []DataField
+				for i := 0; i < 12; i++ {
+					fields = append(fields, dataField("520", " ", " ", Subfield{Code: "a", Value: strings.Repeat("x", 9000)}))
+				}
+				return fields
+			}(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := sampleRecord()
+			record.DataFields = append(record.DataFields, tt.fields...)
+			if _, err := Marshal(record); !errors.Is(err, ErrRecordTooLong) {
+				t.Errorf("err = %v, want %v", err, ErrRecordTooLong)
+			}
+		})
+	}
+}
+
+// TestBookLongDescription round trips a book whose description doesn't fit
+// in one field
+func TestBookLongDescription(t *testing.T) {
+	word := strings.Repeat("ü", 10) // 20 bytes
+	words := make([]string, 1200)
+	for i := range words {
+		words[i] = word
+	}
+	book := models.Book{Title: "Long", Description: strings.Join(words, " ")}
+	// A word longer than a field is split between runes
+	unbroken := models.Book{Title: "Unbroken", Description: strings.Repeat("ü", 6000)}
+
+	for _, book := range []models.Book{book, unbroken} {
+		t.Run(book.Title, func(t *testing.T) {
+			data, err := Marshal(FromBook(book))
+			if err != nil {
+				t.Fatal(err)
+			}
+			record, err := Unmarshal(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(record.Subfields("520", "a")); n < 2 {
+				t.Fatalf("description in %d fields, want it split", n)
+			}
+			got, err := ToBook(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := book.Description
+			if book.Title == "Unbroken" {
+				want = strings.Join(splitWords(book.Description, MaxFieldLength-4), " ")
+			}
+			if got.Description != want {
+				t.Errorf("description of %d bytes came back as %d bytes", len(want), len(got.Description))
+			}
+		})
+	}
+}
+
+func FuzzUnmarshal(f *testing.F) {
+	valid, err := Marshal(sampleRecord())
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(valid)
+	f.Add(setDirectoryEntry(valid, "0003", "-9958"))
+	f.Add([]byte("00026nam a2200025 i 4500\x1e\x1d"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		record, err := Unmarshal(data)
+		if err != nil {
+			return
+		}
+		// Whatever decodes encodes again
+		if _, err := Marshal(record); err != nil && !errors.Is(err, ErrInvalidRecord) && !errors.Is(err, ErrRecordTooLong) {
+			t.Errorf("Marshal of a decoded record: %v", err)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package marc
+
+import (
+	"errors"
+	"fmt"
+	"mentalartsapi/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	yearPattern  = regexp.MustCompile(`\d{4}`)
+	isbnPattern  = regexp.MustCompile(`^[0-9Xx-]+`)
+	pagesPattern = regexp.MustCompile(`(\d+)\s*p`)
+)
+
+// ToBook maps a MARC21 bibliographic record onto a book and its author:
+// title from 245, ISBN from 020, author from 100 and publication year from
+// 264, falling back to 260
+func ToBook(record Record) (models.Book, error) {
+	var book models.Book
+
+	book.Title = trimISBD(record.Subfield("245", "a"))
+	if subtitle := trimISBD(record.Subfield("245", "b")); subtitle != "" {
+		book.Title += ": " + subtitle
+	}
+	if book.Title == "" {
+		return book, errors.New("record has no title (245 $a)")
+	}
+
+	// 020 $a often carries a qualifier such as "9780441478125 (pbk.)"
+	book.ISBN = strings.ReplaceAll(isbnPattern.FindString(record.Subfield("020", "a")), "-", "")
+	book.Author.Name = trimISBD(record.Subfield("100", "a"))
+
+	publication := record.Subfield("264", "c")
+	publisher := record.Subfield("264", "b")
+	if publication == "" {
+		publication = record.Subfield("260", "c")
+		publisher = record.Subfield("260", "b")
+	}
+	if year := yearPattern.FindString(publication); year != "" {
+		book.PublicationYear, _ = strconv.Atoi(year)
+	}
+	if publisher = trimISBD(publisher); publisher != "" {
+		book.Publisher = &models.Publisher{Name: publisher}
+	}
+
+	if match := pagesPattern.FindStringSubmatch(record.Subfield("300", "a")); match != nil {
+		book.PageCount, _ = strconv.Atoi(match[1])
+	}
+	// Long summaries are split over several 520 fields
+	book.Description = strings.Join(record.Subfields("520", "a"), " ")
+	book.Language = record.Subfield("546", "a")
+
+	return book, nil
+}
+
+// trimISBD strips the trailing ISBD punctuation cataloguers put before the
+// next subfield, e.g. "Le Guin, Ursula K.," or "The left hand of darkness /"
+func trimISBD(value string) string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimRight(value, " /:;,=")
+	return strings.TrimSpace(value)
+}
+
+// FromBook serialises a book, and its author if loaded, as a MARC21
+// bibliographic record
+func FromBook(book models.Book) Record {
+	record := Record{Leader: DefaultLeader}
+	if book.ID != 0 {
+		record.ControlFields = append(record.ControlFields, ControlField{Tag: "001", Value: book.ID.String()})
+	}
+
+	if book.ISBN != "" {
+		record.DataFields = append(record.DataFields, dataField("020", " ", " ", Subfield{Code: "a", Value: book.ISBN}))
+	}
+	if book.Author.Name != "" {
+		record.DataFields = append(record.DataFields, dataField("100", "1", " ", Subfield{Code: "a", Value: book.Author.Name}))
+	}
+	record.DataFields = append(record.DataFields, dataField("245", "1", "0", Subfield{Code: "a", Value: book.Title}))
+	if book.EditionNumber > 0 {
+		record.DataFields = append(record.DataFields, dataField("250", " ", " ", Subfield{Code: "a", Value: editionStatement(book.EditionNumber)}))
+	}
+	if book.PublicationYear != 0 {
+		subfields := []Subfield{}
+		if book.Publisher != nil && book.Publisher.Name != "" {
+			subfields = append(subfields, Subfield{Code: "b", Value: book.Publisher.Name})
+		}
+		subfields = append(subfields, Subfield{Code: "c", Value: strconv.Itoa(book.PublicationYear)})
+		record.DataFields = append(record.DataFields, dataField("264", " ", "1", subfields...))
+	}
+	if book.PageCount > 0 {
+		record.DataFields = append(record.DataFields, dataField("300", " ", " ", Subfield{Code: "a", Value: fmt.Sprintf("%d pages", book.PageCount)}))
+	}
+	// Fields can't be longer than MaxFieldLength, so long descriptions are
+	// split over repeated 520 fields. Four bytes of it are taken up by the
+	// indicators and the subfield code.
+	for _, summary := range splitWords(book.Description, MaxFieldLength-4) {
+		record.DataFields = append(record.DataFields, dataField("520", " ", " ", Subfield{Code: "a", Value: summary}))
+	}
+	if book.Language != "" {
+		record.DataFields = append(record.DataFields, dataField("546", " ", " ", Subfield{Code: "a", Value: book.Language}))
+	}
+
+	return record
+}
+
+// splitWords splits s into parts of at most max bytes, between words where
+// it can and otherwise between runes. The spaces split at are dropped.
+func splitWords(s string, max int) []string {
+	var parts []string
+	for s = strings.TrimSpace(s); len(s) > max; {
+		cut := strings.LastIndex(s[:max+1], " ")
+		if cut <= 0 {
+			cut = max
+			for !utf8.RuneStart(s[cut]) {
+				cut--
+			}
+		}
+		parts = append(parts, strings.TrimSpace(s[:cut]))
+		s = strings.TrimSpace(s[cut:])
+	}
+	if s != "" {
+		parts = append(parts, s)
+	}
+	return parts
+}
+
+func editionStatement(number int) string {
+	suffix := "th"
+	if number%100 < 11 || number%100 > 13 {
+		switch number % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return fmt.Sprintf("%d%s ed.", number, suffix)
+}
@@ -0,0 +1,48 @@
+package marc
+
+import (
+	"encoding/xml"
+	"mentalartsapi/models"
+	"strconv"
+)
+
+// DublinCore is an OAI-PMH simple Dublin Core (oai_dc) record
+type DublinCore struct {
+	XMLName     xml.Name `xml:"oai_dc:dc"`
+	OAIDC       string   `xml:"xmlns:oai_dc,attr"`
+	DC          string   `xml:"xmlns:dc,attr"`
+	Title       string   `xml:"dc:title"`
+	Creator     string   `xml:"dc:creator,omitempty"`
+	Publisher   string   `xml:"dc:publisher,omitempty"`
+	Date        string   `xml:"dc:date,omitempty"`
+	Description string   `xml:"dc:description,omitempty"`
+	Language    string   `xml:"dc:language,omitempty"`
+	Format      string   `xml:"dc:format,omitempty"`
+	Type        string   `xml:"dc:type"`
+	Identifier  []string `xml:"dc:identifier"`
+}
+
+// DublinCoreFromBook describes a book, and its author and publisher if
+// loaded, in simple Dublin Core
+func DublinCoreFromBook(book models.Book) DublinCore {
+	dc := DublinCore{
+		OAIDC:       "http://www.openarchives.org/OAI/2.0/oai_dc/",
+		DC:          "http://purl.org/dc/elements/1.1/",
+		Title:       book.Title,
+		Creator:     book.Author.Name,
+		Description: book.Description,
+		Language:    book.Language,
+		Format:      book.Format,
+		Type:        "Text",
+	}
+	if book.PublicationYear != 0 {
+		dc.Date = strconv.Itoa(book.PublicationYear)
+	}
+	if book.Publisher != nil {
+		dc.Publisher = book.Publisher.Name
+	}
+	if book.ISBN != "" {
+		dc.Identifier = append(dc.Identifier, "urn:isbn:"+book.ISBN)
+	}
+	return dc
+}
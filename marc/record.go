@@ -0,0 +1,85 @@
+package marc
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Namespace of MARCXML documents
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+// DefaultLeader describes a new, monographic language material record
+// encoded in Unicode
+const DefaultLeader = "00000nam a2200000 i 4500"
+
+// Record is a MARC21 bibliographic record
+type Record struct {
+	XMLName       xml.Name       `xml:"record"`
+	Leader        string         `xml:"leader"`
+	ControlFields []ControlField `xml:"controlfield"`
+	DataFields    []DataField    `xml:"datafield"`
+}
+
+type ControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type DataField struct {
+	Tag       string     `xml:"tag,attr"`
+	Ind1      string     `xml:"ind1,attr"`
+	Ind2      string     `xml:"ind2,attr"`
+	Subfields []Subfield `xml:"subfield"`
+}
+
+type Subfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Control returns the value of the first control field with the given tag
+func (r Record) Control(tag string) string {
+	for _, field := range r.ControlFields {
+		if field.Tag == tag {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Subfield returns the first value of a subfield of the first data field
+// with the given tag
+func (r Record) Subfield(tag, code string) string {
+	for _, field := range r.DataFields {
+		if field.Tag != tag {
+			continue
+		}
+		for _, subfield := range field.Subfields {
+			if subfield.Code == code {
+				return strings.TrimSpace(subfield.Value)
+			}
+		}
+	}
+	return ""
+}
+
+// Subfields returns the values of a subfield of every data field with the
+// given tag, for repeatable fields
+func (r Record) Subfields(tag, code string) []string {
+	var values []string
+	for _, field := range r.DataFields {
+		if field.Tag != tag {
+			continue
+		}
+		for _, subfield := range field.Subfields {
+			if subfield.Code == code {
+				values = append(values, strings.TrimSpace(subfield.Value))
+			}
+		}
+	}
+	return values
+}
+
+func dataField(tag, ind1, ind2 string, subfields ...Subfield) DataField {
+	return DataField{Tag: tag, Ind1: ind1, Ind2: ind2, Subfields: subfields}
+}
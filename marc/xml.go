@@ -0,0 +1,77 @@
+package marc
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// XMLWriter streams records as a MARCXML collection
+type XMLWriter struct {
+	w       io.Writer
+	encoder *xml.Encoder
+	started bool
+}
+
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	return &XMLWriter{w: w, encoder: xml.NewEncoder(w)}
+}
+
+func (x *XMLWriter) start() error {
+	if x.started {
+		return nil
+	}
+	x.started = true
+	_, err := io.WriteString(x.w, xml.Header+`<collection xmlns="`+Namespace+`">`+"\n")
+	return err
+}
+
+// Write appends a record to the collection
+func (x *XMLWriter) Write(record Record) error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	if err := x.encoder.Encode(record); err != nil {
+		return err
+	}
+	_, err := io.WriteString(x.w, "\n")
+	return err
+}
+
+// Close ends the collection. It does not close the underlying writer.
+func (x *XMLWriter) Close() error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(x.w, "</collection>\n")
+	return err
+}
+
+// XMLReader reads records from a MARCXML document, which may be a
+// collection or a single record, with or without a namespace prefix
+type XMLReader struct {
+	decoder *xml.Decoder
+}
+
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{decoder: xml.NewDecoder(r)}
+}
+
+// Read returns the next record, or io.EOF when there are none left
+func (x *XMLReader) Read() (Record, error) {
+	for {
+		token, err := x.decoder.Token()
+		if err != nil {
+			return Record{}, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var record Record
+		if err := x.decoder.DecodeElement(&record, &start); err != nil {
+			return Record{}, err
+		}
+		return record, nil
+	}
+}
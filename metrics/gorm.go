@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// startKey is the statement setting holding the time a query started
+const startKey = "metrics:start"
+
+var dbDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Time to run database queries by operation and table.",
+	Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+}, []string{"operation", "table"})
+
+// GORMPlugin times every GORM statement
+type GORMPlugin struct{}
+
+// Name implements gorm.Plugin
+func (GORMPlugin) Name() string {
+	return "metrics"
+}
+
+// Initialize implements gorm.Plugin
+func (GORMPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("metrics:before_create", startTimer); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("metrics:after_create", observe("create")); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("metrics:before_query", startTimer); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("gorm:query").Register("metrics:after_query", observe("query")); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("metrics:before_update", startTimer); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("metrics:after_update", observe("update")); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("metrics:before_delete", startTimer); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("metrics:after_delete", observe("delete")); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("metrics:before_row", startTimer); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:row").Register("metrics:after_row", observe("row")); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("metrics:before_raw", startTimer); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("metrics:after_raw", observe("raw"))
+}
+
+func startTimer(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func observe(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		start, ok := value.(time.Time)
+		if !ok {
+			return
+		}
+		dbDuration.WithLabelValues(operation, db.Statement.Table).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,97 @@
+// Package metrics collects the Prometheus metrics of the API: HTTP requests,
+// database queries and connections, and domain events.
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds every metric of the API, along with the Go runtime and
+// process metrics
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Domain events
+var (
+	AuthorsCreated = factory.NewCounter(prometheus.CounterOpts{
+		Name: "library_authors_created_total",
+		Help: "Authors created.",
+	})
+	BooksCreated = factory.NewCounter(prometheus.CounterOpts{
+		Name: "library_books_created_total",
+		Help: "Books created.",
+	})
+	ReviewsPosted = factory.NewCounter(prometheus.CounterOpts{
+		Name: "library_reviews_posted_total",
+		Help: "Reviews posted.",
+	})
+)
+
+// Add adds n to a domain counter. Within Defer it is added when the
+// transaction commits, so that rolled back writes aren't counted.
+func Add(ctx context.Context, counter prometheus.Counter, n float64) {
+	if d, ok := ctx.Value(deferredKey{}).(*deferred); ok {
+		d.mu.Lock()
+		d.adds = append(d.adds, deferredAdd{counter: counter, n: n})
+		d.mu.Unlock()
+		return
+	}
+	counter.Add(n)
+}
+
+// Defer holds back the counts added with the returned context, for writes
+// in a transaction. Call commit once the transaction has committed; counts
+// of a transaction that rolled back are dropped with the context.
+func Defer(ctx context.Context) (context.Context, func()) {
+	d := &deferred{}
+	commit := func() {
+		d.mu.Lock()
+		adds := d.adds
+		d.adds = nil
+		d.mu.Unlock()
+		for _, add := range adds {
+			add.counter.Add(add.n)
+		}
+	}
+	return context.WithValue(ctx, deferredKey{}, d), commit
+}
+
+type deferredKey struct{}
+
+// deferred collects the counts held back by Defer
+type deferred struct {
+	mu   sync.Mutex
+	adds []deferredAdd
+}
+
+type deferredAdd struct {
+	counter prometheus.Counter
+	n       float64
+}
+
+// RegisterDB exports the connection pool stats of db, e.g.
+// go_sql_open_connections and go_sql_wait_duration_seconds_total
+func RegisterDB(db *sql.DB, name string) error {
+	return Registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
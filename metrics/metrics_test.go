@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDefer(t *testing.T) {
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total"})
+
+	Add(context.Background(), counter, 1)
+	if got := testutil.ToFloat64(counter); got != 1 {
+		t.Fatalf("counter = %v, want 1", got)
+	}
+
+	ctx, commit := Defer(context.Background())
+	Add(ctx, counter, 2)
+	Add(ctx, counter, 3)
+	if got := testutil.ToFloat64(counter); got != 1 {
+		t.Fatalf("counter before commit = %v, want 1", got)
+	}
+	commit()
+	if got := testutil.ToFloat64(counter); got != 6 {
+		t.Fatalf("counter after commit = %v, want 6", got)
+	}
+	commit()
+	if got := testutil.ToFloat64(counter); got != 6 {
+		t.Fatalf("counter after a second commit = %v, want 6", got)
+	}
+
+	// Counts of a transaction that rolls back are never committed
+	ctx, _ = Defer(context.Background())
+	Add(ctx, counter, 10)
+	if got := testutil.ToFloat64(counter); got != 6 {
+		t.Errorf("counter after rollback = %v, want 6", got)
+	}
+}
@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mentalartsapi/dto"
+	"mentalartsapi/models"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// idempotencyKeyInProgress is the status of a key until its response
+	// is stored
+	idempotencyKeyInProgress = 0
+)
+
+var (
+	errIdempotencyKeyReused     = errors.New("Idempotency-Key was already used for a different request")
+	errIdempotencyKeyInProgress = errors.New("a request with this Idempotency-Key is still in progress")
+)
+
+// Idempotency makes POST requests sent with an Idempotency-Key header safe
+// to retry. The first request with a key runs as usual and its response is
+// stored for ttl; retries with the same key get that response again, marked
+// with the Idempotent-Replayed header, instead of running the handler.
+//
+// Keys are scoped to the tenant, so the middleware must run after Tenant.
+// A key sent with a different method, path or body gets 422, and a retry
+// while the first request is still running gets 409. Server errors are not
+// stored, so that the request can be retried. Their bodies are read into
+// memory to fingerprint them, so those over maxBodyBytes get 413.
+func Idempotency(db *gorm.DB, ttl time.Duration, maxBodyBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if c.Request.Method != http.MethodPost || key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abortWithError(c, http.StatusBadRequest, dto.ErrorResponse{Error: "Idempotency-Key must be at most 255 characters"})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBodyBytes))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				abortWithError(c, http.StatusRequestEntityTooLarge, dto.ErrorResponse{
+					Error: fmt.Sprintf("requests with an Idempotency-Key must be at most %d bytes", maxBodyBytes),
+				})
+				return
+			}
+			abortWithError(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		tx := db.WithContext(c.Request.Context())
+		record, claimed, err := claimIdempotencyKey(tx, key, fingerprint(c.Request, body), ttl)
+		switch {
+		case errors.Is(err, errIdempotencyKeyReused):
+			abortWithError(c, http.StatusUnprocessableEntity, dto.ErrorResponse{Error: err.Error()})
+			return
+		case errors.Is(err, errIdempotencyKeyInProgress):
+			abortWithError(c, http.StatusConflict, dto.ErrorResponse{Error: err.Error()})
+			return
+		case err != nil:
+			abortWithError(c, http.StatusInternalServerError, dto.ErrorResponse{Error: err.Error()})
+			return
+		case !claimed:
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(record.Status, record.ContentType, record.Body)
+			c.Abort()
+			return
+		}
+
+		// The response is stored, or the key released, even when the client
+		// is gone, as its retries would otherwise get 409 until the key
+		// expires
+		bookkeeping := db.WithContext(context.WithoutCancel(c.Request.Context()))
+
+		// Release the key if the handler fails or panics, so that the
+		// request can be retried
+		stored := false
+		defer func() {
+			if !stored {
+				if err := bookkeeping.Delete(record).Error; err != nil {
+					slog.ErrorContext(c.Request.Context(), "Could not release Idempotency-Key", "key", key, "error", err)
+				}
+			}
+		}()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.Status() >= http.StatusInternalServerError {
+			return
+		}
+		err = bookkeeping.Model(record).Updates(map[string]interface{}{
+			"status":       writer.Status(),
+			"content_type": writer.Header().Get("Content-Type"),
+			"body":         writer.body.Bytes(),
+		}).Error
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Could not store the response for Idempotency-Key", "key", key, "error", err)
+			return
+		}
+		stored = true
+	}
+}
+
+// claimIdempotencyKey records key as in progress for a new request. If the
+// key is already recorded for the same request, it returns the record
+// instead and claimed is false.
+func claimIdempotencyKey(tx *gorm.DB, key, fingerprint string, ttl time.Duration) (*models.IdempotencyKey, bool, error) {
+	now := time.Now()
+	// Expired keys may be reused, and are cleaned up here
+	if err := tx.Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return nil, false, err
+	}
+
+	record := &models.IdempotencyKey{
+		Key:         key,
+		Fingerprint: fingerprint,
+		Status:      idempotencyKeyInProgress,
+		ExpiresAt:   now.Add(ttl),
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return record, true, nil
+	}
+
+	existing := &models.IdempotencyKey{}
+	if err := tx.Where("key = ?", key).First(existing).Error; err != nil {
+		return nil, false, err
+	}
+	switch {
+	case existing.Fingerprint != fingerprint:
+		return nil, false, errIdempotencyKeyReused
+	case existing.Status == idempotencyKeyInProgress:
+		return nil, false, errIdempotencyKeyInProgress
+	}
+	return existing, false, nil
+}
+
+// fingerprint identifies a request by its method, URL and body
+func fingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	io.WriteString(hash, r.Method+" "+r.URL.RequestURI()+"\n")
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response body as it is written
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"context"
+	"mentalartsapi/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func idempotencyDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.IdempotencyKey{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func postIdempotent(router http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyBodyLimit(t *testing.T) {
+	db := idempotencyDB(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	calls := 0
+	router.POST("/", Idempotency(db, time.Hour, 16), func(c *gin.Context) {
+		calls++
+		c.String(http.StatusCreated, "created")
+	})
+	post := func(key, body string) *httptest.ResponseRecorder {
+		return postIdempotent(router, key, body)
+	}
+
+	if w := post("a", strings.Repeat("x", 16)); w.Code != http.StatusCreated {
+		t.Fatalf("status at the limit = %d, want %d", w.Code, http.StatusCreated)
+	}
+	if w := post("a", strings.Repeat("x", 16)); w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Fatalf("retry not replayed: %d %s", w.Code, w.Body)
+	}
+	if w := post("b", strings.Repeat("x", 17)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status over the limit = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyKeyReused(t *testing.T) {
+	db := idempotencyDB(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/", Idempotency(db, time.Hour, 1024), func(c *gin.Context) {
+		c.String(http.StatusCreated, "created")
+	})
+
+	if w := postIdempotent(router, "a", `{"title":"Kindred"}`); w.Code != http.StatusCreated {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if w := postIdempotent(router, "a", `{"title":"Dawn"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status of a different body = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	db := idempotencyDB(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	started, finish := make(chan struct{}), make(chan struct{})
+	router.POST("/", Idempotency(db, time.Hour, 1024), func(c *gin.Context) {
+		close(started)
+		<-finish
+		c.String(http.StatusCreated, "created")
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postIdempotent(router, "a", "body") }()
+	<-started
+	if w := postIdempotent(router, "a", "body"); w.Code != http.StatusConflict {
+		t.Errorf("status while in progress = %d, want %d", w.Code, http.StatusConflict)
+	}
+	close(finish)
+	if w := <-done; w.Code != http.StatusCreated {
+		t.Fatalf("status of the first request = %d", w.Code)
+	}
+	if w := postIdempotent(router, "a", "body"); w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("retry after the first request = %d, replayed %q", w.Code, w.Header().Get(IdempotentReplayedHeader))
+	}
+}
+
+// TestIdempotencyReleased lets requests that failed be retried
+func TestIdempotencyReleased(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+	}{
+		{name: "server error", handler: func(c *gin.Context) { c.String(http.StatusServiceUnavailable, "down") }},
+		{name: "panic", handler: func(c *gin.Context) { panic("boom") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := idempotencyDB(t)
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			router.Use(gin.CustomRecovery(func(c *gin.Context, _ any) { c.AbortWithStatus(http.StatusInternalServerError) }))
+			failing := true
+			router.POST("/", Idempotency(db, time.Hour, 1024), func(c *gin.Context) {
+				if failing {
+					tt.handler(c)
+					return
+				}
+				c.String(http.StatusCreated, "created")
+			})
+
+			if w := postIdempotent(router, "a", "body"); w.Code < http.StatusInternalServerError {
+				t.Fatalf("status = %d, want a server error", w.Code)
+			}
+			failing = false
+			if w := postIdempotent(router, "a", "body"); w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "" {
+				t.Errorf("retry = %d, replayed %q, want it run again", w.Code, w.Header().Get(IdempotentReplayedHeader))
+			}
+		})
+	}
+}
+
+// TestIdempotencyClientGone stores the response of a request whose client
+// disconnected, so that its retry is replayed rather than refused
+func TestIdempotencyClientGone(t *testing.T) {
+	db := idempotencyDB(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	router.POST("/", Idempotency(db, time.Hour, 1024), func(c *gin.Context) {
+		cancel()
+		c.String(http.StatusCreated, "created")
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("body")).WithContext(ctx)
+	req.Header.Set(IdempotencyKeyHeader, "a")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	w := postIdempotent(router, "a", "body")
+	if w.Code != http.StatusCreated || w.Header().Get(IdempotentReplayedHeader) != "true" {
+		t.Errorf("retry = %d %s, want the stored response replayed", w.Code, w.Body)
+	}
+}
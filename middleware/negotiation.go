@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"mentalartsapi/content"
+	"mentalartsapi/dto"
+	"mentalartsapi/logging"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Negotiate picks the response format (JSON, XML, YAML or MessagePack) from
+// the Accept header and answers 406 when the client accepts none of them,
+// before the handler has done any work
+func Negotiate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !content.Negotiate(c) {
+			c.AbortWithStatusJSON(http.StatusNotAcceptable, dto.ErrorResponse{
+				Error:     "none of the accepted media types can be produced, supported types are " + strings.Join(content.MediaTypes, ", "),
+				RequestID: logging.RequestID(c.Request.Context()),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// abortWithError stops the request with an error in the negotiated format
+func abortWithError(c *gin.Context, status int, response dto.ErrorResponse) {
+	content.Render(c, status, response)
+	c.Abort()
+}
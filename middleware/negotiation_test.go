@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"mentalartsapi/dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handled := false
+	router := gin.New()
+	router.GET("/", Negotiate(), func(c *gin.Context) {
+		handled = true
+		abortWithError(c, http.StatusNotFound, dto.ErrorResponse{Error: "book not found"})
+	})
+
+	tests := []struct {
+		accept      string
+		wantStatus  int
+		wantType    string
+		wantHandled bool
+	}{
+		{accept: "application/xml", wantStatus: http.StatusNotFound, wantType: "application/xml; charset=utf-8", wantHandled: true},
+		{accept: "text/html, application/msgpack;q=0.5", wantStatus: http.StatusNotFound, wantType: "application/msgpack", wantHandled: true},
+		{accept: "text/html", wantStatus: http.StatusNotAcceptable, wantType: "application/json; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			handled = false
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus || w.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("response = %d %q, want %d %q", w.Code, w.Header().Get("Content-Type"), tt.wantStatus, tt.wantType)
+			}
+			if handled != tt.wantHandled {
+				t.Errorf("handled = %v, want %v", handled, tt.wantHandled)
+			}
+			if tt.wantStatus == http.StatusNotAcceptable && !strings.Contains(w.Body.String(), "application/json") {
+				t.Errorf("body = %s, want the supported types", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"math"
+	"mentalartsapi/dto"
+	"mentalartsapi/ratelimit"
+	"mentalartsapi/tenancy"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rate limit headers, as in the IETF RateLimit header fields draft
+const (
+	RateLimitLimitHeader     = "RateLimit-Limit"
+	RateLimitRemainingHeader = "RateLimit-Remaining"
+	RateLimitResetHeader     = "RateLimit-Reset"
+	RateLimitPolicyHeader    = "RateLimit-Policy"
+)
+
+// RateLimitKey identifies the client of a request for rate limiting
+type RateLimitKey func(c *gin.Context) string
+
+// ClientKey identifies clients by their verified credentials: the subject
+// of a tenant JWT signed with tokenSecret, or the admin token. Other clients
+// are identified by IP, including those sending credentials that don't
+// verify, so that made-up credentials can't dodge the limits.
+func ClientKey(tokenSecret, adminToken string) RateLimitKey {
+	return func(c *gin.Context) string {
+		if tokenSecret != "" {
+			if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+				claims, err := tenancy.VerifyToken(strings.TrimSpace(token), []byte(tokenSecret))
+				if err == nil {
+					tenant, _ := claims[tenancy.ClaimName].(string)
+					if subject, _ := claims["sub"].(string); subject != "" {
+						return "user:" + tenant + ":" + subject
+					}
+				}
+			}
+		}
+		if adminToken != "" {
+			if token := c.GetHeader(AdminTokenHeader); subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+				return "apikey:admin"
+			}
+		}
+		return "ip:" + c.ClientIP()
+	}
+}
+
+// RateLimit limits each client to limit requests to the routes of group,
+// which have a bucket of their own. Clients over the limit get 429 with a
+// Retry-After header, and every response tells the client its limit and
+// what is left of it. Without a store or a limit, requests are not
+// limited.
+//
+// When the store fails, requests are let through rather than refused.
+func RateLimit(store ratelimit.Store, key RateLimitKey, group string, limit ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if store != nil && !limit.Off() {
+			limitRequest(c, store, group+":"+key(c), limit)
+		}
+	}
+}
+
+// RateLimitByMethod limits GET, HEAD and OPTIONS requests to reads and the
+// others to writes, in separate buckets
+func RateLimitByMethod(store ratelimit.Store, key RateLimitKey, group string, reads, writes ratelimit.Limit) gin.HandlerFunc {
+	limitReads := RateLimit(store, key, group+":read", reads)
+	limitWrites := RateLimit(store, key, group+":write", writes)
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			limitReads(c)
+		default:
+			limitWrites(c)
+		}
+	}
+}
+
+func limitRequest(c *gin.Context, store ratelimit.Store, key string, limit ratelimit.Limit) {
+	result, err := store.Take(c.Request.Context(), key, limit)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "Rate limit store failed, request not limited", "error", err)
+		return
+	}
+
+	c.Header(RateLimitLimitHeader, strconv.Itoa(limit.Requests))
+	c.Header(RateLimitRemainingHeader, strconv.Itoa(result.Remaining))
+	c.Header(RateLimitResetHeader, strconv.Itoa(seconds(result.Reset)))
+	c.Header(RateLimitPolicyHeader, strconv.Itoa(limit.Requests)+";w="+strconv.Itoa(seconds(limit.Period)))
+	if !result.Allowed {
+		c.Header("Retry-After", strconv.Itoa(max(1, seconds(result.RetryAfter))))
+		abortWithError(c, http.StatusTooManyRequests, dto.ErrorResponse{Error: "rate limit exceeded, retry later"})
+	}
+}
+
+// seconds rounds d up to whole seconds
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
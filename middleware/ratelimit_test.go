@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"mentalartsapi/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failingStore is a rate limit store that can't be reached
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store down")
+}
+
+func rateLimitRouter(store ratelimit.Store, limit ratelimit.Limit) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	key := func(c *gin.Context) string { return c.GetHeader("X-Client") }
+	router.GET("/", RateLimit(store, key, "api", limit), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return router
+}
+
+func rateLimitRequest(router *gin.Engine, client string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Client", client)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	router := rateLimitRouter(ratelimit.NewMemoryStore(), ratelimit.Limit{Requests: 2, Period: time.Minute})
+
+	for i, remaining := range []string{"1", "0"} {
+		w := rateLimitRequest(router, "a")
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d status = %d, want %d", i, w.Code, http.StatusNoContent)
+		}
+		if got := w.Header().Get(RateLimitRemainingHeader); got != remaining {
+			t.Errorf("request %d %s = %q, want %q", i, RateLimitRemainingHeader, got, remaining)
+		}
+		if w.Header().Get("Retry-After") != "" {
+			t.Errorf("request %d allowed with Retry-After", i)
+		}
+	}
+
+	w := rateLimitRequest(router, "a")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status over the limit = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	for header, want := range map[string]string{
+		"Retry-After":            "30",
+		RateLimitLimitHeader:     "2",
+		RateLimitRemainingHeader: "0",
+		RateLimitResetHeader:     "60",
+		RateLimitPolicyHeader:    "2;w=60",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	if w := rateLimitRequest(router, "b"); w.Code != http.StatusNoContent {
+		t.Errorf("other client status = %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestRateLimitNotLimited(t *testing.T) {
+	tests := []struct {
+		name  string
+		store ratelimit.Store
+		limit ratelimit.Limit
+	}{
+		{name: "no store", limit: ratelimit.Limit{Requests: 1, Period: time.Minute}},
+		{name: "limit off", store: ratelimit.NewMemoryStore()},
+		{name: "store failing", store: failingStore{}, limit: ratelimit.Limit{Requests: 1, Period: time.Minute}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := rateLimitRouter(tt.store, tt.limit)
+			for i := 0; i < 3; i++ {
+				w := rateLimitRequest(router, "a")
+				if w.Code != http.StatusNoContent {
+					t.Fatalf("request %d status = %d, want %d", i, w.Code, http.StatusNoContent)
+				}
+				if w.Header().Get(RateLimitLimitHeader) != "" {
+					t.Errorf("request %d has rate limit headers", i)
+				}
+			}
+		})
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	key := ClientKey(testSecret, "admin-token")
+	token := "Bearer " + signToken(t, testSecret, map[string]interface{}{"tenant": "a", "sub": "7"})
+	forged := "Bearer " + signToken(t, "other", map[string]interface{}{"tenant": "a", "sub": "7"})
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "token", headers: map[string]string{"Authorization": token}, want: "user:a:7"},
+		{name: "admin token", headers: map[string]string{AdminTokenHeader: "admin-token"}, want: "apikey:admin"},
+		{name: "forged token", headers: map[string]string{"Authorization": forged}, want: "ip:192.0.2.1"},
+		{name: "wrong admin token", headers: map[string]string{AdminTokenHeader: "guess"}, want: "ip:192.0.2.1"},
+		// No proxy is trusted, so the header can't change the IP
+		{name: "forwarded for", headers: map[string]string{"X-Forwarded-For": "203.0.113.9"}, want: "ip:192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			router := gin.New()
+			if err := router.SetTrustedProxies(nil); err != nil {
+				t.Fatal(err)
+			}
+			var got string
+			router.GET("/", func(c *gin.Context) { got = key(c) })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
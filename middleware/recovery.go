@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"log/slog"
+	"mentalartsapi/dto"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery answers 500 when a handler panics, and logs the panic with its
+// stack
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			slog.ErrorContext(c.Request.Context(), "panic",
+				"error", recovered,
+				"stack", string(debug.Stack()),
+			)
+			if !c.Writer.Written() {
+				abortWithError(c, http.StatusInternalServerError, dto.ErrorResponse{Error: "internal server error"})
+				return
+			}
+			c.Abort()
+		}()
+		c.Next()
+	}
+}
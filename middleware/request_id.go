@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"mentalartsapi/logging"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the ID of a request, from the client or a proxy
+// in front of the API, and back in the response
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID matches the request IDs taken from clients, which end up
+// in logs
+var validRequestID = regexp.MustCompile(`^[\w.:@+/=-]{1,128}$`)
+
+// RequestID gives every request an ID: the X-Request-ID header sent by the
+// client if it is valid, or a random one. The ID is returned in the same
+// header and stored in the request context, so that the request's logs and
+// error responses carry it.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Header(RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
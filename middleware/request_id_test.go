@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"encoding/json"
+	"mentalartsapi/dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/", func(c *gin.Context) {
+		abortWithError(c, http.StatusNotFound, dto.ErrorResponse{Error: "book not found"})
+	})
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "from client", header: "trace-1:span/2=", keep: true},
+		{name: "missing"},
+		{name: "invalid", header: "id with spaces"},
+		{name: "too long", header: strings.Repeat("a", 129)},
+	}
+	seen := map[string]bool{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(RequestIDHeader, tt.header)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tt.keep && id != tt.header {
+				t.Errorf("request ID = %q, want the client's %q", id, tt.header)
+			}
+			if !tt.keep && (len(id) != 32 || seen[id]) {
+				t.Errorf("request ID = %q, want a new random one", id)
+			}
+			seen[id] = true
+
+			var response dto.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.RequestID != id {
+				t.Errorf("error response = %s, want request_id %q", w.Body, id)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"mentalartsapi/dto"
+	"mentalartsapi/models"
+	"mentalartsapi/tenancy"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	TenantHeader     = "X-Tenant-ID"
+	AdminTokenHeader = "X-Admin-Token"
+	tenantContextKey = "tenant"
+)
+
+// tenantKey is the request context key of the resolved tenant
+type tenantKey struct{}
+
+// TenantConfig controls how the tenant of a request is resolved
+type TenantConfig struct {
+	// BaseDomain enables subdomain resolution, e.g. "acme.books.example.com"
+	// resolves to "acme" when BaseDomain is "books.example.com"
+	BaseDomain string
+	// TokenSecret requires every request to send an HS256 JWT as a bearer
+	// token, whose tenant claim decides the tenant
+	TokenSecret string
+	// TrustHeaders lets requests pick their tenant with the X-Tenant-ID
+	// header or the subdomain when there is no TokenSecret. Anyone can send
+	// them, so only set it when tenants don't need to be kept apart, or a
+	// proxy in front sets them.
+	TrustHeaders bool
+	// DefaultTenant is used when nothing else identifies the tenant
+	DefaultTenant string
+}
+
+var (
+	// ErrTenantUnresolved is returned when nothing identifies the tenant
+	ErrTenantUnresolved = errors.New("tenant could not be resolved")
+	// ErrTenantNotFound is returned for unknown or inactive tenants
+	ErrTenantNotFound = errors.New("tenant not found")
+	// ErrTenantMismatch is returned when the header or subdomain names
+	// another tenant than the bearer token
+	ErrTenantMismatch = errors.New("tenant does not match the token")
+	// ErrTokenRequired is returned for requests without a bearer token when
+	// a token secret is configured
+	ErrTokenRequired = errors.New("a bearer token is required")
+	// ErrTenantHeadersUntrusted is returned when the header or subdomain
+	// names a tenant, but they are not trusted to
+	ErrTenantHeadersUntrusted = errors.New("the tenant can't be chosen with the X-Tenant-ID header or subdomain")
+)
+
+// Tenant resolves the tenant of the request and stores it in the request
+// context so that GORM queries are scoped to it. With a token secret, a
+// verified bearer token is required and decides the tenant; the X-Tenant-ID
+// header and the subdomain may only name the token's tenant. Without one,
+// the header and the subdomain, in that order, resolve the tenant when they
+// are trusted, and otherwise only the default tenant is served.
+//
+// Requests made on behalf of another one, like the operations of a batch,
+// carry its context and keep the tenant resolved for it. Their lookup would
+// otherwise need a connection of its own while the batch's transaction
+// holds one.
+func Tenant(db *gorm.DB, config TenantConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, ok := c.Request.Context().Value(tenantKey{}).(models.Tenant)
+		if !ok {
+			var err error
+			tenant, err = LookupTenant(db.WithContext(c.Request.Context()), config, c.GetHeader, c.Request.Host)
+			if err != nil {
+				abortWithError(c, TenantErrorStatus(err), dto.ErrorResponse{Error: err.Error()})
+				return
+			}
+		}
+
+		c.Set(tenantContextKey, tenant)
+		ctx := context.WithValue(c.Request.Context(), tenantKey{}, tenant)
+		c.Request = c.Request.WithContext(tenancy.WithTenant(ctx, uint(tenant.ID)))
+		c.Next()
+	}
+}
+
+// LookupTenant resolves the active tenant of a request from its headers and
+// host. It lets other transports, such as gRPC metadata, share the rules of
+// the Tenant middleware.
+func LookupTenant(db *gorm.DB, config TenantConfig, header func(string) string, host string) (models.Tenant, error) {
+	var tenant models.Tenant
+
+	slug, err := resolveTenantSlug(config, header, host)
+	if err != nil {
+		return tenant, err
+	}
+	if slug == "" {
+		return tenant, ErrTenantUnresolved
+	}
+
+	if err := db.Where("slug = ? AND active = ?", slug, true).First(&tenant).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return tenant, ErrTenantNotFound
+		}
+		return tenant, err
+	}
+	return tenant, nil
+}
+
+// TenantErrorStatus is the HTTP status for an error of LookupTenant
+func TenantErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, tenancy.ErrInvalidToken), errors.Is(err, ErrTokenRequired):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrTenantMismatch), errors.Is(err, ErrTenantHeadersUntrusted):
+		return http.StatusForbidden
+	case errors.Is(err, ErrTenantUnresolved):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrTenantNotFound):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// CurrentTenant returns the tenant resolved for the request
+func CurrentTenant(c *gin.Context) (models.Tenant, bool) {
+	value, ok := c.Get(tenantContextKey)
+	if !ok {
+		return models.Tenant{}, false
+	}
+	tenant, ok := value.(models.Tenant)
+	return tenant, ok
+}
+
+// AdminToken protects the tenant admin API with a static token. An empty
+// token disables the API entirely.
+func AdminToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			abortWithError(c, http.StatusNotFound, dto.ErrorResponse{Error: "admin API is disabled"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader(AdminTokenHeader)), []byte(token)) != 1 {
+			abortWithError(c, http.StatusUnauthorized, dto.ErrorResponse{Error: "invalid admin token"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func resolveTenantSlug(config TenantConfig, header func(string) string, host string) (string, error) {
+	headerSlug := strings.TrimSpace(header(TenantHeader))
+	hostSlug := subdomain(config, host)
+
+	// The token is the only signed claim to a tenant, so neither the header
+	// and host nor leaving the token out can take a client to another one
+	if config.TokenSecret != "" {
+		token, ok := strings.CutPrefix(header("Authorization"), "Bearer ")
+		if !ok {
+			return "", ErrTokenRequired
+		}
+		slug, err := tenancy.TenantFromToken(strings.TrimSpace(token), []byte(config.TokenSecret))
+		if err != nil {
+			return "", err
+		}
+		if (headerSlug != "" && headerSlug != slug) || (hostSlug != "" && hostSlug != slug) {
+			return "", ErrTenantMismatch
+		}
+		return slug, nil
+	}
+
+	if !config.TrustHeaders {
+		if (headerSlug != "" && headerSlug != config.DefaultTenant) || (hostSlug != "" && hostSlug != config.DefaultTenant) {
+			return "", ErrTenantHeadersUntrusted
+		}
+		return config.DefaultTenant, nil
+	}
+	if headerSlug != "" {
+		return headerSlug, nil
+	}
+	if hostSlug != "" {
+		return hostSlug, nil
+	}
+	return config.DefaultTenant, nil
+}
+
+// subdomain returns the tenant slug in host when subdomain resolution is
+// enabled, or ""
+func subdomain(config TenantConfig, host string) string {
+	if config.BaseDomain == "" {
+		return ""
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if slug, ok := strings.CutSuffix(host, "."+config.BaseDomain); ok && slug != "" && !strings.Contains(slug, ".") {
+		return slug
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"mentalartsapi/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+const testSecret = "secret"
+
+func signToken(t *testing.T, secret string, claims map[string]interface{}) string {
+	t.Helper()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func tenantRouter(t *testing.T, config TenantConfig) *gin.Engine {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Tenant{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, slug := range []string{"a", "b"} {
+		if err := db.Create(&models.Tenant{Name: slug, Slug: slug, Active: true}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/", Tenant(db, config), func(c *gin.Context) {
+		tenant, _ := CurrentTenant(c)
+		c.String(http.StatusOK, tenant.Slug)
+	})
+	return router
+}
+
+func TestTenant(t *testing.T) {
+	withToken := TenantConfig{TokenSecret: testSecret, BaseDomain: "books.example.com", DefaultTenant: "a"}
+	trusted := TenantConfig{TrustHeaders: true, BaseDomain: "books.example.com"}
+	untrusted := TenantConfig{BaseDomain: "books.example.com", DefaultTenant: "a"}
+	tokenA := "Bearer " + signToken(t, testSecret, map[string]interface{}{"tenant": "a", "sub": "1"})
+	forged := "Bearer " + signToken(t, "other", map[string]interface{}{"tenant": "b", "sub": "1"})
+
+	tests := []struct {
+		name          string
+		config        TenantConfig
+		host          string
+		authorization string
+		tenantHeader  string
+		wantStatus    int
+		wantTenant    string
+	}{
+		{name: "token", config: withToken, authorization: tokenA, wantStatus: http.StatusOK, wantTenant: "a"},
+		{name: "token and matching header", config: withToken, authorization: tokenA, tenantHeader: "a", wantStatus: http.StatusOK, wantTenant: "a"},
+		{name: "token and other tenant's header", config: withToken, authorization: tokenA, tenantHeader: "b", wantStatus: http.StatusForbidden},
+		{name: "token and other tenant's subdomain", config: withToken, host: "b.books.example.com", authorization: tokenA, wantStatus: http.StatusForbidden},
+		{name: "token with a bad signature", config: withToken, authorization: forged, tenantHeader: "b", wantStatus: http.StatusUnauthorized},
+		{name: "no token and other tenant's header", config: withToken, tenantHeader: "b", wantStatus: http.StatusUnauthorized},
+		{name: "no token and other tenant's subdomain", config: withToken, host: "b.books.example.com", wantStatus: http.StatusUnauthorized},
+		{name: "no token", config: withToken, wantStatus: http.StatusUnauthorized},
+		{name: "trusted header", config: trusted, tenantHeader: "b", wantStatus: http.StatusOK, wantTenant: "b"},
+		{name: "trusted subdomain", config: trusted, host: "b.books.example.com", wantStatus: http.StatusOK, wantTenant: "b"},
+		{name: "trusted header over subdomain", config: trusted, host: "a.books.example.com", tenantHeader: "b", wantStatus: http.StatusOK, wantTenant: "b"},
+		{name: "nothing", config: trusted, wantStatus: http.StatusBadRequest},
+		{name: "untrusted header", config: untrusted, tenantHeader: "b", wantStatus: http.StatusForbidden},
+		{name: "untrusted subdomain", config: untrusted, host: "b.books.example.com", wantStatus: http.StatusForbidden},
+		{name: "default tenant", config: untrusted, wantStatus: http.StatusOK, wantTenant: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := tenantRouter(t, tt.config)
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.tenantHeader != "" {
+				req.Header.Set(TenantHeader, tt.tenantHeader)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantTenant != "" && w.Body.String() != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", w.Body, tt.wantTenant)
+			}
+		})
+	}
+}
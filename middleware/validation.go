@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"mentalartsapi/dto"
+	"mentalartsapi/logging"
+	"mentalartsapi/openapi"
+	"mime"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	routeParam = regexp.MustCompile(`:(\w+)`)
+	// customMethodRoute matches the routes shared by the custom methods of
+	// a collection, like /books:action for /books:bulkCreate
+	customMethodRoute = regexp.MustCompile(`\w:action$`)
+)
+
+// ValidateRequests rejects requests that don't match the OpenAPI spec with
+// a 400 listing every problem, before the handler runs. Routes the spec
+// doesn't document pass through.
+//
+// With validateResponses, JSON responses are checked as well. Violations
+// are logged and, in test mode, replace the response with a 500 so that
+// tests notice them. Responses to sparse fieldset requests are skipped, as
+// they leave out fields on purpose.
+func ValidateRequests(validator *openapi.Validator, validateResponses bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		path := routeParam.ReplaceAllString(c.FullPath(), "{$1}")
+		// Custom methods are documented under their own paths
+		if customMethodRoute.MatchString(c.FullPath()) {
+			path = c.Request.URL.Path
+		}
+		if !validator.Documents(method, path) {
+			c.Next()
+			return
+		}
+
+		details, err := validator.ValidateRequest(c.Request, method, path, c.Param)
+		if err != nil {
+			abortWithError(c, http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+		if len(details) > 0 {
+			abortWithError(c, http.StatusBadRequest, dto.ErrorResponse{
+				Error:   "request does not match the API specification",
+				Details: details,
+			})
+			return
+		}
+
+		if !validateResponses || c.Query("fields") != "" {
+			c.Next()
+			return
+		}
+
+		writer := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if !writer.buffering {
+			return
+		}
+		body := writer.body.Bytes()
+		if details := validator.ValidateResponse(method, path, writer.Status(), body); len(details) > 0 {
+			slog.ErrorContext(c.Request.Context(), "Response does not match the API specification",
+				"method", method,
+				"path", c.Request.URL.Path,
+				"details", details,
+			)
+			if gin.Mode() == gin.TestMode {
+				c.JSON(http.StatusInternalServerError, dto.ErrorResponse{
+					Error:     "response does not match the API specification",
+					Details:   details,
+					RequestID: logging.RequestID(c.Request.Context()),
+				})
+				return
+			}
+		}
+		c.Writer.Write(body)
+	}
+}
+
+// bufferedWriter holds back JSON responses so they can be validated before
+// they are sent. Other responses, like exports, stream through.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	decided   bool
+	buffering bool
+	body      bytes.Buffer
+}
+
+func (w *bufferedWriter) decide() {
+	if !w.decided {
+		w.decided = true
+		mediaType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		w.buffering = mediaType == "application/json"
+	}
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.buffering {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *bufferedWriter) WriteHeaderNow() {
+	if !w.buffering {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.buffering || w.ResponseWriter.Written()
+}
+
+func (w *bufferedWriter) Size() int {
+	if w.buffering {
+		return w.body.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+func (w *bufferedWriter) Flush() {
+	if !w.buffering {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. for
+// exports to extend their write deadline
+func (w *bufferedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
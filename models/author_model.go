@@ -2,12 +2,11 @@ package models
 
 import (
 	"time"
-
-	"gorm.io/gorm"
 )
 
 type Author struct {
-	gorm.Model
+	Model
+	TenantID  uint      `json:"-" gorm:"index"`
 	Name      string    `json:"name" binding:"required"`
 	Biography string    `json:"biography"`
 	BirthDate time.Time `json:"birth_date"`
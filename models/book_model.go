@@ -1,16 +1,37 @@
 package models
 
 import (
-	"gorm.io/gorm"
+	"mentalartsapi/ids"
 )
 
+// Book formats
+const (
+	FormatHardcover = "hardcover"
+	FormatPaperback = "paperback"
+	FormatEbook     = "ebook"
+	FormatAudiobook = "audiobook"
+)
+
+// Book is a single edition of a Work, with its own ISBN
 type Book struct {
-	gorm.Model
-	Title          string   `json:"title" binding:"required"`
-	ISBN           string   `json:"isbn" binding:"required" gorm:"unique"`
-	PublicationYear int      `json:"publication_year"`
-	Description    string   `json:"description"`
-	AuthorID       uint     `json:"author_id" binding:"required"`
-	Author         Author   `json:"author,omitempty" gorm:"foreignKey:AuthorID"`
-	Reviews        []Review `json:"reviews,omitempty" gorm:"foreignKey:BookID"`
-} 
\ No newline at end of file
+	Model
+	TenantID        uint              `json:"-" gorm:"uniqueIndex:idx_books_tenant_isbn"`
+	Title           string            `json:"title" binding:"required"`
+	ISBN            string            `json:"isbn" binding:"required" gorm:"uniqueIndex:idx_books_tenant_isbn"`
+	PublicationYear int               `json:"publication_year"`
+	Description     string            `json:"description"`
+	Format          string            `json:"format,omitempty"`
+	Language        string            `json:"language,omitempty"`
+	PageCount       int               `json:"page_count,omitempty"`
+	EditionNumber   int               `json:"edition_number,omitempty"`
+	AuthorID        ids.ID            `json:"author_id" binding:"required"`
+	Author          Author            `json:"author,omitempty" gorm:"foreignKey:AuthorID"`
+	WorkID          ids.ID            `json:"work_id" gorm:"index"`
+	Work            *Work             `json:"work,omitempty" gorm:"foreignKey:WorkID"`
+	PublisherID     *ids.ID           `json:"publisher_id,omitempty" gorm:"index"`
+	Publisher       *Publisher        `json:"publisher,omitempty" gorm:"foreignKey:PublisherID"`
+	CoverURL        string            `json:"cover_url,omitempty"`
+	CoverThumbnails map[string]string `json:"cover_thumbnails,omitempty" gorm:"serializer:json"`
+	CoverKeys       []string          `json:"-" gorm:"serializer:json"`
+	Reviews         []Review          `json:"reviews,omitempty" gorm:"foreignKey:BookID"`
+}
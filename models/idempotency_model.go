@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// IdempotencyKey records a request sent with an Idempotency-Key header and
+// the response to it, so that retries of the request get the same response.
+// Status is zero while the first request is still being handled.
+type IdempotencyKey struct {
+	ID          uint   `gorm:"primarykey"`
+	TenantID    uint   `gorm:"uniqueIndex:idx_idempotency_keys_tenant_key"`
+	Key         string `gorm:"uniqueIndex:idx_idempotency_keys_tenant_key;size:255;not null"`
+	Fingerprint string `gorm:"size:64;not null"`
+	Status      int
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time `gorm:"index"`
+}
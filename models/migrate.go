@@ -0,0 +1,124 @@
+package models
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// tables are the models Migrate creates tables for
+var tables = []interface{}{&Tenant{}, &Author{}, &Publisher{}, &Work{}, &Book{}, &Review{}, &Series{}, &SeriesEntry{}, &IdempotencyKey{}}
+
+// Migrate brings the database schema up to date, makes sure the default
+// tenant exists and backfills rows created by earlier versions of the schema
+func Migrate(db *gorm.DB, defaultTenant string) error {
+	// ISBNs used to be unique across the whole deployment
+	if db.Migrator().HasConstraint(&Book{}, "uni_books_isbn") {
+		if err := db.Migrator().DropConstraint(&Book{}, "uni_books_isbn"); err != nil {
+			return err
+		}
+	}
+
+	if err := db.AutoMigrate(tables...); err != nil {
+		return err
+	}
+
+	if err := assignDefaultTenant(db, defaultTenant); err != nil {
+		return err
+	}
+
+	return createMissingWorks(db)
+}
+
+// CheckSchema reports an error when a table or column of the models is
+// missing, i.e. when the database needs Migrate
+func CheckSchema(db *gorm.DB) error {
+	// HasTable hides connection errors, which would read as missing tables
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if err := sqlDB.PingContext(db.Statement.Context); err != nil {
+		return err
+	}
+
+	migrator := db.Migrator()
+	for _, model := range tables {
+		statement := &gorm.Statement{DB: db}
+		if err := statement.Parse(model); err != nil {
+			return err
+		}
+		table := statement.Schema.Table
+		if !migrator.HasTable(table) {
+			return fmt.Errorf("table %s is missing, the database needs migrating", table)
+		}
+
+		columnTypes, err := migrator.ColumnTypes(model)
+		if err != nil {
+			return err
+		}
+		columns := make(map[string]bool, len(columnTypes))
+		for _, columnType := range columnTypes {
+			columns[columnType.Name()] = true
+		}
+		for _, name := range statement.Schema.DBNames {
+			if !columns[name] {
+				return fmt.Errorf("column %s.%s is missing, the database needs migrating", table, name)
+			}
+		}
+	}
+	return nil
+}
+
+// assignDefaultTenant gives rows created before multi-tenancy to the default
+// tenant
+func assignDefaultTenant(db *gorm.DB, defaultTenant string) error {
+	if defaultTenant == "" {
+		return nil
+	}
+
+	tenant := Tenant{Name: defaultTenant, Slug: defaultTenant, Active: true}
+	if err := db.Where(Tenant{Slug: defaultTenant}).FirstOrCreate(&tenant).Error; err != nil {
+		return err
+	}
+
+	for _, model := range []interface{}{&Author{}, &Publisher{}, &Work{}, &Book{}, &Review{}} {
+		if err := db.Unscoped().Model(model).
+			Where("tenant_id IS NULL OR tenant_id = 0").
+			Update("tenant_id", tenant.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createMissingWorks wraps every book created before works and editions
+// existed in a work of its own and moves its reviews onto that work
+func createMissingWorks(db *gorm.DB) error {
+	var books []Book
+	if err := db.Unscoped().Where("work_id IS NULL OR work_id = 0").Find(&books).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, book := range books {
+			work := Work{
+				TenantID:    book.TenantID,
+				Title:       book.Title,
+				Description: book.Description,
+				AuthorID:    book.AuthorID,
+			}
+			if err := tx.Create(&work).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Model(&Book{}).Where("id = ?", book.ID).Update("work_id", work.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Model(&Review{}).Where("book_id = ?", book.ID).Update("work_id", work.ID).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"mentalartsapi/ids"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Model is gorm.Model with an ids.ID primary key, so that the IDs of
+// records are written and read in their public form
+type Model struct {
+	ID        ids.ID `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
@@ -0,0 +1,10 @@
+package models
+
+type Publisher struct {
+	Model
+	TenantID uint   `json:"-" gorm:"index"`
+	Name     string `json:"name" binding:"required"`
+	Country  string `json:"country"`
+	Website  string `json:"website"`
+	Books    []Book `json:"books,omitempty" gorm:"foreignKey:PublisherID"`
+}
@@ -1,16 +1,18 @@
 package models
 
 import (
+	"mentalartsapi/ids"
 	"time"
-
-	"gorm.io/gorm"
 )
 
+// Review belongs to a Work. BookID records the edition it was posted on.
 type Review struct {
-	gorm.Model
+	Model
+	TenantID   uint      `json:"-" gorm:"index"`
 	Rating     int       `json:"rating" binding:"required,min=1,max=5"`
 	Comment    string    `json:"comment"`
 	DatePosted time.Time `json:"date_posted" gorm:"default:CURRENT_TIMESTAMP"`
-	BookID     uint      `json:"book_id" binding:"required"`
+	WorkID     ids.ID    `json:"work_id" gorm:"index"`
+	BookID     ids.ID    `json:"book_id" binding:"required"`
 	Book       Book      `json:"book,omitempty" gorm:"foreignKey:BookID"`
-} 
\ No newline at end of file
+}
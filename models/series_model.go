@@ -0,0 +1,24 @@
+package models
+
+import (
+	"mentalartsapi/ids"
+)
+
+type Series struct {
+	Model
+	TenantID    uint          `json:"-" gorm:"index"`
+	Title       string        `json:"title" binding:"required"`
+	Description string        `json:"description"`
+	Entries     []SeriesEntry `json:"volumes,omitempty" gorm:"foreignKey:SeriesID"`
+}
+
+// SeriesEntry places a book in a series. Positions are fractional so that
+// novellas can sit between numbered volumes, e.g. 2.5.
+type SeriesEntry struct {
+	Model
+	TenantID uint    `json:"-" gorm:"index"`
+	SeriesID ids.ID  `json:"series_id" gorm:"uniqueIndex:idx_series_entries_series_book"`
+	BookID   ids.ID  `json:"book_id" gorm:"uniqueIndex:idx_series_entries_series_book"`
+	Book     Book    `json:"book,omitempty" gorm:"foreignKey:BookID"`
+	Position float64 `json:"position"`
+}
@@ -0,0 +1,8 @@
+package models
+
+type Tenant struct {
+	Model
+	Name   string `json:"name" binding:"required"`
+	Slug   string `json:"slug" binding:"required" gorm:"uniqueIndex;not null"`
+	Active bool   `json:"active"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"mentalartsapi/ids"
+)
+
+// Work is the abstract creation that editions are published from. Reviews
+// attach to the work so that they are shared by all of its editions.
+type Work struct {
+	Model
+	TenantID    uint     `json:"-" gorm:"index"`
+	Title       string   `json:"title" binding:"required"`
+	Description string   `json:"description"`
+	AuthorID    ids.ID   `json:"author_id" binding:"required"`
+	Author      Author   `json:"author,omitempty" gorm:"foreignKey:AuthorID"`
+	Editions    []Book   `json:"editions,omitempty" gorm:"foreignKey:WorkID"`
+	Reviews     []Review `json:"reviews,omitempty" gorm:"foreignKey:WorkID"`
+}
@@ -0,0 +1,379 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	paramPattern    = regexp.MustCompile(`^(\S+)\s+(\w+)\s+(\S+)\s+(true|false)(?:\s+"(.*)")?$`)
+	responsePattern = regexp.MustCompile(`^(\d{3})\s+\{(\w+)\}\s+(\S+)(?:\s+"(.*)")?$`)
+	routerPattern   = regexp.MustCompile(`^(\S+)\s+\[(\w+)\]$`)
+)
+
+// mimeTypes expands the swag shorthands for media types
+var mimeTypes = map[string]string{
+	"json":                  "application/json",
+	"xml":                   "application/xml",
+	"plain":                 "text/plain",
+	"html":                  "text/html",
+	"mpfd":                  "multipart/form-data",
+	"x-www-form-urlencoded": "application/x-www-form-urlencoded",
+}
+
+// Generate builds the OpenAPI document of the module in dir from the
+// general API info on func main in main.go and the operation annotations
+// in handlers
+func Generate(dir string) (*Document, error) {
+	fset := token.NewFileSet()
+	mainFile, err := parser.ParseFile(fset, filepath.Join(dir, "main.go"), nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		OpenAPI: Version,
+		Paths:   map[string]*PathItem{},
+	}
+	for _, decl := range mainFile.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "main" {
+			parseInfo(doc, commentLines(mainFile, fn))
+		}
+	}
+	if doc.Info.Title == "" {
+		return nil, fmt.Errorf("main.go: no @title on func main")
+	}
+
+	packages, err := parser.ParseDir(fset, filepath.Join(dir, "handlers"), nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newSchemas()
+	for _, pkg := range packages {
+		files := make([]string, 0, len(pkg.Files))
+		for name := range pkg.Files {
+			files = append(files, name)
+		}
+		sort.Strings(files)
+
+		for _, name := range files {
+			file := pkg.Files[name]
+			for _, decl := range file.Decls {
+				fn, ok := decl.(*ast.FuncDecl)
+				if !ok || fn.Doc == nil {
+					continue
+				}
+				lines := commentLines(file, fn)
+				if err := addOperation(doc, s, fn.Name.Name, lines); err != nil {
+					return nil, fmt.Errorf("%s: %s: %w", fset.Position(fn.Pos()), fn.Name.Name, err)
+				}
+			}
+		}
+	}
+	doc.Components.Schemas = s.components
+	return doc, nil
+}
+
+// Marshal encodes doc as indented JSON, as committed in docs/openapi.json
+func Marshal(doc *Document) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// commentLines returns the annotation lines of the comments directly above
+// fn, including the general API info blocks that swag allows to be
+// separated by blank lines
+func commentLines(file *ast.File, fn *ast.FuncDecl) []string {
+	var lines []string
+	for _, group := range file.Comments {
+		if group.End() > fn.Pos() {
+			break
+		}
+		for _, line := range strings.Split(group.Text(), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "@") {
+				lines = append(lines, line)
+			}
+		}
+		if group == fn.Doc {
+			break
+		}
+		if fn.Name.Name != "main" {
+			lines = nil
+		}
+	}
+	return lines
+}
+
+func splitAnnotation(line string) (string, string) {
+	key, value, _ := strings.Cut(line, " ")
+	return strings.ToLower(key), strings.TrimSpace(value)
+}
+
+func parseInfo(doc *Document, lines []string) {
+	var scheme *SecurityScheme
+	for _, line := range lines {
+		key, value := splitAnnotation(line)
+		switch key {
+		case "@title":
+			doc.Info.Title = value
+		case "@version":
+			doc.Info.Version = value
+		case "@description":
+			if scheme != nil {
+				scheme.Description = value
+			} else {
+				doc.Info.Description = value
+			}
+		case "@termsofservice":
+			doc.Info.TermsOfService = value
+		case "@contact.name":
+			contact(doc).Name = value
+		case "@contact.email":
+			contact(doc).Email = value
+		case "@license.name":
+			license(doc).Name = value
+		case "@license.url":
+			license(doc).URL = value
+		case "@host":
+			doc.Servers = []Server{{URL: "http://" + value}}
+		case "@securitydefinitions.apikey":
+			scheme = &SecurityScheme{Type: "apiKey"}
+			doc.Components.SecuritySchemes = map[string]*SecurityScheme{value: scheme}
+		case "@in":
+			if scheme != nil {
+				scheme.In = value
+			}
+		case "@name":
+			if scheme != nil {
+				scheme.Name = value
+			}
+		}
+	}
+}
+
+func contact(doc *Document) *Contact {
+	if doc.Info.Contact == nil {
+		doc.Info.Contact = &Contact{}
+	}
+	return doc.Info.Contact
+}
+
+func license(doc *Document) *License {
+	if doc.Info.License == nil {
+		doc.Info.License = &License{}
+	}
+	return doc.Info.License
+}
+
+// addOperation adds the operation annotated by lines, if they have a
+// @Router. Paths are taken as written, since the routes spell out /api/v1.
+func addOperation(doc *Document, s *schemas, name string, lines []string) error {
+	op := &Operation{OperationID: name, Responses: map[string]*Response{}}
+	var route, method string
+	var accept, produce []string
+	var body *Parameter
+	var bodyType string
+	var form []*Parameter
+
+	for _, line := range lines {
+		key, value := splitAnnotation(line)
+		switch key {
+		case "@summary":
+			op.Summary = value
+		case "@description":
+			op.Description = value
+		case "@tags":
+			op.Tags = strings.Split(value, ",")
+		case "@accept":
+			accept = append(accept, mimeType(value))
+		case "@produce":
+			produce = append(produce, mimeType(value))
+		case "@param":
+			m := paramPattern.FindStringSubmatch(value)
+			if m == nil {
+				return fmt.Errorf("malformed @Param %q", value)
+			}
+			param := &Parameter{Name: m[1], In: m[2], Required: m[4] == "true", Description: m[5]}
+			switch param.In {
+			case "body":
+				body, bodyType = param, m[3]
+				continue
+			case "formData":
+				schema, err := primitive(m[3])
+				if err != nil {
+					return err
+				}
+				param.Schema = schema
+				form = append(form, param)
+				continue
+			case "path", "query", "header":
+			default:
+				return fmt.Errorf("unsupported parameter location %q", param.In)
+			}
+			schema, err := primitive(m[3])
+			if err != nil {
+				return err
+			}
+			param.Schema = schema
+			op.Parameters = append(op.Parameters, param)
+		case "@success", "@failure":
+			m := responsePattern.FindStringSubmatch(value)
+			if m == nil {
+				return fmt.Errorf("malformed %s %q", line[:strings.Index(line, " ")], value)
+			}
+			response, err := newResponse(s, m[2], m[3], m[4], produce)
+			if err != nil {
+				return err
+			}
+			if response.Description == "" {
+				code, _ := strconv.Atoi(m[1])
+				response.Description = http.StatusText(code)
+			}
+			op.Responses[m[1]] = response
+		case "@router":
+			m := routerPattern.FindStringSubmatch(value)
+			if m == nil {
+				return fmt.Errorf("malformed @Router %q", value)
+			}
+			route, method = m[1], strings.ToLower(m[2])
+		}
+	}
+	if route == "" {
+		return nil
+	}
+
+	requestBody, err := newRequestBody(s, accept, body, bodyType, form)
+	if err != nil {
+		return err
+	}
+	op.RequestBody = requestBody
+
+	item := doc.Paths[route]
+	if item == nil {
+		item = &PathItem{}
+		doc.Paths[route] = item
+	}
+	if _, ok := (*item)[method]; ok {
+		return fmt.Errorf("duplicate operation %s %s", strings.ToUpper(method), route)
+	}
+	(*item)[method] = op
+	return nil
+}
+
+func mimeType(value string) string {
+	if mime, ok := mimeTypes[value]; ok {
+		return mime
+	}
+	return value
+}
+
+// primitive returns the schema of a parameter type
+func primitive(name string) (*Schema, error) {
+	switch name {
+	case "int", "integer":
+		return &Schema{Type: "integer"}, nil
+	case "number":
+		return &Schema{Type: "number"}, nil
+	case "bool", "boolean":
+		return &Schema{Type: "boolean"}, nil
+	case "string":
+		return &Schema{Type: "string"}, nil
+	case "file":
+		return &Schema{Type: "string", ContentMediaType: "application/octet-stream"}, nil
+	}
+	return nil, fmt.Errorf("unsupported parameter type %q", name)
+}
+
+// typeSchema returns a reference to the schema of an annotated type name
+func typeSchema(s *schemas, name string) (*Schema, error) {
+	t, ok := types[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %s, add it to the types in openapi/types.go", name)
+	}
+	return s.ref(t)
+}
+
+// newRequestBody describes the body of an operation: the body parameter
+// for JSON, the form parameters for multipart forms and the raw content
+// for any other accepted type
+func newRequestBody(s *schemas, accept []string, body *Parameter, bodyType string, form []*Parameter) (*RequestBody, error) {
+	requestBody := &RequestBody{Content: map[string]*MediaType{}}
+	for _, mime := range accept {
+		switch {
+		case mime == "application/json":
+			if body == nil {
+				continue
+			}
+			schema, err := typeSchema(s, bodyType)
+			if err != nil {
+				return nil, err
+			}
+			requestBody.Content[mime] = &MediaType{Schema: schema}
+			requestBody.Description = body.Description
+			requestBody.Required = body.Required
+		case mime == "multipart/form-data":
+			schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+			for _, param := range form {
+				property := *param.Schema
+				property.Description = param.Description
+				schema.Properties[param.Name] = &property
+				if param.Required {
+					schema.Required = append(schema.Required, param.Name)
+					requestBody.Required = true
+				}
+			}
+			requestBody.Content[mime] = &MediaType{Schema: schema}
+		default:
+			requestBody.Content[mime] = &MediaType{Schema: &Schema{Type: "string"}}
+		}
+	}
+	if len(requestBody.Content) == 0 {
+		return nil, nil
+	}
+	return requestBody, nil
+}
+
+// newResponse describes a response. Objects are always JSON, while files
+// come in any of the produced types.
+func newResponse(s *schemas, kind, name, description string, produce []string) (*Response, error) {
+	response := &Response{Description: description, Content: map[string]*MediaType{}}
+	switch kind {
+	case "object":
+		schema, err := typeSchema(s, name)
+		if err != nil {
+			return nil, err
+		}
+		response.Content["application/json"] = &MediaType{Schema: schema}
+	case "array":
+		schema, err := typeSchema(s, name)
+		if err != nil {
+			return nil, err
+		}
+		response.Content["application/json"] = &MediaType{Schema: &Schema{Type: "array", Items: schema}}
+	case "file":
+		for _, mime := range produce {
+			response.Content[mime] = &MediaType{Schema: &Schema{Type: "string"}}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported response kind {%s}", kind)
+	}
+	return response, nil
+}
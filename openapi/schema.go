@@ -0,0 +1,241 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"mentalartsapi/ids"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	deletedAtType  = reflect.TypeOf(gorm.DeletedAt{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	idType         = reflect.TypeOf(ids.ID(0))
+)
+
+// schemas builds component schemas for Go types by reflection, following
+// encoding/json for the property names and the gin binding tags for the
+// constraints
+type schemas struct {
+	components map[string]*Schema
+}
+
+func newSchemas() *schemas {
+	return &schemas{components: map[string]*Schema{}}
+}
+
+// schemaName is the component name of a named struct, e.g. models.Book
+func schemaName(t reflect.Type) string {
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// ref returns a reference to the component schema of a named struct,
+// adding it and the types it uses to the components first
+func (s *schemas) ref(t reflect.Type) (*Schema, error) {
+	name := schemaName(t)
+	if _, ok := s.components[name]; ok {
+		return ref(name), nil
+	}
+
+	// Register before building, so that recursive types refer to themselves
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.components[name] = schema
+	if err := s.addFields(schema, t); err != nil {
+		delete(s.components, name)
+		return nil, err
+	}
+	return ref(name), nil
+}
+
+// addFields adds the JSON properties of struct t to schema, flattening
+// embedded structs like encoding/json does
+func (s *schemas) addFields(schema *Schema, t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			if err := s.addFields(schema, field.Type); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		property, err := s.schema(field.Type, !strings.Contains(options, "omitempty"))
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), field.Name, err)
+		}
+		required, err := constrain(property, field.Tag.Get("binding"))
+		if err != nil {
+			return fmt.Errorf("%s.%s: %w", t.Name(), field.Name, err)
+		}
+		schema.Properties[name] = property
+		if required {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return nil
+}
+
+// schema returns the schema of a value of type t. Pointers, and slices and
+// maps that are not omitted when empty, may be null.
+func (s *schemas) schema(t reflect.Type, nilable bool) (*Schema, error) {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case deletedAtType:
+		return &Schema{Type: []string{"string", "null"}, Format: "date-time"}, nil
+	case rawMessageType:
+		return &Schema{}, nil
+	case idType:
+		return &Schema{
+			Type:        []string{"integer", "string"},
+			Description: "A number, or an opaque string when public IDs are enabled",
+		}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}, nil
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: float(0)}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Pointer:
+		elem, err := s.schema(t.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		return nullable(elem), nil
+	case reflect.Slice, reflect.Array:
+		items, err := s.schema(t.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		schema := &Schema{Type: "array", Items: items}
+		if nilable && t.Kind() == reflect.Slice {
+			schema = nullable(schema)
+		}
+		return schema, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("unsupported map key type %s", t.Key())
+		}
+		values, err := s.schema(t.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		schema := &Schema{Type: "object", AdditionalProperties: values}
+		if nilable {
+			schema = nullable(schema)
+		}
+		return schema, nil
+	case reflect.Struct:
+		if t.Name() == "" {
+			schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+			return schema, s.addFields(schema, t)
+		}
+		return s.ref(t)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// nullable allows schema to be null as well
+func nullable(schema *Schema) *Schema {
+	switch t := schema.Type.(type) {
+	case string:
+		schema.Type = []string{t, "null"}
+		return schema
+	case []string:
+		schema.Type = append(t, "null")
+		return schema
+	}
+	return &Schema{OneOf: []*Schema{schema, {Type: "null"}}}
+}
+
+// constrain applies the gin binding tag of a field to its schema and
+// reports whether the field is required
+func constrain(schema *Schema, binding string) (bool, error) {
+	if binding == "" {
+		return false, nil
+	}
+
+	required := false
+	omitempty := false
+	for _, rule := range strings.Split(binding, ",") {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "omitempty":
+			omitempty = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return false, fmt.Errorf("binding %q: %w", rule, err)
+			}
+			limit(schema, name, n)
+		case "oneof":
+			for _, value := range strings.Fields(param) {
+				schema.Enum = append(schema.Enum, value)
+			}
+			if omitempty {
+				schema.Enum = append(schema.Enum, "")
+			}
+		case "url":
+			schema.Format = "uri"
+		default:
+			return false, fmt.Errorf("unsupported binding %q", rule)
+		}
+	}
+	return required, nil
+}
+
+// limit sets a min or max binding as the bound of a number or the length
+// of a string
+func limit(schema *Schema, bound string, n float64) {
+	if schema.Type == "string" {
+		length := int(n)
+		if bound == "min" {
+			schema.MinLength = &length
+		} else {
+			schema.MaxLength = &length
+		}
+		return
+	}
+	if bound == "min" {
+		schema.Minimum = float(n)
+	} else {
+		schema.Maximum = float(n)
+	}
+}
+
+func float(n float64) *float64 {
+	return &n
+}
@@ -0,0 +1,56 @@
+package openapi
+
+import (
+	"mentalartsapi/dto"
+	"mentalartsapi/importer"
+	"mentalartsapi/models"
+	"reflect"
+)
+
+// types are the request and response types the annotations may name,
+// keyed by their schema names. Types used only inside them, like
+// models.Review in models.Book, are found by reflection and need no entry.
+var types = typeMap(
+	dto.Response{},
+	dto.ErrorResponse{},
+	dto.AuthorList{},
+	dto.BookList{},
+	dto.WorkList{},
+	dto.PublisherList{},
+	dto.SeriesList{},
+	dto.ReviewList{},
+	dto.TenantList{},
+	dto.AuthorRequest{},
+	dto.BookRequest{},
+	dto.BookResponse{},
+	dto.SeriesRequest{},
+	dto.SeriesEntryRequest{},
+	dto.WorkRequest{},
+	dto.WorkResponse{},
+	dto.PublisherRequest{},
+	dto.ReviewRequest{},
+	dto.TenantRequest{},
+	dto.BatchRequest{},
+	dto.BatchResponse{},
+	dto.BulkRequest{},
+	dto.BulkDeleteRequest{},
+	dto.BulkResponse{},
+	models.Author{},
+	models.Book{},
+	models.Work{},
+	models.Publisher{},
+	models.Series{},
+	models.SeriesEntry{},
+	models.Review{},
+	models.Tenant{},
+	importer.Report{},
+)
+
+func typeMap(values ...interface{}) map[string]reflect.Type {
+	m := make(map[string]reflect.Type, len(values))
+	for _, value := range values {
+		t := reflect.TypeOf(value)
+		m[schemaName(t)] = t
+	}
+	return m
+}
@@ -0,0 +1,284 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mentalartsapi/dto"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// specURL names the spec for the schema compiler; schemas are compiled from
+// JSON pointers into it, so that their $refs to the components resolve
+const specURL = "openapi.json"
+
+var printer = message.NewPrinter(language.English)
+
+// Validator checks requests and JSON responses against an OpenAPI document.
+// Formats like date-time are annotations only, as JSON Schema specifies by
+// default; binding still checks what the handlers parse.
+type Validator struct {
+	operations map[string]*operation
+}
+
+type operation struct {
+	params       []*parameter
+	body         *jsonschema.Schema
+	bodyRequired bool
+	responses    map[int]*jsonschema.Schema
+}
+
+type parameter struct {
+	*Parameter
+	schema *jsonschema.Schema
+}
+
+// NewValidator compiles the schemas of every operation in spec
+func NewValidator(spec []byte) (*Validator, error) {
+	var doc Document
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	tree, err := jsonschema.UnmarshalJSON(bytes.NewReader(spec))
+	if err != nil {
+		return nil, err
+	}
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(specURL, tree); err != nil {
+		return nil, err
+	}
+	compile := func(tokens ...string) (*jsonschema.Schema, error) {
+		return compiler.Compile(specURL + "#" + pointer(tokens...))
+	}
+
+	v := &Validator{operations: map[string]*operation{}}
+	for path, item := range doc.Paths {
+		for method, op := range *item {
+			compiled := &operation{responses: map[int]*jsonschema.Schema{}}
+			for i, param := range op.Parameters {
+				schema, err := compile("paths", path, method, "parameters", strconv.Itoa(i), "schema")
+				if err != nil {
+					return nil, err
+				}
+				compiled.params = append(compiled.params, &parameter{param, schema})
+			}
+			if op.RequestBody != nil && op.RequestBody.Content["application/json"] != nil {
+				compiled.body, err = compile("paths", path, method, "requestBody", "content", "application/json", "schema")
+				if err != nil {
+					return nil, err
+				}
+				compiled.bodyRequired = op.RequestBody.Required
+			}
+			for code, response := range op.Responses {
+				status, err := strconv.Atoi(code)
+				if err != nil || response.Content["application/json"] == nil {
+					continue
+				}
+				compiled.responses[status], err = compile("paths", path, method, "responses", code, "content", "application/json", "schema")
+				if err != nil {
+					return nil, err
+				}
+			}
+			v.operations[strings.ToUpper(method)+" "+path] = compiled
+		}
+	}
+	return v, nil
+}
+
+// MustNewValidator is like NewValidator but panics if the spec is invalid
+func MustNewValidator(spec []byte) *Validator {
+	v, err := NewValidator(spec)
+	if err != nil {
+		panic(fmt.Sprintf("openapi: %v", err))
+	}
+	return v
+}
+
+// pointer builds a JSON pointer from unescaped tokens
+func pointer(tokens ...string) string {
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString("/")
+		b.WriteString(escaper.Replace(token))
+	}
+	return b.String()
+}
+
+// Documents reports whether the spec has an operation for method and path,
+// a path template like /api/v1/books/{id}
+func (v *Validator) Documents(method, path string) bool {
+	_, ok := v.operations[method+" "+path]
+	return ok
+}
+
+// ValidateRequest checks the parameters and the JSON body of a request to
+// the operation for method and path. pathParam returns the value of a path
+// parameter. Bodies in other media types are left to the handlers. The body
+// is read and replaced, so handlers can still read it.
+func (v *Validator) ValidateRequest(r *http.Request, method, path string, pathParam func(string) string) ([]dto.ErrorDetail, error) {
+	op, ok := v.operations[method+" "+path]
+	if !ok {
+		return nil, nil
+	}
+
+	var details []dto.ErrorDetail
+	query := r.URL.Query()
+	for _, param := range op.params {
+		var value string
+		var present bool
+		switch param.In {
+		case "path":
+			value = pathParam(param.Name)
+			present = true
+		case "query":
+			if values, ok := query[param.Name]; ok {
+				value, present = values[0], true
+			}
+		case "header":
+			value = r.Header.Get(param.Name)
+			present = value != ""
+		}
+
+		if !present {
+			if param.Required {
+				details = append(details, dto.ErrorDetail{In: param.In, Field: param.Name, Message: "is required"})
+			}
+			continue
+		}
+		if message := param.validate(value); message != "" {
+			details = append(details, dto.ErrorDetail{In: param.In, Field: param.Name, Message: message})
+		}
+	}
+
+	if op.body != nil && isJSON(r.Header.Get("Content-Type")) {
+		bodyDetails, err := validateBody(r, op)
+		if err != nil {
+			return nil, err
+		}
+		details = append(details, bodyDetails...)
+	}
+	return details, nil
+}
+
+// validate parses a parameter value as the type of its schema and checks
+// it against the schema
+func (p *parameter) validate(value string) string {
+	var instance interface{} = value
+	switch p.Schema.Type {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return "must be an integer"
+		}
+		instance = json.Number(value)
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "must be a number"
+		}
+		instance = json.Number(value)
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "must be a boolean"
+		}
+		instance = b
+	}
+	if details := schemaDetails(p.schema.Validate(instance), p.In); len(details) > 0 {
+		return details[0].Message
+	}
+	return ""
+}
+
+func validateBody(r *http.Request, op *operation) ([]dto.ErrorDetail, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.bodyRequired {
+			return []dto.ErrorDetail{{In: "body", Message: "is required"}}, nil
+		}
+		return nil, nil
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return []dto.ErrorDetail{{In: "body", Message: "is not valid JSON: " + err.Error()}}, nil
+	}
+	return schemaDetails(op.body.Validate(instance), "body"), nil
+}
+
+// ValidateResponse checks a JSON response of the operation for method and
+// path. Statuses the operation does not document are reported too.
+func (v *Validator) ValidateResponse(method, path string, status int, body []byte) []dto.ErrorDetail {
+	op, ok := v.operations[method+" "+path]
+	if !ok {
+		return nil
+	}
+	schema, ok := op.responses[status]
+	if !ok {
+		return []dto.ErrorDetail{{In: "response", Message: fmt.Sprintf("status %d is not documented", status)}}
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+	if err != nil {
+		return []dto.ErrorDetail{{In: "response", Message: "is not valid JSON: " + err.Error()}}
+	}
+	return schemaDetails(schema.Validate(instance), "response")
+}
+
+// schemaDetails turns the leaf errors of a schema validation into details,
+// naming fields by their dotted path in the instance
+func schemaDetails(err error, in string) []dto.ErrorDetail {
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []dto.ErrorDetail{{In: in, Message: err.Error()}}
+	}
+	return appendLeafDetails(nil, validationErr, in)
+}
+
+func appendLeafDetails(details []dto.ErrorDetail, err *jsonschema.ValidationError, in string) []dto.ErrorDetail {
+	if required, ok := err.ErrorKind.(*kind.Required); ok {
+		for _, name := range required.Missing {
+			field := strings.Join(append(err.InstanceLocation[:len(err.InstanceLocation):len(err.InstanceLocation)], name), ".")
+			details = append(details, dto.ErrorDetail{In: in, Field: field, Message: "is required"})
+		}
+		return details
+	}
+	if len(err.Causes) == 0 {
+		return append(details, dto.ErrorDetail{
+			In:      in,
+			Field:   strings.Join(err.InstanceLocation, "."),
+			Message: err.ErrorKind.LocalizedString(printer),
+		})
+	}
+	for _, cause := range err.Causes {
+		details = appendLeafDetails(details, cause, in)
+	}
+	return details
+}
+
+// isJSON reports whether a request Content-Type is JSON. Requests without
+// one are read as JSON, like content.Bind does.
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
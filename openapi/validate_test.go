@@ -0,0 +1,80 @@
+package openapi
+
+import (
+	"mentalartsapi/docs"
+	"mentalartsapi/dto"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestValidateRequest(t *testing.T) {
+	validator := MustNewValidator(docs.OpenAPI)
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		path        string
+		contentType string
+		body        string
+		want        []dto.ErrorDetail
+	}{
+		{
+			name: "valid", method: http.MethodPost, target: "/api/v1/books", path: "/api/v1/books",
+			body: `{"title": "Kindred", "isbn": "9780807083697", "author_id": 1}`,
+		},
+		{
+			name: "missing fields", method: http.MethodPost, target: "/api/v1/books", path: "/api/v1/books",
+			body: `{"title": "Kindred"}`,
+			want: []dto.ErrorDetail{
+				{In: "body", Field: "isbn", Message: "is required"},
+				{In: "body", Field: "author_id", Message: "is required"},
+			},
+		},
+		{
+			name: "wrong types", method: http.MethodPost, target: "/api/v1/books", path: "/api/v1/books",
+			body: `{"title": 1, "isbn": "9780807083697", "author_id": 1, "page_count": -1}`,
+			want: []dto.ErrorDetail{
+				{In: "body", Field: "title", Message: "got number, want string"},
+				{In: "body", Field: "page_count", Message: "minimum: got -1, want 0"},
+			},
+		},
+		{
+			name: "missing body", method: http.MethodPost, target: "/api/v1/books", path: "/api/v1/books",
+			want: []dto.ErrorDetail{{In: "body", Message: "is required"}},
+		},
+		{
+			name: "malformed body", method: http.MethodPost, target: "/api/v1/books", path: "/api/v1/books",
+			body: `{"title":`,
+			want: []dto.ErrorDetail{{In: "body", Message: "is not valid JSON: unexpected EOF"}},
+		},
+		{
+			name: "other media type", method: http.MethodPost, target: "/api/v1/books", path: "/api/v1/books",
+			contentType: "application/xml", body: `<book/>`,
+		},
+		{
+			name: "query", method: http.MethodGet, target: "/api/v1/books?page=first&page_size=10", path: "/api/v1/books",
+			want: []dto.ErrorDetail{{In: "query", Field: "page", Message: "must be an integer"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			details, err := validator.ValidateRequest(r, tt.method, tt.path, func(string) string { return "" })
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Details of different properties come in no particular order
+			sort.SliceStable(details, func(i, j int) bool { return details[i].Field > details[j].Field })
+			if !reflect.DeepEqual(details, tt.want) {
+				t.Errorf("details = %+v, want %+v", details, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// clock is a time that tests move by hand
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time {
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newTestMemoryStore() (*MemoryStore, *clock) {
+	c := &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	s := NewMemoryStore()
+	s.now = c.now
+	s.lastSweep = c.t
+	return s, c
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	s, c := newTestMemoryStore()
+	ctx := context.Background()
+	limit := Limit{Requests: 2, Period: 2 * time.Second}
+
+	for i, want := range []bool{true, true, false} {
+		result, err := s.Take(ctx, "a", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Allowed != want {
+			t.Fatalf("request %d allowed = %v, want %v", i, result.Allowed, want)
+		}
+	}
+	if result, _ := s.Take(ctx, "b", limit); !result.Allowed {
+		t.Fatal("another key shares the bucket")
+	}
+
+	c.advance(time.Second)
+	if result, _ := s.Take(ctx, "a", limit); !result.Allowed {
+		t.Fatal("request earned back not allowed")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	s, c := newTestMemoryStore()
+	ctx := context.Background()
+	short := Limit{Requests: 1, Period: time.Second}
+	long := Limit{Requests: 1, Period: time.Hour}
+
+	s.Take(ctx, "short", short)
+	s.Take(ctx, "long", long)
+
+	// Before the sweep interval nothing is forgotten, even full buckets
+	c.advance(sweepInterval / 2)
+	s.Take(ctx, "other", short)
+	if _, ok := s.buckets["short"]; !ok {
+		t.Fatal("bucket forgotten before the sweep interval")
+	}
+
+	c.advance(sweepInterval)
+	s.Take(ctx, "other", short)
+	if _, ok := s.buckets["short"]; ok {
+		t.Error("full bucket not forgotten")
+	}
+	if _, ok := s.buckets["long"]; !ok {
+		t.Error("bucket still filling up forgotten")
+	}
+
+	// The bucket still filling up keeps its state
+	if result, _ := s.Take(ctx, "long", long); result.Allowed {
+		t.Error("bucket swept too early lets the client in again")
+	}
+}
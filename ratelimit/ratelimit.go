@@ -0,0 +1,112 @@
+// Package ratelimit limits how often each client may call the API with
+// token buckets, kept in memory for a single instance or in a store shared
+// by a cluster.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Period. Clients may spend all of them at once,
+// after which they get one more every Period/Requests.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// ParseLimit parses a limit like 300/1m, or off for no limit
+func ParseLimit(s string) (Limit, error) {
+	if s == "off" {
+		return Limit{}, nil
+	}
+	requests, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("limit %q is not requests/period, e.g. 300/1m", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("limit %q must allow a positive number of requests", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("limit %q must have a positive period, e.g. 1m", s)
+	}
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// Off reports whether the limit allows any number of requests
+func (l Limit) Off() bool {
+	return l.Requests == 0
+}
+
+// interval returns the time it takes to earn one request back
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+func (l Limit) String() string {
+	if l.Off() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler with ParseLimit
+func (l *Limit) UnmarshalText(text []byte) error {
+	limit, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = limit
+	return nil
+}
+
+// Result is the state of a bucket after taking a request from it
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, when this
+	// one was not
+	RetryAfter time.Duration
+}
+
+// Store keeps the buckets of the clients. Take takes a request from the
+// bucket under key, filling it first with the requests earned since it was
+// last used.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// take updates a bucket holding tokens at last, at time now, and returns
+// its new state. Tokens are counted in fractions of a request.
+func take(tokens float64, last, now time.Time, limit Limit) (float64, Result) {
+	capacity := float64(limit.Requests)
+	if elapsed := now.Sub(last); elapsed > 0 {
+		tokens += float64(elapsed) / float64(limit.interval())
+	}
+	if tokens > capacity {
+		tokens = capacity
+	}
+
+	var result Result
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - tokens) * float64(limit.interval()))
+	}
+	result.Remaining = int(tokens)
+	result.Reset = time.Duration((capacity - tokens) * float64(limit.interval()))
+	return tokens, result
+}
@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{in: "300/1m", want: Limit{Requests: 300, Period: time.Minute}},
+		{in: "off", want: Limit{}},
+		{in: "300", wantErr: true},
+		{in: "0/1m", wantErr: true},
+		{in: "-1/1m", wantErr: true},
+		{in: "10/0s", wantErr: true},
+		{in: "10/soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLimit(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("limit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTake(t *testing.T) {
+	// One request is earned back every 6s
+	limit := Limit{Requests: 10, Period: time.Minute}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		wantTokens float64
+		want       Result
+	}{
+		{
+			name:       "full bucket",
+			tokens:     10,
+			wantTokens: 9,
+			want:       Result{Allowed: true, Remaining: 9, Reset: 6 * time.Second},
+		},
+		{
+			name:       "last request of a burst",
+			tokens:     1,
+			wantTokens: 0,
+			want:       Result{Allowed: true, Remaining: 0, Reset: time.Minute},
+		},
+		{
+			name:       "empty bucket",
+			tokens:     0,
+			wantTokens: 0,
+			want:       Result{Remaining: 0, Reset: time.Minute, RetryAfter: 6 * time.Second},
+		},
+		{
+			name:       "empty bucket part way to a request",
+			tokens:     0,
+			elapsed:    2 * time.Second,
+			wantTokens: 1.0 / 3,
+			want:       Result{Remaining: 0, Reset: 58 * time.Second, RetryAfter: 4 * time.Second},
+		},
+		{
+			name:       "empty bucket earning a request",
+			tokens:     0,
+			elapsed:    6 * time.Second,
+			wantTokens: 0,
+			want:       Result{Allowed: true, Remaining: 0, Reset: time.Minute},
+		},
+		{
+			name:       "refill",
+			tokens:     2,
+			elapsed:    30 * time.Second,
+			wantTokens: 6,
+			want:       Result{Allowed: true, Remaining: 6, Reset: 24 * time.Second},
+		},
+		{
+			name:       "refill stops at the limit",
+			tokens:     2,
+			elapsed:    time.Hour,
+			wantTokens: 9,
+			want:       Result{Allowed: true, Remaining: 9, Reset: 6 * time.Second},
+		},
+		{
+			name:       "clock going backwards",
+			tokens:     5,
+			elapsed:    -time.Minute,
+			wantTokens: 4,
+			want:       Result{Allowed: true, Remaining: 4, Reset: 36 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, got := take(tt.tokens, start, start.Add(tt.elapsed), limit)
+			if !near(tokens, tt.wantTokens) {
+				t.Errorf("tokens = %v, want %v", tokens, tt.wantTokens)
+			}
+			if got.Allowed != tt.want.Allowed || got.Remaining != tt.want.Remaining ||
+				!nearDuration(got.Reset, tt.want.Reset) || !nearDuration(got.RetryAfter, tt.want.RetryAfter) {
+				t.Errorf("result = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestTakeBurst spends a bucket at once and then at the rate it refills
+func TestTakeBurst(t *testing.T) {
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tokens, last := float64(limit.Requests), now
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		var result Result
+		tokens, result = take(tokens, last, now, limit)
+		if result.Allowed {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Fatalf("%d requests of a burst allowed, want 3", allowed)
+	}
+
+	for i := 0; i < 10; i++ {
+		next := now.Add(time.Second)
+		var result Result
+		tokens, result = take(tokens, now, next, limit)
+		now = next
+		if !result.Allowed {
+			t.Fatalf("request %d at the refill rate not allowed: %+v", i, result)
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	return a-b < 1e-9 && b-a < 1e-9
+}
+
+func nearDuration(a, b time.Duration) bool {
+	return (a - b).Abs() < time.Microsecond
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript runs take in Redis, atomically, on a hash holding the tokens
+// and the time they were counted in microseconds. Time comes from the Redis
+// server, so that instances with skewed clocks share buckets fairly. The
+// bucket expires once it would be full again.
+//
+// KEYS[1] bucket, ARGV[1] requests, ARGV[2] period in microseconds.
+// Returns allowed, remaining, reset and retry after in microseconds.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2]) / capacity
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or capacity
+local last = tonumber(state[2]) or now
+if now > last then
+  tokens = math.min(capacity, tokens + (now - last) / interval)
+end
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) * interval)
+end
+local reset = math.ceil((capacity - tokens) * interval)
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], math.max(1, math.ceil(reset / 1000)))
+return {allowed, math.floor(tokens), reset, retry}
+`)
+
+// RedisStore keeps the buckets in Redis, or any server speaking its
+// protocol and running Lua scripts, so that all instances of the API share
+// them
+type RedisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisStore returns a store keeping the buckets under keys starting
+// with prefix
+func NewRedisStore(client redis.Scripter, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Take implements Store
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	values, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		limit.Requests, limit.Period.Microseconds()).Int64Slice()
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		Reset:      time.Duration(values[2]) * time.Microsecond,
+		RetryAfter: time.Duration(values[3]) * time.Microsecond,
+	}, nil
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"mentalartsapi/cache"
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"mentalartsapi/metrics"
+	"mentalartsapi/models"
+	"mentalartsapi/utils"
+
+	"gorm.io/gorm"
+)
+
+// CreateAuthor creates an author
+func CreateAuthor(db *gorm.DB, request dto.AuthorRequest) (models.Author, error) {
+	var author models.Author
+	if err := validate(request); err != nil {
+		return author, err
+	}
+
+	applyAuthorRequest(&author, request)
+	if err := db.Create(&author).Error; err != nil {
+		return author, err
+	}
+	metrics.Add(db.Statement.Context, metrics.AuthorsCreated, 1)
+	invalidateAuthor(db, author.ID)
+	return author, nil
+}
+
+// ListAuthors returns a page of authors and the total number of authors
+func ListAuthors(db *gorm.DB, pagination dto.PaginationQuery) ([]models.Author, int64, error) {
+	var authors []models.Author
+	var total int64
+	if err := db.Model(&models.Author{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := utils.Paginate(db, &pagination).Order("id").Find(&authors).Error; err != nil {
+		return nil, 0, err
+	}
+	return authors, total, nil
+}
+
+// GetAuthor returns an author with their first books
+func GetAuthor(db *gorm.DB, id ids.ID) (models.Author, error) {
+	var author models.Author
+	if err := utils.PreloadLimited(db, "Books", &models.Book{}, "author_id", "id", utils.DefaultIncludeLimit).
+		First(&author, id).Error; err != nil {
+		return author, LookupError(err, "author")
+	}
+	return author, nil
+}
+
+// UpdateAuthor replaces the details of an author
+func UpdateAuthor(db *gorm.DB, id ids.ID, request dto.AuthorRequest) (models.Author, error) {
+	var author models.Author
+	if err := validate(request); err != nil {
+		return author, err
+	}
+	if err := db.First(&author, id).Error; err != nil {
+		return author, LookupError(err, "author")
+	}
+
+	applyAuthorRequest(&author, request)
+	if err := db.Save(&author).Error; err != nil {
+		return author, err
+	}
+	invalidateAuthor(db, author.ID)
+	return author, nil
+}
+
+// DeleteAuthor deletes an author
+func DeleteAuthor(db *gorm.DB, id ids.ID) error {
+	var author models.Author
+	if err := db.First(&author, id).Error; err != nil {
+		return LookupError(err, "author")
+	}
+	if err := db.Delete(&author).Error; err != nil {
+		return err
+	}
+	invalidateAuthor(db, author.ID)
+	return nil
+}
+
+// invalidateAuthor drops the cached responses showing an author and the
+// author lists
+func invalidateAuthor(db *gorm.DB, id ids.ID) {
+	cache.Invalidate(db.Statement.Context, "authors", cache.Row("authors", id))
+}
+
+func applyAuthorRequest(author *models.Author, request dto.AuthorRequest) {
+	author.Name = request.Name
+	author.Biography = request.Biography
+	author.BirthDate = request.BirthDate
+}
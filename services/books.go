@@ -0,0 +1,503 @@
+package services
+
+import (
+	"mentalartsapi/cache"
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"mentalartsapi/metrics"
+	"mentalartsapi/models"
+	"mentalartsapi/utils"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateBook creates an edition. Without a work ID a new work is started
+// from the edition's title, description and author.
+func CreateBook(db *gorm.DB, request dto.BookRequest) (models.Book, error) {
+	var book models.Book
+	if err := validate(request); err != nil {
+		return book, err
+	}
+	if err := checkEditionRelations(db, request); err != nil {
+		return book, err
+	}
+
+	applyBookRequest(&book, request)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Start a new work unless the edition belongs to an existing one
+		if book.WorkID == 0 {
+			work := models.Work{
+				Title:       request.Title,
+				Description: request.Description,
+				AuthorID:    request.AuthorID,
+			}
+			if err := tx.Create(&work).Error; err != nil {
+				return err
+			}
+			book.WorkID = work.ID
+		}
+		return tx.Create(&book).Error
+	})
+	if err != nil {
+		return book, err
+	}
+	metrics.Add(db.Statement.Context, metrics.BooksCreated, 1)
+	invalidateBooks(db, book)
+
+	// Load relations for response
+	db.Preload("Author").Preload("Publisher").First(&book, book.ID)
+	return book, nil
+}
+
+// ListBooks returns a page of the books matching the filters, with their
+// authors, and the total number of matches
+func ListBooks(db *gorm.DB, filters dto.BookFilterQuery, pagination dto.PaginationQuery) ([]models.Book, int64, error) {
+	var books []models.Book
+	var total int64
+	if err := validate(filters); err != nil {
+		return nil, 0, err
+	}
+	if err := utils.FilterBooks(db.Model(&models.Book{}), filters).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := utils.Paginate(utils.FilterBooks(db, filters), &pagination).
+		Preload("Author").
+		Order("books.id").
+		Find(&books).Error; err != nil {
+		return nil, 0, err
+	}
+	return books, total, nil
+}
+
+// GetBook returns an edition with its author and publisher, the other
+// editions of its work, the most recent reviews of the work and its rating
+func GetBook(db *gorm.DB, id ids.ID) (dto.BookResponse, error) {
+	var response dto.BookResponse
+	if err := db.Preload("Author").Preload("Publisher").First(&response.Book, id).Error; err != nil {
+		return response, LookupError(err, "book")
+	}
+	book := response.Book
+
+	if err := db.Where("work_id = ?", book.WorkID).
+		Order("date_posted DESC, id DESC").
+		Limit(utils.DefaultIncludeLimit).
+		Find(&response.Reviews).Error; err != nil {
+		return response, err
+	}
+
+	if err := db.Preload("Publisher").
+		Where("work_id = ? AND id <> ?", book.WorkID, book.ID).
+		Order("publication_year, edition_number, id").
+		Limit(utils.DefaultIncludeLimit).
+		Find(&response.Editions).Error; err != nil {
+		return response, err
+	}
+
+	rating, err := WorkRating(db, book.WorkID)
+	if err != nil {
+		return response, err
+	}
+	response.Rating = rating
+	return response, nil
+}
+
+// UpdateBook replaces the details of an edition. Without a work ID the
+// edition stays in its current work.
+func UpdateBook(db *gorm.DB, id ids.ID, request dto.BookRequest) (models.Book, error) {
+	var book models.Book
+	if err := db.First(&book, id).Error; err != nil {
+		return book, LookupError(err, "book")
+	}
+	if err := validate(request); err != nil {
+		return book, err
+	}
+
+	if request.WorkID == 0 {
+		request.WorkID = book.WorkID
+	}
+	if err := checkEditionRelations(db, request); err != nil {
+		return book, err
+	}
+
+	applyBookRequest(&book, request)
+	if err := db.Save(&book).Error; err != nil {
+		return book, err
+	}
+	invalidateBooks(db, book)
+
+	// Load relations for response
+	db.Preload("Author").Preload("Publisher").First(&book, book.ID)
+	return book, nil
+}
+
+// DeleteBook deletes an edition and removes it from any series
+func DeleteBook(db *gorm.DB, id ids.ID) error {
+	var book models.Book
+	if err := db.First(&book, id).Error; err != nil {
+		return LookupError(err, "book")
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// A deleted book leaves a gap in any series it belonged to
+		if err := tx.Unscoped().Where("book_id = ?", book.ID).Delete(&models.SeriesEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&book).Error
+	})
+	if err != nil {
+		return err
+	}
+	invalidateBooks(db, book)
+	return nil
+}
+
+// invalidateBooks drops the cached responses showing the books, the book
+// lists and the books of their authors and works
+func invalidateBooks(db *gorm.DB, books ...models.Book) {
+	tags := []string{"books"}
+	for _, book := range books {
+		tags = append(tags,
+			cache.Row("books", book.ID),
+			cache.Children("authors", book.AuthorID, "books"),
+			cache.Children("works", book.WorkID, "books"))
+	}
+	cache.Invalidate(db.Statement.Context, tags...)
+}
+
+// applyBookRequest copies the edition details of a request onto a book
+func applyBookRequest(book *models.Book, request dto.BookRequest) {
+	book.Title = request.Title
+	book.ISBN = request.ISBN
+	book.PublicationYear = request.PublicationYear
+	book.Description = request.Description
+	book.Format = request.Format
+	book.Language = request.Language
+	book.PageCount = request.PageCount
+	book.EditionNumber = request.EditionNumber
+	book.AuthorID = request.AuthorID
+	book.WorkID = request.WorkID
+	book.PublisherID = request.PublisherID
+	book.Publisher = nil
+}
+
+// checkEditionRelations validates the author, work and publisher referenced
+// by a book request
+func checkEditionRelations(db *gorm.DB, request dto.BookRequest) error {
+	if err := db.First(&models.Author{}, request.AuthorID).Error; err != nil {
+		return referenceError(err, "author")
+	}
+
+	if request.WorkID != 0 {
+		var work models.Work
+		if err := db.First(&work, request.WorkID).Error; err != nil {
+			return referenceError(err, "work")
+		}
+		if work.AuthorID != request.AuthorID {
+			return invalid("author does not match the author of the work")
+		}
+	}
+
+	if request.PublisherID != nil {
+		if err := db.First(&models.Publisher{}, *request.PublisherID).Error; err != nil {
+			return referenceError(err, "publisher")
+		}
+	}
+
+	return nil
+}
+
+// bookUpdateColumns are the columns a bulk update writes
+var bookUpdateColumns = []string{"title", "isbn", "publication_year", "description", "format", "language",
+	"page_count", "edition_number", "author_id", "work_id", "publisher_id", "updated_at"}
+
+// BulkCreateBooks creates editions like CreateBook does. The items are
+// checked with a few queries for all of them and the works and books are
+// inserted in batches.
+func BulkCreateBooks(db *gorm.DB, request dto.BulkRequest) (dto.BulkResponse, error) {
+	b, err := newBulk(request.Mode, len(request.Items))
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	requests := make([]dto.BookRequest, len(request.Items))
+	for i, item := range request.Items {
+		b.decode(i, item, &requests[i])
+	}
+	if err := checkBookRequests(db, b, requests, make([]ids.ID, len(requests))); err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	indexes := b.writable()
+	if len(indexes) == 0 {
+		return b.response(), nil
+	}
+
+	books := make([]models.Book, len(indexes))
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Start a work for every edition that doesn't belong to one
+		var works []models.Work
+		var workOf []int
+		for k, i := range indexes {
+			applyBookRequest(&books[k], requests[i])
+			if books[k].WorkID == 0 {
+				works = append(works, models.Work{
+					Title:       requests[i].Title,
+					Description: requests[i].Description,
+					AuthorID:    requests[i].AuthorID,
+				})
+				workOf = append(workOf, k)
+			}
+		}
+		if len(works) > 0 {
+			if err := tx.CreateInBatches(&works, bulkBatchSize).Error; err != nil {
+				return err
+			}
+			for j, k := range workOf {
+				books[k].WorkID = works[j].ID
+			}
+		}
+		return tx.Omit(clause.Associations).CreateInBatches(&books, bulkBatchSize).Error
+	})
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	for k, i := range indexes {
+		b.succeed(i, http.StatusCreated, books[k].ID)
+	}
+	metrics.Add(db.Statement.Context, metrics.BooksCreated, float64(len(books)))
+	invalidateBooks(db, books...)
+	return b.response(), nil
+}
+
+// BulkUpdateBooks replaces the details of editions like UpdateBook does,
+// writing them with batched upserts on the primary key
+func BulkUpdateBooks(db *gorm.DB, request dto.BulkRequest) (dto.BulkResponse, error) {
+	b, err := newBulk(request.Mode, len(request.Items))
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	items := make([]dto.BookUpdateItem, len(request.Items))
+	keys := make([]string, len(items))
+	for i, item := range request.Items {
+		if b.decode(i, item, &items[i]) {
+			keys[i] = items[i].ID.String()
+		}
+	}
+	b.failDuplicates(keys, "id")
+
+	current, err := loadBooks(db, b, itemIDs(b, items, func(item dto.BookUpdateItem) ids.ID { return item.ID }))
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	requests := make([]dto.BookRequest, len(items))
+	bookIDs := make([]ids.ID, len(items))
+	for i, item := range items {
+		requests[i] = item.BookRequest
+		bookIDs[i] = item.ID
+		// Without a work ID the edition stays in its current work
+		if book, ok := current[item.ID]; ok && requests[i].WorkID == 0 {
+			requests[i].WorkID = book.WorkID
+		}
+	}
+	if err := checkBookRequests(db, b, requests, bookIDs); err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	indexes := b.writable()
+	if len(indexes) == 0 {
+		return b.response(), nil
+	}
+
+	now := time.Now()
+	books := make([]models.Book, len(indexes))
+	for k, i := range indexes {
+		books[k] = current[items[i].ID]
+		applyBookRequest(&books[k], requests[i])
+		books[k].UpdatedAt = now
+	}
+	err = db.Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns(bookUpdateColumns),
+	}).CreateInBatches(&books, bulkBatchSize).Error
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	for _, i := range indexes {
+		b.succeed(i, http.StatusOK, items[i].ID)
+	}
+	invalidateBooks(db, books...)
+	return b.response(), nil
+}
+
+// BulkDeleteBooks deletes editions like DeleteBook does, in one statement
+func BulkDeleteBooks(db *gorm.DB, request dto.BulkDeleteRequest) (dto.BulkResponse, error) {
+	b, err := newBulk(request.Mode, len(request.IDs))
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	keys := make([]string, len(request.IDs))
+	for i, id := range request.IDs {
+		keys[i] = id.String()
+	}
+	b.failDuplicates(keys, "id")
+	current, err := loadBooks(db, b, request.IDs)
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	indexes := b.writable()
+	if len(indexes) == 0 {
+		return b.response(), nil
+	}
+
+	bookIDs := make([]ids.ID, len(indexes))
+	books := make([]models.Book, len(indexes))
+	for k, i := range indexes {
+		bookIDs[k] = request.IDs[i]
+		books[k] = current[request.IDs[i]]
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Deleted books leave gaps in any series they belonged to
+		if err := tx.Unscoped().Where("book_id IN ?", bookIDs).Delete(&models.SeriesEntry{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", bookIDs).Delete(&models.Book{}).Error
+	})
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	for _, i := range indexes {
+		b.succeed(i, http.StatusOK, request.IDs[i])
+	}
+	invalidateBooks(db, books...)
+	return b.response(), nil
+}
+
+// loadBooks loads the books with the given IDs, one per item, and fails
+// the items whose book doesn't exist. Failed items have a zero ID.
+func loadBooks(db *gorm.DB, b *bulk, bookIDs []ids.ID) (map[ids.ID]models.Book, error) {
+	var books []models.Book
+	if err := db.Where("id IN ?", bookIDs).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	found := make(map[ids.ID]models.Book, len(books))
+	for _, book := range books {
+		found[book.ID] = book
+	}
+	for i, id := range bookIDs {
+		if _, ok := found[id]; !ok && !b.failed(i) {
+			b.fail(i, notFound("book"))
+		}
+	}
+	return found, nil
+}
+
+// checkBookRequests checks the relations and ISBNs of the valid items of a
+// bulk request, with one query per kind of record. bookIDs are the books
+// the items update, zero for new books.
+func checkBookRequests(db *gorm.DB, b *bulk, requests []dto.BookRequest, bookIDs []ids.ID) error {
+	var authorIDs, workIDs, publisherIDs []ids.ID
+	isbns := make([]string, len(requests))
+	for i, request := range requests {
+		if b.failed(i) {
+			continue
+		}
+		authorIDs = append(authorIDs, request.AuthorID)
+		if request.WorkID != 0 {
+			workIDs = append(workIDs, request.WorkID)
+		}
+		if request.PublisherID != nil {
+			publisherIDs = append(publisherIDs, *request.PublisherID)
+		}
+		isbns[i] = request.ISBN
+	}
+
+	var authors []ids.ID
+	if err := db.Model(&models.Author{}).Where("id IN ?", authorIDs).Pluck("id", &authors).Error; err != nil {
+		return err
+	}
+	var works []models.Work
+	if err := db.Where("id IN ?", workIDs).Find(&works).Error; err != nil {
+		return err
+	}
+	var publishers []ids.ID
+	if err := db.Model(&models.Publisher{}).Where("id IN ?", publisherIDs).Pluck("id", &publishers).Error; err != nil {
+		return err
+	}
+	// Deleted books keep their ISBNs, which stay unique
+	var taken []models.Book
+	if err := db.Unscoped().Select("id", "isbn").Where("isbn IN ?", isbns).Find(&taken).Error; err != nil {
+		return err
+	}
+
+	authorSet := idSet(authors)
+	publisherSet := idSet(publishers)
+	workAuthors := make(map[ids.ID]ids.ID, len(works))
+	for _, work := range works {
+		workAuthors[work.ID] = work.AuthorID
+	}
+	isbnOwners := make(map[string]ids.ID, len(taken))
+	for _, book := range taken {
+		isbnOwners[book.ISBN] = book.ID
+	}
+
+	b.failDuplicates(isbns, "isbn")
+	for i, request := range requests {
+		if b.failed(i) {
+			continue
+		}
+		if !authorSet[request.AuthorID] {
+			b.fail(i, invalid("author not found"))
+			continue
+		}
+		if request.WorkID != 0 {
+			workAuthor, ok := workAuthors[request.WorkID]
+			if !ok {
+				b.fail(i, invalid("work not found"))
+				continue
+			}
+			if workAuthor != request.AuthorID {
+				b.fail(i, invalid("author does not match the author of the work"))
+				continue
+			}
+		}
+		if request.PublisherID != nil && !publisherSet[*request.PublisherID] {
+			b.fail(i, invalid("publisher not found"))
+			continue
+		}
+		if owner, ok := isbnOwners[request.ISBN]; ok && owner != bookIDs[i] {
+			b.fail(i, invalid("isbn is already used by another book"))
+		}
+	}
+	return nil
+}
+
+// itemIDs returns the ID of each item of a bulk request, zero for the items
+// that failed to decode
+func itemIDs[T any](b *bulk, items []T, id func(T) ids.ID) []ids.ID {
+	result := make([]ids.ID, len(items))
+	for i, item := range items {
+		if !b.failed(i) {
+			result[i] = id(item)
+		}
+	}
+	return result
+}
+
+func idSet(list []ids.ID) map[ids.ID]bool {
+	set := make(map[ids.ID]bool, len(list))
+	for _, id := range list {
+		set[id] = true
+	}
+	return set
+}
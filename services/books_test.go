@@ -0,0 +1,160 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"mentalartsapi/models"
+	"net/http"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a database of its own
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Author{}, &models.Publisher{}, &models.Work{}, &models.Book{},
+		&models.Series{}, &models.SeriesEntry{}, &models.Review{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createBook(t *testing.T, db *gorm.DB, title, isbn string, authorID ids.ID) models.Book {
+	t.Helper()
+	book, err := CreateBook(db, dto.BookRequest{Title: title, ISBN: isbn, AuthorID: authorID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return book
+}
+
+func bulkItems(items ...string) []json.RawMessage {
+	raw := make([]json.RawMessage, len(items))
+	for i, item := range items {
+		raw[i] = json.RawMessage(item)
+	}
+	return raw
+}
+
+func checkResults(t *testing.T, response dto.BulkResponse, want []dto.BulkResult) {
+	t.Helper()
+	if len(response.Results) != len(want) {
+		t.Fatalf("%d results, want %d: %+v", len(response.Results), len(want), response.Results)
+	}
+	for i, result := range response.Results {
+		if result.Status != want[i].Status || result.Error != want[i].Error {
+			t.Errorf("item %d = %d %q, want %d %q", i, result.Status, result.Error, want[i].Status, want[i].Error)
+		}
+	}
+}
+
+func TestBulkCreateBooksConflicts(t *testing.T) {
+	db := testDB(t)
+	author := models.Author{Name: "Ursula K. Le Guin"}
+	db.Create(&author)
+	createBook(t, db, "The Dispossessed", "9780061054884", author.ID)
+	deleted := createBook(t, db, "The Lathe of Heaven", "9781416556961", author.ID)
+	if err := DeleteBook(db, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	item := func(title, isbn string, authorID ids.ID) string {
+		return fmt.Sprintf(`{"title": %q, "isbn": %q, "author_id": %d}`, title, isbn, authorID)
+	}
+	items := bulkItems(
+		item("A Wizard of Earthsea", "9780547773742", author.ID),
+		item("The Tombs of Atuan", "9780547773742", author.ID),
+		item("The Dispossessed", "9780061054884", author.ID),
+		item("The Lathe of Heaven", "9781416556961", author.ID),
+		item("Kindred", "9780807083697", author.ID+1),
+		`{"title": "Tehanu"}`,
+	)
+	failures := []dto.BulkResult{
+		{Status: http.StatusBadRequest, Error: "isbn appears in more than one item"},
+		{Status: http.StatusBadRequest, Error: "isbn is already used by another book"},
+		{Status: http.StatusBadRequest, Error: "isbn is already used by another book"},
+		{Status: http.StatusBadRequest, Error: "author not found"},
+		{Status: http.StatusBadRequest},
+	}
+
+	// Atomic requests write nothing when an item fails
+	response, err := BulkCreateBooks(db, dto.BulkRequest{Items: items})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failures[4].Error = response.Results[5].Error
+	checkResults(t, response, append([]dto.BulkResult{{Status: http.StatusFailedDependency, Error: "not written because another item failed"}}, failures...))
+	var count int64
+	db.Model(&models.Book{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("%d books after a failed atomic request, want 1", count)
+	}
+
+	response, err = BulkCreateBooks(db, dto.BulkRequest{Mode: BulkPartial, Items: items})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResults(t, response, append([]dto.BulkResult{{Status: http.StatusCreated}}, failures...))
+	if response.Succeeded != 1 || response.Failed != 5 {
+		t.Errorf("succeeded = %d, failed = %d, want 1 and 5", response.Succeeded, response.Failed)
+	}
+	var created models.Book
+	if err := db.First(&created, response.Results[0].ID).Error; err != nil || created.Title != "A Wizard of Earthsea" || created.WorkID == 0 {
+		t.Errorf("created book = %+v, %v", created, err)
+	}
+}
+
+// TestBulkUpdateBooksUpsert updates existing books in place, and never
+// inserts, when some items conflict
+func TestBulkUpdateBooksUpsert(t *testing.T) {
+	db := testDB(t)
+	author := models.Author{Name: "Octavia E. Butler"}
+	db.Create(&author)
+	kindred := createBook(t, db, "Kindred", "9780807083697", author.ID)
+	dawn := createBook(t, db, "Dawn", "9780446603775", author.ID)
+	wildSeed := createBook(t, db, "Wild Seed", "9780446606721", author.ID)
+
+	item := func(id ids.ID, title, isbn string) string {
+		return fmt.Sprintf(`{"id": %d, "title": %q, "isbn": %q, "author_id": %d}`, id, title, isbn, author.ID)
+	}
+	response, err := BulkUpdateBooks(db, dto.BulkRequest{Mode: BulkPartial, Items: bulkItems(
+		item(kindred.ID, "Kindred: A Graphic Novel", kindred.ISBN),
+		item(dawn.ID, "Dawn", wildSeed.ISBN),
+		item(kindred.ID, "Kindred", kindred.ISBN),
+		item(99, "Adulthood Rites", "9780446603782"),
+	)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResults(t, response, []dto.BulkResult{
+		{Status: http.StatusOK},
+		{Status: http.StatusBadRequest, Error: "isbn is already used by another book"},
+		{Status: http.StatusBadRequest, Error: "id appears in more than one item"},
+		{Status: http.StatusNotFound, Error: "book not found"},
+	})
+
+	var books []models.Book
+	db.Order("id").Find(&books)
+	if len(books) != 3 {
+		t.Fatalf("%d books after the update, want 3", len(books))
+	}
+	if books[0].Title != "Kindred: A Graphic Novel" || books[0].WorkID != kindred.WorkID {
+		t.Errorf("updated book = %q in work %d, want the new title in work %d", books[0].Title, books[0].WorkID, kindred.WorkID)
+	}
+	if books[1].ISBN != dawn.ISBN {
+		t.Errorf("conflicting book's isbn = %q, want it unchanged", books[1].ISBN)
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"net/http"
+)
+
+// MaxBulkItems is the most items a bulk request may have
+const MaxBulkItems = 500
+
+// bulkBatchSize is the number of rows per INSERT of a bulk request
+const bulkBatchSize = 100
+
+// Modes of bulk requests. Atomic requests write nothing unless every item
+// is valid; partial requests write the valid items and report the others.
+const (
+	BulkAtomic  = "atomic"
+	BulkPartial = "partial"
+)
+
+// bulk tracks the outcome of each item of a bulk request
+type bulk struct {
+	mode    string
+	results []dto.BulkResult
+}
+
+func newBulk(mode string, items int) (*bulk, error) {
+	if items == 0 {
+		return nil, invalid("a bulk request needs at least one item")
+	}
+	if items > MaxBulkItems {
+		return nil, invalid(fmt.Sprintf("a bulk request has at most %d items", MaxBulkItems))
+	}
+	if mode == "" {
+		mode = BulkAtomic
+	}
+
+	b := &bulk{mode: mode, results: make([]dto.BulkResult, items)}
+	for i := range b.results {
+		b.results[i].Index = i
+	}
+	return b, nil
+}
+
+// decode reads and validates item i into request, reporting whether it is
+// valid
+func (b *bulk) decode(i int, item json.RawMessage, request interface{}) bool {
+	if err := json.Unmarshal(item, request); err != nil {
+		b.fail(i, invalid("invalid item: "+err.Error()))
+		return false
+	}
+	if err := validate(request); err != nil {
+		b.fail(i, err)
+		return false
+	}
+	return true
+}
+
+// fail records why item i can't be written. Only the first reason is kept.
+func (b *bulk) fail(i int, err error) {
+	if b.failed(i) {
+		return
+	}
+	status := http.StatusBadRequest
+	if errors.Is(err, ErrNotFound) {
+		status = http.StatusNotFound
+	}
+	b.results[i].Status = status
+	b.results[i].Error = err.Error()
+}
+
+func (b *bulk) failed(i int) bool {
+	return b.results[i].Error != ""
+}
+
+// failDuplicates fails the items whose key appeared in an earlier item
+func (b *bulk) failDuplicates(keys []string, name string) {
+	seen := map[string]bool{}
+	for i, key := range keys {
+		if b.failed(i) || key == "" {
+			continue
+		}
+		if seen[key] {
+			b.fail(i, invalid(name+" appears in more than one item"))
+		}
+		seen[key] = true
+	}
+}
+
+// writable returns the indexes of the items to write: the valid ones, or
+// none in atomic mode once an item failed
+func (b *bulk) writable() []int {
+	var indexes []int
+	for i := range b.results {
+		if b.failed(i) {
+			if b.mode == BulkAtomic {
+				return nil
+			}
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// succeed records that item i was written
+func (b *bulk) succeed(i int, status int, id ids.ID) {
+	b.results[i].Status = status
+	b.results[i].ID = id
+}
+
+// response summarises the results. Valid items that were not written
+// because another item failed are reported as failed dependencies.
+func (b *bulk) response() dto.BulkResponse {
+	response := dto.BulkResponse{Mode: b.mode, Results: b.results}
+	for i := range b.results {
+		if b.results[i].Status == 0 {
+			b.results[i].Status = http.StatusFailedDependency
+			b.results[i].Error = "not written because another item failed"
+		}
+		if b.results[i].Status >= http.StatusBadRequest {
+			response.Failed++
+		} else {
+			response.Succeeded++
+		}
+	}
+	return response
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"mentalartsapi/cache"
+	"mentalartsapi/dto"
+	"mentalartsapi/ids"
+	"mentalartsapi/metrics"
+	"mentalartsapi/models"
+	"mentalartsapi/utils"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateReview posts a review on an edition. The review belongs to the
+// edition's work so that it is shared by all of its editions.
+func CreateReview(db *gorm.DB, bookID ids.ID, request dto.ReviewRequest) (models.Review, error) {
+	var review models.Review
+
+	var book models.Book
+	if err := db.First(&book, bookID).Error; err != nil {
+		return review, LookupError(err, "book")
+	}
+	if err := validate(request); err != nil {
+		return review, err
+	}
+
+	review.Rating = request.Rating
+	review.Comment = request.Comment
+	review.DatePosted = time.Now()
+	review.BookID = book.ID
+	review.WorkID = book.WorkID
+
+	if err := db.Create(&review).Error; err != nil {
+		return review, err
+	}
+	metrics.Add(db.Statement.Context, metrics.ReviewsPosted, 1)
+	invalidateReviews(db, review)
+
+	// Load relations for response
+	db.Preload("Book").First(&review, review.ID)
+	return review, nil
+}
+
+// ListBookReviews returns a page of the reviews of an edition's work,
+// including those posted on its other editions, and their total number
+func ListBookReviews(db *gorm.DB, bookID ids.ID, pagination dto.PaginationQuery) ([]models.Review, int64, error) {
+	var reviews []models.Review
+	var total int64
+
+	var book models.Book
+	if err := db.First(&book, bookID).Error; err != nil {
+		return nil, 0, LookupError(err, "book")
+	}
+
+	if err := db.Model(&models.Review{}).Where("work_id = ?", book.WorkID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := utils.Paginate(db, &pagination).
+		Where("work_id = ?", book.WorkID).
+		Find(&reviews).Error; err != nil {
+		return nil, 0, err
+	}
+	return reviews, total, nil
+}
+
+// UpdateReview replaces the rating and comment of a review
+func UpdateReview(db *gorm.DB, id ids.ID, request dto.ReviewRequest) (models.Review, error) {
+	var review models.Review
+	if err := validate(request); err != nil {
+		return review, err
+	}
+	if err := db.First(&review, id).Error; err != nil {
+		return review, LookupError(err, "review")
+	}
+
+	review.Rating = request.Rating
+	review.Comment = request.Comment
+	if err := db.Save(&review).Error; err != nil {
+		return review, err
+	}
+	invalidateReviews(db, review)
+	return review, nil
+}
+
+// DeleteReview deletes a review
+func DeleteReview(db *gorm.DB, id ids.ID) error {
+	var review models.Review
+	if err := db.First(&review, id).Error; err != nil {
+		return LookupError(err, "review")
+	}
+	if err := db.Delete(&review).Error; err != nil {
+		return err
+	}
+	invalidateReviews(db, review)
+	return nil
+}
+
+// WorkRating aggregates the ratings of all reviews of a work
+func WorkRating(db *gorm.DB, workID ids.ID) (dto.RatingSummary, error) {
+	var rating dto.RatingSummary
+	err := db.Model(&models.Review{}).
+		Select("COUNT(*) AS count, COALESCE(AVG(rating), 0) AS average").
+		Where("work_id = ?", workID).
+		Scan(&rating).Error
+	return rating, err
+}
+
+// BulkCreateReviews posts reviews like CreateReview does, inserting them in
+// batches
+func BulkCreateReviews(db *gorm.DB, request dto.BulkRequest) (dto.BulkResponse, error) {
+	b, err := newBulk(request.Mode, len(request.Items))
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	items := make([]dto.ReviewCreateItem, len(request.Items))
+	for i, item := range request.Items {
+		b.decode(i, item, &items[i])
+	}
+	books, err := loadBooks(db, b, itemIDs(b, items, func(item dto.ReviewCreateItem) ids.ID { return item.BookID }))
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	indexes := b.writable()
+	if len(indexes) == 0 {
+		return b.response(), nil
+	}
+
+	now := time.Now()
+	reviews := make([]models.Review, len(indexes))
+	for k, i := range indexes {
+		book := books[items[i].BookID]
+		reviews[k] = models.Review{
+			Rating:     items[i].Rating,
+			Comment:    items[i].Comment,
+			DatePosted: now,
+			BookID:     book.ID,
+			WorkID:     book.WorkID,
+		}
+	}
+	if err := db.Omit(clause.Associations).CreateInBatches(&reviews, bulkBatchSize).Error; err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	for k, i := range indexes {
+		b.succeed(i, http.StatusCreated, reviews[k].ID)
+	}
+	metrics.Add(db.Statement.Context, metrics.ReviewsPosted, float64(len(reviews)))
+	invalidateReviews(db, reviews...)
+	return b.response(), nil
+}
+
+// BulkUpdateReviews replaces the ratings and comments of reviews, writing
+// them with batched upserts on the primary key
+func BulkUpdateReviews(db *gorm.DB, request dto.BulkRequest) (dto.BulkResponse, error) {
+	b, err := newBulk(request.Mode, len(request.Items))
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	items := make([]dto.ReviewUpdateItem, len(request.Items))
+	keys := make([]string, len(items))
+	for i, item := range request.Items {
+		if b.decode(i, item, &items[i]) {
+			keys[i] = items[i].ID.String()
+		}
+	}
+	b.failDuplicates(keys, "id")
+
+	current, err := loadReviews(db, b, itemIDs(b, items, func(item dto.ReviewUpdateItem) ids.ID { return item.ID }))
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	indexes := b.writable()
+	if len(indexes) == 0 {
+		return b.response(), nil
+	}
+
+	now := time.Now()
+	reviews := make([]models.Review, len(indexes))
+	for k, i := range indexes {
+		reviews[k] = current[items[i].ID]
+		reviews[k].Rating = items[i].Rating
+		reviews[k].Comment = items[i].Comment
+		reviews[k].UpdatedAt = now
+	}
+	err = db.Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rating", "comment", "updated_at"}),
+	}).CreateInBatches(&reviews, bulkBatchSize).Error
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	for _, i := range indexes {
+		b.succeed(i, http.StatusOK, items[i].ID)
+	}
+	invalidateReviews(db, reviews...)
+	return b.response(), nil
+}
+
+// BulkDeleteReviews deletes reviews in one statement
+func BulkDeleteReviews(db *gorm.DB, request dto.BulkDeleteRequest) (dto.BulkResponse, error) {
+	b, err := newBulk(request.Mode, len(request.IDs))
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	keys := make([]string, len(request.IDs))
+	for i, id := range request.IDs {
+		keys[i] = id.String()
+	}
+	b.failDuplicates(keys, "id")
+	current, err := loadReviews(db, b, request.IDs)
+	if err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	indexes := b.writable()
+	if len(indexes) == 0 {
+		return b.response(), nil
+	}
+
+	reviewIDs := make([]ids.ID, len(indexes))
+	reviews := make([]models.Review, len(indexes))
+	for k, i := range indexes {
+		reviewIDs[k] = request.IDs[i]
+		reviews[k] = current[request.IDs[i]]
+	}
+	if err := db.Where("id IN ?", reviewIDs).Delete(&models.Review{}).Error; err != nil {
+		return dto.BulkResponse{}, err
+	}
+
+	for _, i := range indexes {
+		b.succeed(i, http.StatusOK, request.IDs[i])
+	}
+	invalidateReviews(db, reviews...)
+	return b.response(), nil
+}
+
+// invalidateReviews drops the cached responses showing the reviews and
+// ratings of the works of the reviews
+func invalidateReviews(db *gorm.DB, reviews ...models.Review) {
+	tags := make([]string, len(reviews))
+	for i, review := range reviews {
+		tags[i] = cache.Children("works", review.WorkID, "reviews")
+	}
+	cache.Invalidate(db.Statement.Context, tags...)
+}
+
+// loadReviews loads the reviews with the given IDs, one per item, and fails
+// the items whose review doesn't exist
+func loadReviews(db *gorm.DB, b *bulk, reviewIDs []ids.ID) (map[ids.ID]models.Review, error) {
+	var reviews []models.Review
+	if err := db.Where("id IN ?", reviewIDs).Find(&reviews).Error; err != nil {
+		return nil, err
+	}
+	found := make(map[ids.ID]models.Review, len(reviews))
+	for _, review := range reviews {
+		found[review.ID] = review
+	}
+	for i, id := range reviewIDs {
+		if _, ok := found[id]; !ok && !b.failed(i) {
+			b.fail(i, notFound("review"))
+		}
+	}
+	return found, nil
+}
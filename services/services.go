@@ -0,0 +1,70 @@
+// Package services holds the business rules for authors, books and reviews
+// shared by the REST, GraphQL and gRPC APIs. Every function takes a database
+// handle already bound to the request context, so queries stay scoped to the
+// tenant of the request.
+package services
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrNotFound is the kind of errors for missing resources
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid is the kind of errors for requests that fail validation
+	ErrInvalid = errors.New("invalid request")
+)
+
+// Error is a failure the client can act on. Its message is safe to return
+// to the client and its kind decides the status code.
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+func notFound(resource string) error {
+	return &Error{Kind: ErrNotFound, Message: resource + " not found"}
+}
+
+// LookupError returns the error of looking up a resource: a not found error
+// when there is no such resource, and any other failure, such as a lost
+// connection, as it is
+func LookupError(err error, resource string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFound(resource)
+	}
+	return err
+}
+
+// referenceError is like LookupError for a resource a request refers to,
+// which makes the request invalid when it is missing
+func referenceError(err error, resource string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return invalid(resource + " not found")
+	}
+	return err
+}
+
+func invalid(message string) error {
+	return &Error{Kind: ErrInvalid, Message: message}
+}
+
+// validate checks a request against its binding tags, the same rules the
+// REST API applies when binding a body
+func validate(request interface{}) error {
+	if err := binding.Validator.ValidateStruct(request); err != nil {
+		return invalid(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid object key")
+
+// Store persists binary objects such as cover images and knows the public
+// URL they are served from
+type Store interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+// cleanKey normalises an object key and rejects keys that would escape the
+// store's root
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "..") {
+		return "", ErrInvalidKey
+	}
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
@@ -0,0 +1,19 @@
+package tenancy
+
+import "context"
+
+type contextKey struct{}
+
+// WithTenant returns a copy of ctx that carries the given tenant ID
+func WithTenant(ctx context.Context, tenantID uint) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenantID)
+}
+
+// FromContext returns the tenant ID stored in ctx, if any
+func FromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	tenantID, ok := ctx.Value(contextKey{}).(uint)
+	return tenantID, ok && tenantID != 0
+}
@@ -0,0 +1,68 @@
+package tenancy
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FieldName is the struct field that marks a model as tenant-owned
+const FieldName = "TenantID"
+
+// Plugin scopes every GORM statement to the tenant found in the statement
+// context. Models without a TenantID field and statements without a tenant
+// in their context are left untouched.
+type Plugin struct{}
+
+// Name implements gorm.Plugin
+func (Plugin) Name() string {
+	return "tenancy"
+}
+
+// Initialize implements gorm.Plugin
+func (Plugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("tenancy:create", assignTenant); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("tenancy:query", scopeTenant); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("tenancy:update", scopeTenant); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("tenancy:delete", scopeTenant); err != nil {
+		return err
+	}
+	return db.Callback().Row().Before("gorm:row").Register("tenancy:row", scopeTenant)
+}
+
+// assignTenant stamps the current tenant on records being created
+func assignTenant(db *gorm.DB) {
+	tenantID, ok := FromContext(db.Statement.Context)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField(FieldName)
+	if field == nil {
+		return
+	}
+
+	db.Statement.SetColumn(field.Name, tenantID, true)
+}
+
+// scopeTenant restricts reads, updates and deletes to the current tenant
+func scopeTenant(db *gorm.DB) {
+	tenantID, ok := FromContext(db.Statement.Context)
+	if !ok || db.Statement.Schema == nil {
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField(FieldName)
+	if field == nil {
+		return
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenantID},
+	}})
+}
@@ -0,0 +1,122 @@
+package tenancy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+type note struct {
+	ID       uint
+	TenantID uint
+	Text     string
+}
+
+type setting struct {
+	ID   uint
+	Name string
+}
+
+func TestPlugin(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.Use(Plugin{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&note{}, &setting{}); err != nil {
+		t.Fatal(err)
+	}
+	a := db.WithContext(WithTenant(context.Background(), 1))
+	b := db.WithContext(WithTenant(context.Background(), 2))
+
+	// Creates are stamped with the tenant, whatever they were given
+	a.Create(&note{Text: "a's", TenantID: 2})
+	b.Create(&note{Text: "b's"})
+	a.Create(&setting{Name: "shared"})
+
+	var notes []note
+	a.Find(&notes)
+	if len(notes) != 1 || notes[0].Text != "a's" || notes[0].TenantID != 1 {
+		t.Errorf("tenant 1 sees %+v, want only its note", notes)
+	}
+	var count int64
+	b.Model(&note{}).Count(&count)
+	if count != 1 {
+		t.Errorf("tenant 2 counts %d notes, want 1", count)
+	}
+
+	// Updates and deletes can't reach another tenant's rows
+	if rows := a.Model(&note{}).Where("text = ?", "b's").Update("text", "changed").RowsAffected; rows != 0 {
+		t.Errorf("tenant 1 updated %d of tenant 2's notes", rows)
+	}
+	if rows := a.Where("text = ?", "b's").Delete(&note{}).RowsAffected; rows != 0 {
+		t.Errorf("tenant 1 deleted %d of tenant 2's notes", rows)
+	}
+
+	// Without a tenant, and for models without one, nothing is scoped
+	db.Model(&note{}).Count(&count)
+	if count != 2 {
+		t.Errorf("unscoped count = %d, want 2", count)
+	}
+	var settings []setting
+	b.Find(&settings)
+	if len(settings) != 1 {
+		t.Errorf("tenant 2 sees %d settings, want the shared one", len(settings))
+	}
+}
+
+func sign(secret, header, payload string) string {
+	h := base64.RawURLEncoding.EncodeToString([]byte(header))
+	p := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(h + "." + p))
+	return h + "." + p + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestTenantFromToken(t *testing.T) {
+	const header = `{"alg":"HS256","typ":"JWT"}`
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	past := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+
+	valid := []string{
+		sign("secret", header, `{"tenant":"acme"}`),
+		sign("secret", header, `{"tenant":"acme","exp":`+future+`}`),
+	}
+	for _, token := range valid {
+		if tenant, err := TenantFromToken(token, []byte("secret")); err != nil || tenant != "acme" {
+			t.Errorf("TenantFromToken = %q, %v, want acme", tenant, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"other secret":  sign("other", header, `{"tenant":"acme"}`),
+		"expired":       sign("secret", header, `{"tenant":"acme","exp":`+past+`}`),
+		"no tenant":     sign("secret", header, `{"sub":"acme"}`),
+		"alg none":      sign("secret", `{"alg":"none"}`, `{"tenant":"acme"}`),
+		"not a jwt":     "acme",
+		"bad signature": valid[0][:len(valid[0])-2] + "!!",
+	}
+	for name, token := range invalid {
+		if _, err := TenantFromToken(token, []byte("secret")); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: error = %v, want %v", name, err, ErrInvalidToken)
+		}
+	}
+	if _, err := TenantFromToken(valid[0], nil); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token accepted without a secret: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package tenancy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ClaimName is the JWT claim carrying the tenant slug
+const ClaimName = "tenant"
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// TenantFromToken verifies an HS256 signed JWT with secret and returns the
+// value of its tenant claim
+func TenantFromToken(token string, secret []byte) (string, error) {
+	claims, err := VerifyToken(token, secret)
+	if err != nil {
+		return "", err
+	}
+	tenant, _ := claims[ClaimName].(string)
+	if tenant == "" {
+		return "", ErrInvalidToken
+	}
+	return tenant, nil
+}
+
+// VerifyToken verifies an HS256 signed JWT with secret and its expiry, and
+// returns its claims
+func VerifyToken(token string, secret []byte) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || len(secret) == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if exp, ok := claims["exp"].(float64); ok && time.Now().Unix() > int64(exp) {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// spanKey is the statement setting holding the span of a statement
+const spanKey = "tracing:span"
+
+// rowsAffectedKey is the attribute of the rows a statement returned or
+// changed
+const rowsAffectedKey = attribute.Key("db.rows_affected")
+
+// GORMPlugin traces every GORM statement as a child of the span in the
+// statement context. Preloads get spans of their own, next to the query
+// that triggered them.
+type GORMPlugin struct{}
+
+// Name implements gorm.Plugin
+func (GORMPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize implements gorm.Plugin
+func (GORMPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("tracing:before_create", startSpan); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("tracing:after_create", endSpan); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("tracing:before_query", startSpan); err != nil {
+		return err
+	}
+	// End the span before the preloads, which trace their own queries
+	if err := callbacks.Query().After("gorm:query").Before("gorm:preload").Register("tracing:after_query", endSpan); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("tracing:before_update", startSpan); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("tracing:after_update", endSpan); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("tracing:before_delete", startSpan); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("tracing:after_delete", endSpan); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("tracing:before_row", startSpan); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:row").Register("tracing:after_row", endSpan); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("tracing:before_raw", startSpan); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("tracing:after_raw", endSpan)
+}
+
+func startSpan(db *gorm.DB) {
+	ctx := db.Statement.Context
+	if ctx == nil || !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		// Statements outside a request, like migrations, are not traced
+		return
+	}
+	_, span := tracer().Start(ctx, "sql",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemKey.String(db.Dialector.Name())),
+	)
+	db.InstanceSet(spanKey, span)
+}
+
+// endSpan names the span after the statement once its SQL is built, e.g.
+// SELECT books
+func endSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	query := db.Statement.SQL.String()
+	operation, _, _ := strings.Cut(strings.TrimSpace(query), " ")
+	operation = strings.ToUpper(operation)
+	name := operation
+	if name == "" {
+		name = "sql"
+	}
+	if table := db.Statement.Table; table != "" {
+		name += " " + table
+		span.SetAttributes(semconv.DBCollectionName(table))
+	}
+	span.SetName(name)
+	span.SetAttributes(
+		semconv.DBOperationName(operation),
+		semconv.DBQueryText(query),
+	)
+	if db.Statement.RowsAffected >= 0 {
+		span.SetAttributes(rowsAffectedKey.Int64(db.Statement.RowsAffected))
+	}
+	if err := db.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
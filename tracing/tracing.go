@@ -0,0 +1,69 @@
+// Package tracing traces HTTP requests and the SQL statements they run with
+// OpenTelemetry, and exports the spans over OTLP.
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ServiceName names the API in its spans unless OTEL_SERVICE_NAME is set
+const ServiceName = "mentalartsapi"
+
+// instrumentation names the tracer of this package
+const instrumentation = "mentalartsapi/tracing"
+
+// propagator reads and writes W3C traceparent, tracestate and baggage
+// headers
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// tracer returns the tracer of the global provider, so that spans go to the
+// provider installed last
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Install makes processor receive the spans of the API and returns the
+// provider, whose Shutdown flushes them. Tests pass a simple processor of
+// an in-memory exporter:
+//
+//	exporter := tracetest.NewInMemoryExporter()
+//	tracing.Install(sdktrace.NewSimpleSpanProcessor(exporter))
+func Install(processor sdktrace.SpanProcessor) (*sdktrace.TracerProvider, error) {
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(ServiceName)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	return provider, nil
+}
+
+// InstallFromEnv exports spans over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT
+// or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set, configured by the standard
+// OTEL_* variables. It returns a nil provider when tracing is off.
+func InstallFromEnv(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil, nil
+	}
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Install(sdktrace.NewBatchSpanProcessor(exporter))
+}
@@ -0,0 +1,216 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+type testAuthor struct {
+	ID    uint
+	Name  string
+	Books []testBook `gorm:"foreignKey:AuthorID"`
+}
+
+type testBook struct {
+	ID       uint
+	AuthorID uint
+	Title    string
+}
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider, err := Install(recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Shutdown(context.Background())
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(GORMPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testAuthor{}, &testBook{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&testAuthor{Name: "Ursula", Books: []testBook{{Title: "The Dispossessed"}}}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(HTTP())
+	router.GET("/authors/:id", func(c *gin.Context) {
+		var count int64
+		db.WithContext(c.Request.Context()).Model(&testAuthor{}).Count(&count)
+
+		// Handlers may wrap their work in spans of their own
+		ctx, span := otel.Tracer("handler").Start(c.Request.Context(), "load author")
+		var author testAuthor
+		err := db.WithContext(ctx).Preload("Books").First(&author, c.Param("id")).Error
+		span.End()
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	// The caller's span, as sent in a traceparent header
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	callerSpanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	req := httptest.NewRequest(http.MethodGet, "/authors/1", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() != traceID {
+			t.Errorf("span %s is in trace %s, not the caller's", span.Name(), span.SpanContext().TraceID())
+		}
+		spans[span.Name()] = span
+	}
+
+	server, ok := spans["GET /authors/:id"]
+	if !ok {
+		t.Fatalf("no server span named after the route: %v", names(recorder.Ended()))
+	}
+	if server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("server span kind = %v", server.SpanKind())
+	}
+	if server.Parent().SpanID() != callerSpanID || !server.Parent().IsRemote() {
+		t.Errorf("server span parent = %v, want the caller's span", server.Parent().SpanID())
+	}
+	wantAttributes(t, server, map[string]attribute.Value{
+		"http.request.method":       attribute.StringValue("GET"),
+		"http.route":                attribute.StringValue("/authors/:id"),
+		"url.path":                  attribute.StringValue("/authors/1"),
+		"http.response.status_code": attribute.IntValue(http.StatusOK),
+	})
+
+	handler, ok := spans["load author"]
+	if !ok {
+		t.Fatalf("no handler span: %v", names(recorder.Ended()))
+	}
+	if handler.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("handler span is not a child of the server span")
+	}
+
+	// The count runs in the request's span, the page query and its preload
+	// in the handler's
+	var queries []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindClient {
+			queries = append(queries, span)
+		}
+	}
+	if len(queries) != 3 {
+		t.Fatalf("%d SQL spans, want the count, the page query and the preload: %v", len(queries), names(queries))
+	}
+	tests := []struct {
+		name   string
+		parent sdktrace.ReadOnlySpan
+		table  string
+	}{
+		{name: "SELECT test_authors", parent: server, table: "test_authors"},
+		{name: "SELECT test_authors", parent: handler, table: "test_authors"},
+		{name: "SELECT test_books", parent: handler, table: "test_books"},
+	}
+	for i, tt := range tests {
+		span := queries[i]
+		if span.Name() != tt.name {
+			t.Errorf("SQL span %d is %s, want %s", i, span.Name(), tt.name)
+		}
+		if span.Parent().SpanID() != tt.parent.SpanContext().SpanID() {
+			t.Errorf("SQL span %d %s is a child of %s, want %s", i, span.Name(), parentName(recorder.Ended(), span), tt.parent.Name())
+		}
+		wantAttributes(t, span, map[string]attribute.Value{
+			"db.system":          attribute.StringValue("sqlite"),
+			"db.operation.name":  attribute.StringValue("SELECT"),
+			"db.collection.name": attribute.StringValue(tt.table),
+			"db.rows_affected":   attribute.Int64Value(1),
+		})
+		if attributes(span)["db.query.text"].AsString() == "" {
+			t.Errorf("SQL span %d has no query text", i)
+		}
+	}
+}
+
+// TestTracingOutsideRequests leaves statements without a span in their
+// context, like migrations, untraced
+func TestTracingOutsideRequests(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider, err := Install(recorder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Shutdown(context.Background())
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(GORMPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&testBook{}); err != nil {
+		t.Fatal(err)
+	}
+	db.Create(&testBook{Title: "Untraced"})
+
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("statements outside requests traced: %v", names(spans))
+	}
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	values := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		values[kv.Key] = kv.Value
+	}
+	return values
+}
+
+func wantAttributes(t *testing.T, span sdktrace.ReadOnlySpan, want map[string]attribute.Value) {
+	t.Helper()
+	got := attributes(span)
+	for key, value := range want {
+		if got[attribute.Key(key)] != value {
+			t.Errorf("%s %s = %v, want %v", span.Name(), key, got[attribute.Key(key)].Emit(), value.Emit())
+		}
+	}
+}
+
+func names(spans []sdktrace.ReadOnlySpan) []string {
+	var names []string
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	return names
+}
+
+func parentName(spans []sdktrace.ReadOnlySpan, span sdktrace.ReadOnlySpan) string {
+	for _, s := range spans {
+		if s.SpanContext().SpanID() == span.Parent().SpanID() {
+			return s.Name()
+		}
+	}
+	return span.Parent().SpanID().String()
+}
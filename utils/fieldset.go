@@ -0,0 +1,316 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	DefaultIncludeLimit = 20
+	MaxIncludeLimit     = 100
+)
+
+var schemaCache sync.Map
+
+// Relation is a related resource that can be expanded with include=
+type Relation struct {
+	// Name is both the include name and the JSON key of the relation
+	Name string
+	// Collection relations are limited to DefaultIncludeLimit rows unless
+	// limit[name] asks for another number
+	Collection bool
+	// Default relations are included when the request has no include
+	// parameter
+	Default bool
+}
+
+// Fieldset is the sparse fieldset and relation expansion requested with the
+// fields, include and limit[...] query parameters
+type Fieldset struct {
+	// Fields are the JSON names of the requested attributes, empty for all
+	Fields []string
+	// Include maps the included relations to their row limits, zero for
+	// relations that aren't collections
+	Include map[string]int
+
+	columns   map[string]string
+	relations map[string]bool
+	table     string
+}
+
+// ParseFieldset reads the fieldset of a request for a resource of the given
+// model. Attributes are the model's columns; relations are those declared
+// plus any association of the model, which are left out of the response
+// unless included.
+func ParseFieldset(c *gin.Context, model interface{}, relations ...Relation) (Fieldset, error) {
+	s, err := schema.Parse(model, &schemaCache, schema.NamingStrategy{})
+	if err != nil {
+		return Fieldset{}, err
+	}
+
+	fieldset := Fieldset{
+		Include:   map[string]int{},
+		columns:   map[string]string{},
+		relations: map[string]bool{},
+		table:     s.Table,
+	}
+	for _, field := range s.Fields {
+		name := jsonName(field)
+		if name == "" {
+			continue
+		}
+		if field.DBName != "" {
+			fieldset.columns[name] = field.DBName
+		} else if _, ok := s.Relationships.Relations[field.Name]; ok {
+			fieldset.relations[name] = true
+		}
+	}
+
+	declared := map[string]Relation{}
+	for _, relation := range relations {
+		declared[relation.Name] = relation
+		fieldset.relations[relation.Name] = true
+	}
+
+	if fields, ok := c.GetQuery("fields"); ok {
+		for _, name := range splitList(fields) {
+			if _, ok := fieldset.columns[name]; !ok {
+				return Fieldset{}, fmt.Errorf("unknown field %q, expected one of %s", name, strings.Join(sortedKeys(fieldset.columns), ", "))
+			}
+			fieldset.Fields = append(fieldset.Fields, name)
+		}
+	}
+
+	include, ok := c.GetQuery("include")
+	if ok {
+		for _, name := range splitList(include) {
+			relation, ok := declared[name]
+			if !ok {
+				return Fieldset{}, fmt.Errorf("unknown include %q, expected one of %s", name, strings.Join(relationNames(relations), ", "))
+			}
+			fieldset.Include[name] = includeLimit(relation)
+		}
+	} else {
+		for _, relation := range relations {
+			if relation.Default {
+				fieldset.Include[relation.Name] = includeLimit(relation)
+			}
+		}
+	}
+
+	for name, value := range c.QueryMap("limit") {
+		relation, ok := declared[name]
+		if _, included := fieldset.Include[name]; !ok || !relation.Collection || !included {
+			return Fieldset{}, fmt.Errorf("limit[%s] requires %s to be an included collection", name, name)
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MaxIncludeLimit {
+			return Fieldset{}, fmt.Errorf("limit[%s] must be between 1 and %d", name, MaxIncludeLimit)
+		}
+		fieldset.Include[name] = limit
+	}
+
+	return fieldset, nil
+}
+
+// Includes reports whether a relation is included
+func (f Fieldset) Includes(name string) bool {
+	_, ok := f.Include[name]
+	return ok
+}
+
+// Limit returns the row limit of an included collection
+func (f Fieldset) Limit(name string) int {
+	return f.Include[name]
+}
+
+// Select restricts a query to the columns of the requested fields, the
+// primary key and the given columns that handlers need to load relations
+func (f Fieldset) Select(query *gorm.DB, required ...string) *gorm.DB {
+	if len(f.Fields) == 0 {
+		return query
+	}
+	columns := []string{f.table + ".id"}
+	for _, column := range required {
+		columns = append(columns, f.table+"."+column)
+	}
+	for _, name := range f.Fields {
+		columns = append(columns, f.table+"."+f.columns[name])
+	}
+	return query.Select(columns)
+}
+
+// Filter serialises a resource, or a slice of them, keeping only the ID,
+// the requested fields and the included relations
+func (f Fieldset) Filter(v interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+		for i, item := range items {
+			if items[i], err = f.filterObject(item); err != nil {
+				return nil, err
+			}
+		}
+		return json.Marshal(items)
+	}
+	return f.filterObject(data)
+}
+
+// FilterList serialises a paginated list response, filtering the resources
+// in its data member and keeping the pagination as it is
+func (f Fieldset) FilterList(list interface{}) (json.RawMessage, error) {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	return rewriteObject(data, func(key string, value json.RawMessage) (json.RawMessage, error) {
+		if key == "data" {
+			return f.Filter(value)
+		}
+		return value, nil
+	})
+}
+
+func (f Fieldset) filterObject(data json.RawMessage) (json.RawMessage, error) {
+	return rewriteObject(data, func(key string, value json.RawMessage) (json.RawMessage, error) {
+		if !f.keep(key) {
+			return nil, nil
+		}
+		return value, nil
+	})
+}
+
+// rewriteObject rewrites the members of a JSON object in order, dropping
+// those rewritten to nil. Other JSON values are returned as they are.
+func rewriteObject(data json.RawMessage, rewrite func(key string, value json.RawMessage) (json.RawMessage, error)) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return data, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		if value, err = rewrite(key, value); err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (f Fieldset) keep(key string) bool {
+	if f.relations[key] {
+		return f.Includes(key)
+	}
+	if key == "ID" || len(f.Fields) == 0 {
+		return true
+	}
+	for _, name := range f.Fields {
+		if name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// PreloadLimited preloads a has-many relation with at most limit rows for
+// each parent, the first ones in the given order. The rows are ranked per
+// parent with a window function, so one query serves any number of parents.
+func PreloadLimited(query *gorm.DB, relation string, model interface{}, foreignKey, order string, limit int) *gorm.DB {
+	s, err := schema.Parse(model, &schemaCache, schema.NamingStrategy{})
+	if err != nil {
+		query.AddError(err)
+		return query
+	}
+
+	return query.Preload(relation, func(tx *gorm.DB) *gorm.DB {
+		ranked := tx.Session(&gorm.Session{NewDB: true}).Model(model).
+			Select(fmt.Sprintf("*, ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) AS preload_rank", foreignKey, order))
+		return tx.Table("(?) AS "+s.Table, ranked).
+			Where("preload_rank <= ?", limit).
+			Order(order)
+	})
+}
+
+func includeLimit(relation Relation) int {
+	if relation.Collection {
+		return DefaultIncludeLimit
+	}
+	return 0
+}
+
+func jsonName(field *schema.Field) string {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+	return name
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func relationNames(relations []Relation) []string {
+	names := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		names = append(names, relation.Name)
+	}
+	return names
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"fmt"
+	"mentalartsapi/models"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+var authorRelations = []Relation{
+	{Name: "books", Collection: true, Default: true},
+	{Name: "rating", Default: false},
+}
+
+func parseAuthorFieldset(query string) (Fieldset, error) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/authors?"+query, nil)
+	return ParseFieldset(c, &models.Author{}, authorRelations...)
+}
+
+func TestParseFieldset(t *testing.T) {
+	tests := []struct {
+		query       string
+		wantFields  []string
+		wantInclude map[string]int
+		wantErr     string
+	}{
+		{query: "", wantInclude: map[string]int{"books": DefaultIncludeLimit}},
+		{query: "fields=name,%20biography", wantFields: []string{"name", "biography"}, wantInclude: map[string]int{"books": DefaultIncludeLimit}},
+		{query: "include=", wantInclude: map[string]int{}},
+		{query: "include=rating", wantInclude: map[string]int{"rating": 0}},
+		{query: "include=books,rating&limit[books]=5", wantInclude: map[string]int{"books": 5, "rating": 0}},
+		{query: "fields=books", wantErr: `unknown field "books", expected one of CreatedAt, DeletedAt, ID, UpdatedAt, biography, birth_date, name`},
+		{query: "include=publisher", wantErr: `unknown include "publisher", expected one of books, rating`},
+		{query: "include=rating&limit[books]=5", wantErr: "limit[books] requires books to be an included collection"},
+		{query: "limit[rating]=5", wantErr: "limit[rating] requires rating to be an included collection"},
+		{query: "limit[books]=101", wantErr: fmt.Sprintf("limit[books] must be between 1 and %d", MaxIncludeLimit)},
+		{query: "limit[books]=none", wantErr: fmt.Sprintf("limit[books] must be between 1 and %d", MaxIncludeLimit)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			fieldset, err := parseAuthorFieldset(tt.query)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fieldset.Fields, tt.wantFields) || !reflect.DeepEqual(fieldset.Include, tt.wantInclude) {
+				t.Errorf("fields = %v, include = %v, want %v and %v", fieldset.Fields, fieldset.Include, tt.wantFields, tt.wantInclude)
+			}
+		})
+	}
+}
+
+func TestFieldsetFilter(t *testing.T) {
+	author := models.Author{Model: models.Model{ID: 7}, Name: "Ursula K. Le Guin", Biography: "Wrote Earthsea.", Books: []models.Book{{Title: "Tehanu"}}}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "fields=name&include=", want: `{"ID":7,"name":"Ursula K. Le Guin"}`},
+		{query: "fields=name,biography&include=", want: `{"ID":7,"name":"Ursula K. Le Guin","biography":"Wrote Earthsea."}`},
+	}
+	for _, tt := range tests {
+		fieldset, err := parseAuthorFieldset(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := fieldset.Filter(author)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Filter with %s = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	// Lists keep their pagination and filter each resource
+	fieldset, _ := parseAuthorFieldset("fields=name&include=")
+	list, err := fieldset.FilterList(map[string]interface{}{"data": []models.Author{author}, "pagination": map[string]int{"page": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"data":[{"ID":7,"name":"Ursula K. Le Guin"}],"pagination":{"page":1}}`; string(list) != want {
+		t.Errorf("FilterList = %s, want %s", list, want)
+	}
+}
+
+func TestPreloadLimited(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Author{}, &models.Book{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Ursula K. Le Guin", "Octavia E. Butler", "Iain M. Banks"} {
+		author := models.Author{Name: name}
+		if err := db.Create(&author).Error; err != nil {
+			t.Fatal(err)
+		}
+		if name == "Iain M. Banks" {
+			continue
+		}
+		for i := 1; i <= 3; i++ {
+			book := models.Book{Title: fmt.Sprintf("%s %d", name, i), ISBN: fmt.Sprintf("%d-%d", author.ID, i), AuthorID: author.ID}
+			if err := db.Create(&book).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var authors []models.Author
+	if err := PreloadLimited(db, "Books", &models.Book{}, "author_id", "id DESC", 2).Order("id").Find(&authors).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range [][]string{
+		{"Ursula K. Le Guin 3", "Ursula K. Le Guin 2"},
+		{"Octavia E. Butler 3", "Octavia E. Butler 2"},
+		nil,
+	} {
+		var titles []string
+		for _, book := range authors[i].Books {
+			titles = append(titles, book.Title)
+		}
+		if !reflect.DeepEqual(titles, want) {
+			t.Errorf("books of %s = %v, want %v", authors[i].Name, titles, want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"mentalartsapi/dto"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// FilterBooks applies book list filters to a GORM query on books
+func FilterBooks(query *gorm.DB, filters dto.BookFilterQuery) *gorm.DB {
+	if filters.Query != "" {
+		query = query.Where("LOWER(books.title) LIKE ?", "%"+strings.ToLower(filters.Query)+"%")
+	}
+	if filters.AuthorID != 0 {
+		query = query.Where("books.author_id = ?", filters.AuthorID)
+	}
+	if filters.WorkID != 0 {
+		query = query.Where("books.work_id = ?", filters.WorkID)
+	}
+	if filters.PublisherID != 0 {
+		query = query.Where("books.publisher_id = ?", filters.PublisherID)
+	}
+	if filters.Format != "" {
+		query = query.Where("books.format = ?", filters.Format)
+	}
+	if filters.Language != "" {
+		query = query.Where("books.language = ?", filters.Language)
+	}
+	if filters.YearFrom != 0 {
+		query = query.Where("books.publication_year >= ?", filters.YearFrom)
+	}
+	if filters.YearTo != 0 {
+		query = query.Where("books.publication_year <= ?", filters.YearTo)
+	}
+	return query
+}
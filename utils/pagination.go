@@ -1,8 +1,9 @@
 package utils
 
 import (
-	"mentalartsapi/dto"
 	"math"
+	"mentalartsapi/dto"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -22,21 +23,17 @@ func ParsePaginationQuery(c *gin.Context) dto.PaginationQuery {
 
 	// Try to bind query parameters
 	if page := c.Query("page"); page != "" {
-		if pageInt, err := c.GetQuery("page"); err {
-			if pageVal, err := c.GetInt("page"); err == nil && pageVal > 0 {
-				pagination.Page = pageVal
-			}
+		if pageVal, err := strconv.Atoi(page); err == nil && pageVal > 0 {
+			pagination.Page = pageVal
 		}
 	}
 
 	if pageSize := c.Query("page_size"); pageSize != "" {
-		if pageSizeInt, err := c.GetQuery("page_size"); err {
-			if pageSizeVal, err := c.GetInt("page_size"); err == nil && pageSizeVal > 0 {
-				if pageSizeVal > 100 {
-					pagination.PageSize = 100 // Maximum page size
-				} else {
-					pagination.PageSize = pageSizeVal
-				}
+		if pageSizeVal, err := strconv.Atoi(pageSize); err == nil && pageSizeVal > 0 {
+			if pageSizeVal > 100 {
+				pagination.PageSize = 100 // Maximum page size
+			} else {
+				pagination.PageSize = pageSizeVal
 			}
 		}
 	}